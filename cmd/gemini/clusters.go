@@ -0,0 +1,230 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/scylladb/gemini/pkg/cluster"
+	"github.com/scylladb/gemini/pkg/store"
+)
+
+// addClusterFlags adds the --<name>-* connection flags of a cluster to the
+// command. The flags that are not set fall back to --cluster-config and
+// then to the flags shared by both clusters.
+func addClusterFlags(cmd *cobra.Command, name, shorthand, hostsUsage string) {
+	cfg := &testClusterConfig
+	if name == "oracle" {
+		cfg = &oracleClusterConfig
+	}
+	flags := cmd.Flags()
+	if name == "oracle" {
+		flags.StringSliceVarP(&cfg.Hosts, name+"-cluster", shorthand, []string{}, hostsUsage)
+	} else {
+		flags.StringArrayVarP(&testClusterHosts, name+"-cluster", shorthand, []string{}, hostsUsage)
+	}
+	flags.IntVarP(&cfg.Port, name+"-port", "", 0, "Native transport port of the "+name+" cluster (default 9042)")
+	flags.StringVarP(&cfg.Username, name+"-username", "", "", "Username for the "+name+" cluster")
+	flags.StringVarP(&cfg.Password, name+"-password", "", "", "Password for the "+name+" cluster")
+	flags.StringVarP(
+		&cfg.Consistency, name+"-consistency", "", "",
+		"Consistency of the statements sent to the "+name+" cluster, overrides --consistency")
+	flags.StringVarP(
+		&cfg.SerialConsistency, name+"-serial-consistency", "", "",
+		"Serial consistency of the LWT statements sent to the "+name+" cluster: SERIAL|LOCAL_SERIAL")
+	flags.IntVarP(
+		&cfg.ProtocolVersion, name+"-protocol-version", "", 0,
+		"CQL native protocol version used with the "+name+" cluster, negotiated if not set")
+	flags.StringVarP(&cfg.Compression, name+"-compression", "", "", "Compression of the connections to the "+name+" cluster: none|snappy")
+	flags.StringVarP(
+		&cfg.LocalDC, name+"-local-dc", "", "",
+		"Datacenter of the "+name+" cluster the driver connects to, unless --"+name+"-remote-dc-fallback is set")
+	flags.BoolVarP(
+		&cfg.RemoteFallback, name+"-remote-dc-fallback", "", false,
+		"Let the driver fall back to the hosts of the other datacenters of the "+name+" cluster than --"+name+"-local-dc")
+	flags.StringVarP(
+		&cfg.HostSelectionPolicy, name+"-host-selection-policy", "", "",
+		"Host selection policy used by the driver for the "+name+
+			" cluster: round-robin|host-pool|token-aware|dc-aware|token-aware(dc-aware) (default round-robin)")
+	flags.BoolVarP(
+		&cfg.TokenRouting, name+"-token-routing", "", false,
+		"Route the statements to the replicas of the "+name+" cluster with the partition key gemini generated them for, "+
+			"requires a token-aware host selection policy")
+	flags.DurationVarP(
+		&cfg.RequestTimeout, name+"-request-timeout", "", 0,
+		"Duration of waiting request execution on the "+name+" cluster, overrides --request-timeout")
+	flags.DurationVarP(
+		&cfg.ConnectTimeout, name+"-connect-timeout", "", 0,
+		"Duration of waiting connection established to the "+name+" cluster, overrides --connect-timeout")
+	flags.StringVarP(
+		&cfg.TLS.CAFile, name+"-tls-ca-file", "", "",
+		"PEM file of the certificate authorities the certificates of the "+name+" cluster are verified with, enables TLS")
+	flags.StringVarP(&cfg.TLS.CertFile, name+"-tls-cert-file", "", "", "PEM file of the client certificate for the "+name+" cluster, enables TLS")
+	flags.StringVarP(&cfg.TLS.KeyFile, name+"-tls-key-file", "", "", "PEM file of the key of the client certificate for the "+name+" cluster")
+	flags.BoolVarP(
+		&cfg.TLS.EnableHostVerification, name+"-tls-host-verification", "", false,
+		"Verify that the certificates of the "+name+" cluster nodes match their addresses")
+}
+
+// parseTestClusters returns the systems under test given as repeated
+// --test-cluster flags, each either a comma separated list of hosts of the
+// single system under test or a name=hosts group.
+func parseTestClusters(args []string) ([]cluster.Config, error) {
+	var unnamed []string
+	var named []cluster.Config
+	for _, arg := range args {
+		name, hosts, found := strings.Cut(arg, "=")
+		if !found {
+			unnamed = append(unnamed, strings.Split(arg, ",")...)
+			continue
+		}
+		if name == "" || name == "oracle" {
+			return nil, errors.Errorf("invalid name of test cluster %q", name)
+		}
+		for _, c := range named {
+			if c.Name == name {
+				return nil, errors.Errorf("test cluster %s given twice", name)
+			}
+		}
+		named = append(named, cluster.Config{Name: name, Hosts: strings.Split(hosts, ",")})
+	}
+	if len(unnamed) > 0 && len(named) > 0 {
+		return nil, errors.New("either name all the test clusters or give a single one")
+	}
+	if len(unnamed) > 0 {
+		return []cluster.Config{{Hosts: unnamed}}, nil
+	}
+	return named, nil
+}
+
+// resolveClusterConfigs resolves the configurations of the systems under
+// test and of the oracle set by the flags with --cluster-config and the
+// flags shared by all clusters.
+func resolveClusterConfigs() error {
+	tests, err := parseTestClusters(testClusterHosts)
+	if err != nil {
+		return err
+	}
+	file := &cluster.File{}
+	if clusterConfigFile != "" {
+		if file, err = cluster.ReadFile(clusterConfigFile); err != nil {
+			return errors.Wrap(err, "cannot read cluster config")
+		}
+	}
+	if len(tests) == 0 || tests[0].Name != "" {
+		if tests, err = mergeTestClusters(tests, file.Tests); err != nil {
+			return err
+		}
+	}
+	if len(tests) == 0 {
+		tests = []cluster.Config{{}}
+	}
+	defaults := cluster.Config{
+		Consistency:         consistency,
+		HostSelectionPolicy: "round-robin",
+		RequestTimeout:      requestTimeout,
+		ConnectTimeout:      connectTimeout,
+	}
+	for i := range tests {
+		tests[i].Merge(testClusterConfig)
+		tests[i].Merge(file.Test)
+		tests[i].Merge(defaults)
+		if len(tests[i].Hosts) == 0 {
+			return errors.New("no test cluster: set --test-cluster or the test hosts of --cluster-config")
+		}
+	}
+	if len(tests) == 1 {
+		tests[0].Name = "test"
+	}
+	testClusterConfigs = tests
+	oracleClusterConfig.Merge(file.Oracle)
+	oracleClusterConfig.Merge(defaults)
+	return nil
+}
+
+// mergeTestClusters merges the named systems under test of the flags and of
+// the config file.
+func mergeTestClusters(tests, fileTests []cluster.Config) ([]cluster.Config, error) {
+	for _, ft := range fileTests {
+		if ft.Name == "" || ft.Name == "oracle" {
+			return nil, errors.Errorf("invalid name of test cluster %q in cluster config", ft.Name)
+		}
+		found := false
+		for i := range tests {
+			if tests[i].Name == ft.Name {
+				tests[i].Merge(ft)
+				found = true
+			}
+		}
+		if !found {
+			tests = append(tests, ft)
+		}
+	}
+	return tests, nil
+}
+
+// createClusters returns the driver configurations of the systems under
+// test and of the oracle cluster, nil if there is none.
+func createClusters() ([]store.TestCluster, *gocql.ClusterConfig, error) {
+	if err := resolveClusterConfigs(); err != nil {
+		return nil, nil, err
+	}
+	testClusters := make([]store.TestCluster, 0, len(testClusterConfigs))
+	for i := range testClusterConfigs {
+		testCluster, err := createCluster(&testClusterConfigs[i])
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid %s cluster config", testClusterConfigs[i].Name)
+		}
+		testClusters = append(testClusters, store.TestCluster{Name: testClusterConfigs[i].Name, Cluster: testCluster})
+	}
+	if len(oracleClusterConfig.Hosts) == 0 {
+		return testClusters, nil, nil
+	}
+	oracleCluster, err := createCluster(&oracleClusterConfig)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid oracle cluster config")
+	}
+	return testClusters, oracleCluster, nil
+}
+
+// testClusterNames returns the names of the systems under test.
+func testClusterNames() []string {
+	names := make([]string, 0, len(testClusterConfigs))
+	for _, c := range testClusterConfigs {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func createCluster(cfg *cluster.Config) (*gocql.ClusterConfig, error) {
+	c, err := cfg.ClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	if c.PoolConfig.HostSelectionPolicy, err = getHostSelectionPolicy(cfg); err != nil {
+		return nil, err
+	}
+	c.RetryPolicy = &gocql.ExponentialBackoffRetryPolicy{
+		Min:        time.Second,
+		Max:        60 * time.Second,
+		NumRetries: 5,
+	}
+	return c, nil
+}
@@ -31,11 +31,16 @@ func createGenerators(
 	logger *zap.Logger,
 ) []*generators.Generator {
 	partitionRangeConfig := typedef.PartitionRangeConfig{
-		MaxBlobLength:   schemaConfig.MaxBlobLength,
-		MinBlobLength:   schemaConfig.MinBlobLength,
-		MaxStringLength: schemaConfig.MaxStringLength,
-		MinStringLength: schemaConfig.MinStringLength,
-		UseLWT:          schemaConfig.UseLWT,
+		MaxBlobLength:       schemaConfig.MaxBlobLength,
+		MinBlobLength:       schemaConfig.MinBlobLength,
+		MaxStringLength:     schemaConfig.MaxStringLength,
+		MinStringLength:     schemaConfig.MinStringLength,
+		UseLWT:              schemaConfig.UseLWT,
+		CheckWriteTimes:     schemaConfig.CheckWriteTimes,
+		TTLRatio:            schemaConfig.TTLRatio,
+		MaxTTL:              schemaConfig.MaxTTL,
+		ExpiringCollections: schemaConfig.ExpiringCollections,
+		Workload:            schemaConfig.Workload,
 	}
 
 	var gs []*generators.Generator
@@ -0,0 +1,103 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/minimize"
+	"github.com/scylladb/gemini/pkg/reproducer"
+	"github.com/scylladb/gemini/pkg/utils"
+)
+
+var (
+	minimizeJournalFile string
+	minimizeOutFile     string
+	minimizeCheck       int
+)
+
+var minimizeCmd = &cobra.Command{
+	Use:   "minimize",
+	Short: "Shrink the history of a failed validation recorded in a journal.",
+	Long: "Replay subsets of the statements recorded with --journal before a failed validation, " +
+		"and of the tables and columns of the schema, on fresh keyspaces until the smallest one still " +
+		"failing the validation with the same mismatch is found. It is written as a CQL script.",
+	Args:         cobra.NoArgs,
+	RunE:         runMinimize,
+	SilenceUsage: true,
+}
+
+func runMinimize(_ *cobra.Command, _ []string) error {
+	logger := createLogger(level)
+	defer utils.IgnoreError(logger.Sync)
+
+	r, err := journal.Open(minimizeJournalFile)
+	if err != nil {
+		return err
+	}
+	defer utils.IgnoreError(r.Close)
+	schema, err := parseSchema(r.Header.Schema)
+	if err != nil {
+		return errors.Wrap(err, "cannot read the schema of the journal")
+	}
+	history, err := minimize.Load(r, minimizeCheck)
+	if err != nil {
+		return err
+	}
+
+	st, err := createReplayStore(schema, r.Header.UseServerSideTimestamps, logger)
+	if err != nil {
+		return err
+	}
+	defer utils.IgnoreError(st.Close)
+
+	result, err := minimize.New(st, schema, history, logger).Run(context.Background())
+	if err != nil {
+		return err
+	}
+	script := &reproducer.Script{
+		Schema: result.Schema,
+		Comments: []string{
+			fmt.Sprintf("%s mismatch in column %q of row %v, minimized from %d to %d statements in %d trials",
+				result.Mismatch.Kind, result.Mismatch.Column, result.Mismatch.PrimaryKey,
+				len(history.Statements), len(result.Statements), result.Trials),
+		},
+		Mutations:               result.Statements,
+		Query:                   result.Query,
+		UseServerSideTimestamps: r.Header.UseServerSideTimestamps,
+	}
+	if err = script.WriteFile(minimizeOutFile); err != nil {
+		return err
+	}
+	logger.Info("failure minimized", zap.Int("statements", len(result.Statements)),
+		zap.Int("trials", result.Trials), zap.String("script", minimizeOutFile))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(minimizeCmd)
+	flags := minimizeCmd.Flags()
+	flags.StringVarP(&minimizeJournalFile, "journal", "j", "", "Journal file recorded with gemini --journal")
+	_ = minimizeCmd.MarkFlagRequired("journal")
+	flags.IntVarP(&minimizeCheck, "check", "", 1, "Failed validation of the journal to minimize, counting from 1")
+	flags.StringVarP(&minimizeOutFile, "out", "", "minimized.cql", "File the minimized CQL script is written to")
+	addReplayClusterFlags(minimizeCmd)
+}
@@ -0,0 +1,180 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/store"
+	"github.com/scylladb/gemini/pkg/typedef"
+	"github.com/scylladb/gemini/pkg/utils"
+)
+
+var (
+	replayJournalFile string
+	replayFrom        string
+	replayTo          string
+	replayTables      []string
+	replayTokens      []string
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Replay the statements recorded in a journal against a fresh pair of clusters.",
+	Long: "Replay the statements recorded with --journal against a fresh pair of clusters, " +
+		"with the timestamps they were written with. Schema changes are always replayed, " +
+		"the other statements can be selected by time window, table and partition token.",
+	Args:         cobra.NoArgs,
+	RunE:         replay,
+	SilenceUsage: true,
+}
+
+func replay(_ *cobra.Command, _ []string) error {
+	logger := createLogger(level)
+	defer utils.IgnoreError(logger.Sync)
+
+	filter, err := createReplayFilter()
+	if err != nil {
+		return err
+	}
+	r, err := journal.Open(replayJournalFile)
+	if err != nil {
+		return err
+	}
+	defer utils.IgnoreError(r.Close)
+	schema, err := parseSchema(r.Header.Schema)
+	if err != nil {
+		return errors.Wrap(err, "cannot read the schema of the journal")
+	}
+
+	st, err := createReplayStore(schema, r.Header.UseServerSideTimestamps, logger)
+	if err != nil {
+		return err
+	}
+	defer utils.IgnoreError(st.Close)
+
+	var replayed, skipped, failed int
+	for {
+		var e *journal.Entry
+		if e, err = r.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if !filter.Match(e) {
+			skipped++
+			continue
+		}
+		if err = st.Replay(context.Background(), e); err != nil {
+			failed++
+			logger.Error("replay of statement failed", zap.Time("timestamp", e.Time), zap.String("query", e.Query), zap.Error(err))
+			continue
+		}
+		replayed++
+	}
+	fmt.Printf("Replayed %d statements, %d failed, %d not selected\n", replayed, failed, skipped)
+	if failed > 0 {
+		return errors.Errorf("%d statements failed to replay", failed)
+	}
+	return nil
+}
+
+// createReplayStore connects to the fresh clusters journaled statements
+// are replayed on.
+func createReplayStore(schema *typedef.Schema, useServerSideTimestamps bool, logger *zap.Logger) (store.Store, error) {
+	testClusters, oracleCluster, err := createClusters()
+	if err != nil {
+		return nil, err
+	}
+	return store.New(schema, testClusters, oracleCluster, store.Config{
+		MaxRetriesMutate:        maxRetriesMutate,
+		MaxRetriesMutateSleep:   maxRetriesMutateSleep,
+		UseServerSideTimestamps: useServerSideTimestamps,
+		UseModelOracle:          useModelOracle,
+	}, nil, logger)
+}
+
+func createReplayFilter() (*journal.Filter, error) {
+	filter := &journal.Filter{}
+	var err error
+	if replayFrom != "" {
+		if filter.From, err = time.Parse(time.RFC3339Nano, replayFrom); err != nil {
+			return nil, errors.Wrap(err, "invalid --from")
+		}
+	}
+	if replayTo != "" {
+		if filter.To, err = time.Parse(time.RFC3339Nano, replayTo); err != nil {
+			return nil, errors.Wrap(err, "invalid --to")
+		}
+	}
+	if len(replayTables) > 0 {
+		filter.Tables = make(map[string]struct{}, len(replayTables))
+		for _, table := range replayTables {
+			filter.Tables[table] = struct{}{}
+		}
+	}
+	if len(replayTokens) > 0 {
+		filter.Tokens = make(map[uint64]struct{}, len(replayTokens))
+		for _, token := range replayTokens {
+			var t uint64
+			if t, err = strconv.ParseUint(token, 10, 64); err != nil {
+				return nil, errors.Wrapf(err, "invalid --token %s", token)
+			}
+			filter.Tokens[t] = struct{}{}
+		}
+	}
+	return filter, nil
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+	flags := replayCmd.Flags()
+	flags.StringVarP(&replayJournalFile, "journal", "j", "", "Journal file recorded with gemini --journal")
+	_ = replayCmd.MarkFlagRequired("journal")
+	flags.StringVarP(&replayFrom, "from", "", "", "Only replay the statements written at or after this RFC 3339 time")
+	flags.StringVarP(&replayTo, "to", "", "", "Only replay the statements written at or before this RFC 3339 time")
+	flags.StringSliceVarP(&replayTables, "table", "", []string{}, "Only replay the statements writing to these tables")
+	flags.StringSliceVarP(&replayTokens, "token", "", []string{}, "Only replay the statements writing to the partitions of these tokens")
+
+	addReplayClusterFlags(replayCmd)
+}
+
+// addReplayClusterFlags adds the flags of the clusters journaled statements
+// are replayed on to the command.
+func addReplayClusterFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	addClusterFlags(cmd, "test", "t", "Host names or IPs of the test cluster that is system under test, repeat as name=hosts to compare several systems under test")
+	addClusterFlags(cmd, "oracle", "o", "Host names or IPs of the oracle cluster")
+	flags.StringVarP(
+		&clusterConfigFile, "cluster-config", "", "",
+		"JSON config file of the connections to the test and oracle clusters, overridden by the --test-* and --oracle-* flags")
+	flags.BoolVarP(&useModelOracle, "use-model-oracle", "", false, "Replay to an in-memory model instead of an oracle cluster, ignored if --oracle-cluster is set")
+	flags.StringVarP(&consistency, "consistency", "", "QUORUM", "Specify the desired consistency as ANY|ONE|TWO|THREE|QUORUM|LOCAL_QUORUM|EACH_QUORUM|LOCAL_ONE")
+	flags.IntVarP(&maxRetriesMutate, "max-mutation-retries", "", 2, "Maximum number of attempts to apply a statement")
+	flags.DurationVarP(&maxRetriesMutateSleep, "max-mutation-retries-backoff", "", 10*time.Millisecond, "Duration between attempts to apply a statement")
+	flags.DurationVarP(&requestTimeout, "request-timeout", "", 30*time.Second, "Duration of waiting request execution")
+	flags.DurationVarP(&connectTimeout, "connect-timeout", "", 30*time.Second, "Duration of waiting connection established")
+	flags.StringVarP(&level, "level", "", "info", "Specify the logging level, debug|info|warn|error|dpanic|panic|fatal")
+}
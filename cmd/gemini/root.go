@@ -22,20 +22,26 @@ import (
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"text/tabwriter"
 	"time"
 
-	"github.com/scylladb/gemini/pkg/auth"
 	"github.com/scylladb/gemini/pkg/builders"
+	"github.com/scylladb/gemini/pkg/cluster"
 	"github.com/scylladb/gemini/pkg/generators"
 	"github.com/scylladb/gemini/pkg/jobs"
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/ratelimit"
 	"github.com/scylladb/gemini/pkg/replication"
+	"github.com/scylladb/gemini/pkg/reproducer"
 	"github.com/scylladb/gemini/pkg/store"
 	"github.com/scylladb/gemini/pkg/tableopts"
 	"github.com/scylladb/gemini/pkg/typedef"
 	"github.com/scylladb/gemini/pkg/utils"
+	"github.com/scylladb/gemini/pkg/workload"
 
 	"github.com/scylladb/gemini/pkg/status"
 	"github.com/scylladb/gemini/pkg/stop"
@@ -53,13 +59,15 @@ import (
 )
 
 var (
-	testClusterHost                  []string
-	testClusterUsername              string
-	testClusterPassword              string
-	oracleClusterHost                []string
-	oracleClusterUsername            string
-	oracleClusterPassword            string
 	schemaFile                       string
+	comparatorsFile                  string
+	workloadProfileFile              string
+	mutationRate                     float64
+	validationRate                   float64
+	tableMutationRates               []string
+	tableValidationRates             []string
+	loadShape                        string
+	scenarioFile                     string
 	outFileArg                       string
 	concurrency                      uint64
 	seed                             uint64
@@ -94,16 +102,31 @@ var (
 	normalDistMean                   float64
 	normalDistSigma                  float64
 	tracingOutFile                   string
+	traceFailures                    bool
 	useCounters                      bool
 	asyncObjectStabilizationAttempts int
 	asyncObjectStabilizationDelay    time.Duration
 	useLWT                           bool
-	testClusterHostSelectionPolicy   string
-	oracleClusterHostSelectionPolicy string
+	checkWriteTimes                  bool
+	ttlRatio                         float64
+	maxTTL                           time.Duration
 	useServerSideTimestamps          bool
+	useModelOracle                   bool
+	pageSize                         int
+	verifyClusteringOrder            bool
+	resyncTaintedPartitions          bool
+	journalFile                      string
+	reproducerDir                    string
+	tokenRangeSweep                  bool
+	tokenRangeSweepRanges            uint64
 	requestTimeout                   time.Duration
 	connectTimeout                   time.Duration
 	profilingPort                    int
+	clusterConfigFile                string
+	testClusterHosts                 []string
+	testClusterConfig                cluster.Config
+	testClusterConfigs               []cluster.Config
+	oracleClusterConfig              cluster.Config
 )
 
 func interactive() bool {
@@ -115,10 +138,13 @@ func readSchema(confFile string) (*typedef.Schema, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseSchema(byteValue)
+}
 
+func parseSchema(byteValue []byte) (*typedef.Schema, error) {
 	var shm typedef.Schema
 
-	err = json.Unmarshal(byteValue, &shm)
+	err := json.Unmarshal(byteValue, &shm)
 	if err != nil {
 		return nil, err
 	}
@@ -132,6 +158,58 @@ func readSchema(confFile string) (*typedef.Schema, error) {
 	return schemaBuilder.Build(), nil
 }
 
+func readComparatorConfig(confFile string) (*store.ComparatorConfig, error) {
+	byteValue, err := os.ReadFile(confFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg store.ComparatorConfig
+	if err = json.Unmarshal(byteValue, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// parseTableRates parses the rates of the tables given as table=rate, or as
+// a single rate for every table.
+func parseTableRates(values []string) (map[string]float64, error) {
+	rates := make(map[string]float64, len(values))
+	for _, v := range values {
+		table, rate, found := strings.Cut(v, "=")
+		if !found {
+			table, rate = "", v
+		}
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil || r < 0 {
+			return nil, errors.Errorf("invalid rate %q, expected a number of operations per second optionally prefixed with table=", v)
+		}
+		rates[table] = r
+	}
+	return rates, nil
+}
+
+func createJournal(fname string, jsonSchema []byte) (*journal.Writer, error) {
+	return journal.Create(fname, journal.Header{
+		Schema:                  jsonSchema,
+		UseServerSideTimestamps: useServerSideTimestamps,
+	})
+}
+
+func writeReproducers(w *journal.Writer, schema *typedef.Schema, globalStatus *status.GlobalStatus, logger *zap.Logger) {
+	if err := w.Flush(); err != nil {
+		logger.Error("unable to flush the journal, no reproducer written", zap.Error(err))
+		return
+	}
+	n, err := reproducer.Write(reproducerDir, schema, journalFile, globalStatus.Errors.Errors())
+	if err != nil {
+		logger.Error("unable to write reproducers", zap.Error(err))
+	}
+	if n > 0 {
+		logger.Info("reproducers written", zap.Int("count", n), zap.String("directory", reproducerDir))
+	}
+}
+
 type createBuilder struct {
 	stmt string
 }
@@ -145,19 +223,12 @@ func run(_ *cobra.Command, _ []string) error {
 	globalStatus := status.NewGlobalStatus(1000)
 	defer utils.IgnoreError(logger.Sync)
 
-	cons, err := gocql.ParseConsistencyWrapper(consistency)
-	if err != nil {
-		logger.Error("Unable parse consistency, error=%s. Falling back on Quorum", zap.Error(err))
-		cons = gocql.Quorum
-	}
-
-	testHostSelectionPolicy, err := getHostSelectionPolicy(testClusterHostSelectionPolicy, testClusterHost)
+	testClusters, oracleCluster, err := createClusters()
 	if err != nil {
 		return err
 	}
-	oracleHostSelectionPolicy, err := getHostSelectionPolicy(oracleClusterHostSelectionPolicy, oracleClusterHost)
-	if err != nil {
-		return err
+	if len(testClusters) > 1 {
+		globalStatus.SetSystems(testClusterNames())
 	}
 
 	go func() {
@@ -191,6 +262,28 @@ func run(_ *cobra.Command, _ []string) error {
 	if err = schemaConfig.Valid(); err != nil {
 		return errors.Wrap(err, "invalid schema configuration")
 	}
+	rates := jobs.Rates{Mutations: mutationRate, Validations: validationRate}
+	if rates.TableMutations, err = parseTableRates(tableMutationRates); err != nil {
+		return errors.Wrap(err, "invalid table mutation rates")
+	}
+	if rates.TableValidations, err = parseTableRates(tableValidationRates); err != nil {
+		return errors.Wrap(err, "invalid table validation rates")
+	}
+	var shape ratelimit.Shape
+	if loadShape != "" {
+		if shape, err = ratelimit.ParseShape(loadShape); err != nil {
+			return err
+		}
+	}
+	phases, err := createPhases(rates, shape)
+	if err != nil {
+		return err
+	}
+	if workloadProfileFile != "" {
+		if schemaConfig.Workload, err = workload.ReadFile(workloadProfileFile); err != nil {
+			return errors.Wrap(err, "cannot read workload profile")
+		}
+	}
 	var schema *typedef.Schema
 	if len(schemaFile) > 0 {
 		schema, err = readSchema(schemaFile)
@@ -204,11 +297,42 @@ func run(_ *cobra.Command, _ []string) error {
 	jsonSchema, _ := json.MarshalIndent(schema, "", "    ")
 	fmt.Printf("Schema: %v\n", string(jsonSchema))
 
-	testCluster, oracleCluster := createClusters(cons, testHostSelectionPolicy, oracleHostSelectionPolicy, logger)
 	storeConfig := store.Config{
 		MaxRetriesMutate:        maxRetriesMutate,
 		MaxRetriesMutateSleep:   maxRetriesMutateSleep,
 		UseServerSideTimestamps: useServerSideTimestamps,
+		UseModelOracle:          useModelOracle,
+		PageSize:                pageSize,
+		VerifyClusteringOrder:   verifyClusteringOrder,
+		ExpiringWrites:          schemaConfig.TTLRatio > 0,
+		ExpiringCollections:     schemaConfig.ExpiringCollections,
+		TraceFailures:           traceFailures,
+	}
+	if len(comparatorsFile) > 0 {
+		if storeConfig.Comparators, err = readComparatorConfig(comparatorsFile); err != nil {
+			return errors.Wrap(err, "cannot read comparators config")
+		}
+	}
+	if reproducerDir != "" {
+		if err = os.MkdirAll(reproducerDir, 0o755); err != nil {
+			return errors.Wrap(err, "cannot create reproducer directory")
+		}
+		// The reproducers are made of the journaled mutations.
+		if journalFile == "" {
+			journalFile = filepath.Join(reproducerDir, "journal")
+		}
+	}
+	if journalFile != "" {
+		var w *journal.Writer
+		if w, err = createJournal(journalFile, jsonSchema); err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := w.Close(); closeErr != nil {
+				logger.Error("unable to close the journal", zap.Error(closeErr))
+			}
+		}()
+		storeConfig.Journal = w
 	}
 	var tracingFile *os.File
 	if tracingOutFile != "" {
@@ -226,16 +350,17 @@ func run(_ *cobra.Command, _ []string) error {
 			defer utils.IgnoreError(tracingFile.Sync)
 		}
 	}
-	st, err := store.New(schema, testCluster, oracleCluster, storeConfig, tracingFile, logger)
+	st, err := store.New(schema, testClusters, oracleCluster, storeConfig, tracingFile, logger)
 	if err != nil {
 		return err
 	}
 	defer utils.IgnoreError(st.Close)
 
-	if dropSchema && mode != jobs.ReadMode {
+	schemaCtx := store.WithTarget(context.Background(), store.Target{Schema: true})
+	if dropSchema && !readOnly(phases) {
 		for _, stmt := range generators.GetDropSchema(schema) {
 			logger.Debug(stmt)
-			if err = st.Mutate(context.Background(), createBuilder{stmt: stmt}); err != nil {
+			if err = st.Mutate(schemaCtx, createBuilder{stmt: stmt}); err != nil && !errors.Is(err, store.ErrOracleMutation) {
 				return errors.Wrap(err, "unable to drop schema")
 			}
 		}
@@ -248,16 +373,22 @@ func run(_ *cobra.Command, _ []string) error {
 
 	for _, stmt := range generators.GetCreateSchema(schema) {
 		logger.Debug(stmt)
-		if err = st.Mutate(context.Background(), createBuilder{stmt: stmt}); err != nil {
+		if err = st.Mutate(schemaCtx, createBuilder{stmt: stmt}); err != nil && !errors.Is(err, store.ErrOracleMutation) {
 			return errors.Wrap(err, "unable to create schema")
 		}
 	}
 
-	ctx, done := context.WithTimeout(context.Background(), duration+warmup+time.Second*2)
-	warmupStopFlag := stop.NewFlag()
-	workStopFlag := stop.NewFlag()
-	stop.StartOsSignalsTransmitter(logger, &warmupStopFlag, &workStopFlag)
-	pump := jobs.NewPump(ctx, logger)
+	// Each phase bounds its own duration, the sweeps are not bounded.
+	ctx, done := context.WithCancel(context.Background())
+	defer done()
+	// The last flag stops the final sweep.
+	stopFlags := make([]*stop.Flag, len(phases)+1)
+	for i := range stopFlags {
+		f := stop.NewFlag()
+		stopFlags[i] = &f
+	}
+	stop.StartOsSignalsTransmitter(logger, stopFlags...)
+	var pacer atomic.Pointer[jobs.Pacer]
 
 	generators := createGenerators(ctx, schema, schemaConfig, distFunc, concurrency, partitionCount, logger)
 
@@ -266,35 +397,50 @@ func run(_ *cobra.Command, _ []string) error {
 		ticker := time.NewTicker(time.Second)
 		go func() {
 			defer done()
+			var meter status.Meter
 			for {
 				select {
 				case <-ctx.Done():
 					return
-				case <-ticker.C:
-					sp.Set(" Running Gemini... %v", globalStatus)
+				case now := <-ticker.C:
+					writeRate, readRate := meter.Update(globalStatus, now)
+					writeTarget, readTarget := pacer.Load().Targets()
+					sp.Set(" Running Gemini... %v | write rate: %s | read rate: %s", globalStatus,
+						status.FormatRate(writeRate, writeTarget), status.FormatRate(readRate, readTarget))
 				}
 			}
 		}()
 	}
 
-	if warmup > 0 && !warmupStopFlag.IsHardOrSoft() {
-		jobsList := jobs.ListFromMode(jobs.WarmupMode, warmup, concurrency)
-		if err = jobsList.Run(ctx, schema, schemaConfig, st, pump, generators, globalStatus, logger, seed, &warmupStopFlag, failFast, verbose); err != nil {
-			logger.Error("warmup encountered an error", zap.Error(err))
-		}
-	}
-
-	select {
-	case <-ctx.Done():
-	default:
-		if workStopFlag.IsHardOrSoft() {
+	runner := phaseRunner{
+		schema:       schema,
+		store:        st,
+		globalStatus: globalStatus,
+		logger:       logger,
+		shape:        shape,
+		pacer:        &pacer,
+		generators:   generators,
+		rates:        rates,
+		schemaConfig: schemaConfig,
+		record:       scenarioFile != "",
+	}
+	for i := range phases {
+		if runner.failed() {
+			logger.Info("skipping the phases left after a failure", zap.Int("phases", len(phases)-i))
 			break
 		}
-		jobsList := jobs.ListFromMode(mode, duration, concurrency)
-		if err = jobsList.Run(ctx, schema, schemaConfig, st, pump, generators, globalStatus, logger, seed, &workStopFlag, failFast, verbose); err != nil {
-			logger.Debug("error detected", zap.Error(err))
-		}
-
+		runner.run(ctx, &phases[i], stopFlags[i])
+	}
+	sweepStopFlag := stopFlags[len(phases)]
+	if resyncTaintedPartitions && !sweepStopFlag.IsHardOrSoft() && !runner.failed() {
+		jobs.ResyncTainted(ctx, schema, st, generators, globalStatus, logger)
+	}
+	if tokenRangeSweep && !sweepStopFlag.IsHardOrSoft() && !runner.failed() {
+		jobs.Sweep(ctx, schema, st, generators, tokenRangeSweepRanges, concurrency, globalStatus, logger, sweepStopFlag)
+	}
+	jobs.ReportTainted(schema, generators, globalStatus)
+	if reproducerDir != "" {
+		writeReproducers(storeConfig.Journal, schema, globalStatus, logger)
 	}
 	logger.Info("test finished")
 	globalStatus.PrintResult(outFile, schema, version)
@@ -360,44 +506,6 @@ func createLogger(level string) *zap.Logger {
 	return logger
 }
 
-func createClusters(
-	consistency gocql.Consistency,
-	testHostSelectionPolicy, oracleHostSelectionPolicy gocql.HostSelectionPolicy,
-	logger *zap.Logger,
-) (*gocql.ClusterConfig, *gocql.ClusterConfig) {
-	retryPolicy := &gocql.ExponentialBackoffRetryPolicy{
-		Min:        time.Second,
-		Max:        60 * time.Second,
-		NumRetries: 5,
-	}
-	testCluster := gocql.NewCluster(testClusterHost...)
-	testCluster.Timeout = requestTimeout
-	testCluster.ConnectTimeout = connectTimeout
-	testCluster.RetryPolicy = retryPolicy
-	testCluster.Consistency = consistency
-	testCluster.PoolConfig.HostSelectionPolicy = testHostSelectionPolicy
-	testAuthenticator, testAuthErr := auth.BuildAuthenticator(testClusterUsername, testClusterPassword)
-	if testAuthErr != nil {
-		logger.Warn("%s for test cluster", zap.Error(testAuthErr))
-	}
-	testCluster.Authenticator = testAuthenticator
-	if len(oracleClusterHost) == 0 {
-		return testCluster, nil
-	}
-	oracleCluster := gocql.NewCluster(oracleClusterHost...)
-	testCluster.Timeout = requestTimeout
-	testCluster.ConnectTimeout = connectTimeout
-	oracleCluster.RetryPolicy = retryPolicy
-	oracleCluster.Consistency = consistency
-	oracleCluster.PoolConfig.HostSelectionPolicy = oracleHostSelectionPolicy
-	oracleAuthenticator, oracleAuthErr := auth.BuildAuthenticator(oracleClusterUsername, oracleClusterPassword)
-	if oracleAuthErr != nil {
-		logger.Warn("%s for oracle cluster", zap.Error(oracleAuthErr))
-	}
-	oracleCluster.Authenticator = oracleAuthenticator
-	return testCluster, oracleCluster
-}
-
 func createTableOptions(tableOptionStrings []string, logger *zap.Logger) []tableopts.Option {
 	var tableOptions []tableopts.Option
 	for _, optionString := range tableOptionStrings {
@@ -438,17 +546,41 @@ func getCQLFeature(feature string) typedef.CQLFeature {
 	}
 }
 
-func getHostSelectionPolicy(policy string, hosts []string) (gocql.HostSelectionPolicy, error) {
-	switch policy {
+// getHostSelectionPolicy returns the host selection policy of a cluster.
+// The dc-aware policies require the local datacenter of the cluster, and
+// only fall back to replicas of the other datacenters if it is allowed to.
+func getHostSelectionPolicy(cfg *cluster.Config) (gocql.HostSelectionPolicy, error) {
+	var policy gocql.HostSelectionPolicy
+	switch cfg.HostSelectionPolicy {
 	case "round-robin":
-		return gocql.RoundRobinHostPolicy(), nil
+		policy = gocql.RoundRobinHostPolicy()
 	case "host-pool":
-		return gocql.HostPoolHostPolicy(hostpool.New(hosts)), nil
+		policy = gocql.HostPoolHostPolicy(hostpool.New(cfg.Hosts))
 	case "token-aware":
-		return gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy()), nil
+		policy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+	case "dc-aware", "token-aware(dc-aware)":
+		if cfg.LocalDC == "" {
+			return nil, fmt.Errorf("host selection policy \"%s\" requires a local datacenter", cfg.HostSelectionPolicy)
+		}
+		policy = gocql.DCAwareRoundRobinPolicy(cfg.LocalDC)
+		if cfg.HostSelectionPolicy == "dc-aware" {
+			break
+		}
+		if cfg.RemoteFallback {
+			policy = gocql.TokenAwareHostPolicy(policy, gocql.NonLocalReplicasFallback())
+		} else {
+			policy = gocql.TokenAwareHostPolicy(policy)
+		}
 	default:
-		return nil, fmt.Errorf("unknown host selection policy \"%s\"", policy)
+		return nil, fmt.Errorf("unknown host selection policy \"%s\"", cfg.HostSelectionPolicy)
+	}
+	if cfg.TokenRouting {
+		if !strings.HasPrefix(cfg.HostSelectionPolicy, "token-aware") {
+			return nil, fmt.Errorf("token routing requires a token-aware host selection policy, got \"%s\"", cfg.HostSelectionPolicy)
+		}
+		policy = cluster.TokenRoutingPolicy(policy)
 	}
+	return policy, nil
 }
 
 var rootCmd = &cobra.Command{
@@ -460,18 +592,42 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	rootCmd.Version = version + ", commit " + commit + ", date " + date
-	rootCmd.Flags().StringSliceVarP(&testClusterHost, "test-cluster", "t", []string{}, "Host names or IPs of the test cluster that is system under test")
-	_ = rootCmd.MarkFlagRequired("test-cluster")
-	rootCmd.Flags().StringVarP(&testClusterUsername, "test-username", "", "", "Username for the test cluster")
-	rootCmd.Flags().StringVarP(&testClusterPassword, "test-password", "", "", "Password for the test cluster")
-	rootCmd.Flags().StringSliceVarP(
-		&oracleClusterHost, "oracle-cluster", "o", []string{},
+	addClusterFlags(rootCmd, "test", "t", "Host names or IPs of the test cluster that is system under test, repeat as name=hosts to compare several systems under test")
+	addClusterFlags(
+		rootCmd, "oracle", "o",
 		"Host names or IPs of the oracle cluster that provides correct answers. If omitted no oracle will be used")
-	rootCmd.Flags().StringVarP(&oracleClusterUsername, "oracle-username", "", "", "Username for the oracle cluster")
-	rootCmd.Flags().StringVarP(&oracleClusterPassword, "oracle-password", "", "", "Password for the oracle cluster")
+	rootCmd.Flags().StringVarP(
+		&clusterConfigFile, "cluster-config", "", "",
+		"JSON config file of the connections to the test and oracle clusters, overridden by the --test-* and --oracle-* flags")
 	rootCmd.Flags().StringVarP(&schemaFile, "schema", "", "", "Schema JSON config file")
+	rootCmd.Flags().StringVarP(
+		&comparatorsFile, "comparators", "", "",
+		"JSON config file relaxing how values are compared between the clusters, for example float tolerances or ignored columns")
+	rootCmd.Flags().StringVarP(
+		&scenarioFile, "scenario", "", "",
+		"YAML or JSON file of the phases of the run, each with its mode, duration, concurrency, rates and workload, "+
+			"replacing --mode, --duration and --warmup")
+	rootCmd.Flags().StringVarP(
+		&workloadProfileFile, "workload-profile", "", "",
+		"YAML or JSON file weighting the kinds of mutations, validation queries and schema changes the jobs generate")
 	rootCmd.Flags().StringVarP(&mode, "mode", "m", jobs.MixedMode, "Query operation mode. Mode options: write, read, mixed (default)")
 	rootCmd.Flags().Uint64VarP(&concurrency, "concurrency", "c", 10, "Number of threads per table to run concurrently")
+	rootCmd.Flags().Float64VarP(
+		&mutationRate, "mutation-rate", "", 0,
+		"Target number of mutations per second of all the tables together, 0 for no limit")
+	rootCmd.Flags().Float64VarP(
+		&validationRate, "validation-rate", "", 0,
+		"Target number of validations per second of all the tables together, 0 for no limit")
+	rootCmd.Flags().StringArrayVarP(
+		&tableMutationRates, "table-mutation-rate", "", []string{},
+		"Repeatable target number of mutations per second of each table, as table=rate or as a rate of every table")
+	rootCmd.Flags().StringArrayVarP(
+		&tableValidationRates, "table-validation-rate", "", []string{},
+		"Repeatable target number of validations per second of each table, as table=rate or as a rate of every table")
+	rootCmd.Flags().StringVarP(
+		&loadShape, "load-shape", "", "",
+		"Shape of the target rates over time, such as ramp:from=0.1,to=1,duration=10m, burst:factor=3,every=1m,for=10s, "+
+			"sine:amplitude=0.5,period=10m or step:5m=0.5,5m=1,repeat=true")
 	rootCmd.Flags().Uint64VarP(&seed, "seed", "s", 1, "PRNG seed value")
 	rootCmd.Flags().BoolVarP(&dropSchema, "drop-schema", "d", false, "Drop schema before starting tests run")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output during test run")
@@ -490,7 +646,7 @@ func init() {
 		"Specify the desired replication strategy of the oracle cluster as either the coded short hand simple|network to get the default for each "+
 			"type or provide the entire specification in the form {'class':'....'}")
 	rootCmd.Flags().StringArrayVarP(&tableOptions, "table-options", "", []string{}, "Repeatable argument to set table options to be added to the created tables")
-	rootCmd.Flags().StringVarP(&consistency, "consistency", "", "QUORUM", "Specify the desired consistency as ANY|ONE|TWO|THREE|QUORUM|LOCAL_QUORUM|EACH_QUORUM|LOCAL_ONE")
+	rootCmd.Flags().StringVarP(&consistency, "consistency", "", "QUORUM", "Specify the desired consistency on both clusters as ANY|ONE|TWO|THREE|QUORUM|LOCAL_QUORUM|EACH_QUORUM|LOCAL_ONE")
 	rootCmd.Flags().IntVarP(&maxTables, "max-tables", "", 1, "Maximum number of generated tables")
 	rootCmd.Flags().IntVarP(&maxPartitionKeys, "max-partition-keys", "", 6, "Maximum number of generated partition keys")
 	rootCmd.Flags().IntVarP(&minPartitionKeys, "min-partition-keys", "", 2, "Minimum number of generated partition keys")
@@ -515,6 +671,9 @@ func init() {
 	rootCmd.Flags().StringVarP(
 		&tracingOutFile, "tracing-outfile", "", "",
 		"Specify the file to which tracing information gets written. Two magic names are available, 'stdout' and 'stderr'. By default tracing is disabled.")
+	rootCmd.Flags().BoolVarP(
+		&traceFailures, "trace-failures", "", false,
+		"Run failed mutations and validations with mismatches again with tracing on all clusters and attach the traces to the errors")
 	rootCmd.Flags().BoolVarP(&useCounters, "use-counters", "", false, "Ensure that at least one table is a counter table")
 	rootCmd.Flags().IntVarP(
 		&asyncObjectStabilizationAttempts, "async-objects-stabilization-attempts", "", 10,
@@ -523,15 +682,40 @@ func init() {
 		&asyncObjectStabilizationDelay, "async-objects-stabilization-backoff", "", 10*time.Millisecond,
 		"Duration between attempts to validate result sets from MV and SI for example 10ms or 1s")
 	rootCmd.Flags().BoolVarP(&useLWT, "use-lwt", "", false, "Emit LWT based updates")
+	rootCmd.Flags().BoolVarP(
+		&checkWriteTimes, "check-writetime", "", false,
+		"Also compare WRITETIME and TTL of regular columns in validation queries, ignored with --use-server-timestamps and --use-lwt")
+	rootCmd.Flags().Float64VarP(
+		&ttlRatio, "ttl-ratio", "", 0,
+		"Fraction of the inserts and updates written with a TTL, between 0 and 1, of tables without counters or non-frozen collections")
+	rootCmd.Flags().DurationVarP(
+		&maxTTL, "max-ttl", "", time.Minute,
+		"Maximum TTL of the writes with a TTL, the TTLs are drawn from 1s up to it with short ones as likely as long ones")
+	rootCmd.Flags().BoolVarP(&useServerSideTimestamps, "use-server-timestamps", "", false, "Use server-side generated timestamps for writes")
+	rootCmd.Flags().BoolVarP(
+		&useModelOracle, "use-model-oracle", "", false,
+		"Validate the test cluster against an in-memory model instead of an oracle cluster, ignored if --oracle-cluster is set")
+	rootCmd.Flags().IntVarP(&pageSize, "page-size", "", 5000, "Number of rows fetched per page by validation queries on both clusters")
+	rootCmd.Flags().BoolVarP(
+		&verifyClusteringOrder, "verify-clustering-order", "", false,
+		"Check that both clusters return the rows of primary key queries in primary key order instead of only comparing them")
+	rootCmd.Flags().BoolVarP(
+		&resyncTaintedPartitions, "resync-tainted-partitions", "", false,
+		"Re-synchronize partitions left different by failed mutations from the oracle before validating them instead of skipping them")
 	rootCmd.Flags().StringVarP(
-		&oracleClusterHostSelectionPolicy, "oracle-host-selection-policy", "", "round-robin",
-		"Host selection policy used by the driver for the oracle cluster: round-robin|host-pool|token-aware")
+		&journalFile, "journal", "", "",
+		"File every statement applied to the clusters is recorded in, so that the run can be replayed with 'gemini replay'")
 	rootCmd.Flags().StringVarP(
-		&testClusterHostSelectionPolicy, "test-host-selection-policy", "", "round-robin",
-		"Host selection policy used by the driver for the test cluster: round-robin|host-pool|token-aware")
-	rootCmd.Flags().BoolVarP(&useServerSideTimestamps, "use-server-timestamps", "", false, "Use server-side generated timestamps for writes")
-	rootCmd.Flags().DurationVarP(&requestTimeout, "request-timeout", "", 30*time.Second, "Duration of waiting request execution")
-	rootCmd.Flags().DurationVarP(&connectTimeout, "connect-timeout", "", 30*time.Second, "Duration of waiting connection established")
+		&reproducerDir, "reproducer-dir", "", "",
+		"Directory a CQL script reproducing each validation failure with cqlsh is written to")
+	rootCmd.Flags().BoolVarP(
+		&tokenRangeSweep, "token-range-sweep", "", false,
+		"Compare every row of every table and view between the clusters at the end of the run, requires an oracle")
+	rootCmd.Flags().Uint64VarP(
+		&tokenRangeSweepRanges, "token-range-sweep-ranges", "", 256,
+		"Number of token ranges the token ring is split into by the token range sweep")
+	rootCmd.Flags().DurationVarP(&requestTimeout, "request-timeout", "", 30*time.Second, "Duration of waiting request execution on both clusters")
+	rootCmd.Flags().DurationVarP(&connectTimeout, "connect-timeout", "", 30*time.Second, "Duration of waiting connection established to both clusters")
 	rootCmd.Flags().IntVarP(&profilingPort, "profiling-port", "", 0, "If non-zero starts pprof profiler on given port at 'http://0.0.0.0:<port>/profile'")
 	rootCmd.Flags().IntVarP(&maxErrorsToStore, "max-errors-to-store", "", 1000, "Maximum number of errors to store and output at the end")
 }
@@ -541,11 +725,21 @@ func printSetup() error {
 	tw.Init(os.Stdout, 0, 8, 2, '\t', tabwriter.AlignRight)
 	rand.Seed(seed)
 	fmt.Fprintf(tw, "Seed:\t%d\n", seed)
-	fmt.Fprintf(tw, "Maximum duration:\t%s\n", duration)
-	fmt.Fprintf(tw, "Warmup duration:\t%s\n", warmup)
+	if scenarioFile != "" {
+		fmt.Fprintf(tw, "Scenario:\t%s\n", scenarioFile)
+	} else {
+		fmt.Fprintf(tw, "Maximum duration:\t%s\n", duration)
+		fmt.Fprintf(tw, "Warmup duration:\t%s\n", warmup)
+	}
 	fmt.Fprintf(tw, "Concurrency:\t%d\n", concurrency)
-	fmt.Fprintf(tw, "Test cluster:\t%s\n", testClusterHost)
-	fmt.Fprintf(tw, "Oracle cluster:\t%s\n", oracleClusterHost)
+	for _, c := range testClusterConfigs {
+		fmt.Fprintf(tw, "Test cluster %s:\t%s\n", c.Name, c.Hosts)
+	}
+	if modelOracle() {
+		fmt.Fprintf(tw, "Oracle cluster:\t%s\n", "<model>")
+	} else {
+		fmt.Fprintf(tw, "Oracle cluster:\t%s\n", oracleClusterConfig.Hosts)
+	}
 	if outFileArg == "" {
 		fmt.Fprintf(tw, "Output file:\t%s\n", "<stdout>")
 	} else {
@@ -0,0 +1,183 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/jobs"
+	"github.com/scylladb/gemini/pkg/ratelimit"
+	"github.com/scylladb/gemini/pkg/scenario"
+	"github.com/scylladb/gemini/pkg/status"
+	"github.com/scylladb/gemini/pkg/stop"
+	"github.com/scylladb/gemini/pkg/store"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// createPhases returns the phases of the scenario file, or the warmup and
+// the work cycle of the flags without one. The token range sweeps, of the
+// phases or of --token-range-sweep, are rejected without an oracle.
+func createPhases(rates jobs.Rates, shape ratelimit.Shape) ([]scenario.Phase, error) {
+	if tokenRangeSweep && !hasOracle() {
+		return nil, errors.New("--token-range-sweep requires an oracle, set --oracle-cluster or --use-model-oracle")
+	}
+	var phases []scenario.Phase
+	if scenarioFile != "" {
+		s, err := scenario.ReadFile(scenarioFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read scenario")
+		}
+		phases = s.Phases
+	} else {
+		if warmup > 0 {
+			phases = append(phases, scenario.Phase{Name: jobs.WarmupMode, Mode: jobs.WarmupMode, Duration: warmup})
+		}
+		phases = append(phases, scenario.Phase{Name: mode, Mode: mode, Duration: duration})
+	}
+	for i := range phases {
+		p := &phases[i]
+		if p.Mode == scenario.SweepMode {
+			if !hasOracle() {
+				return nil, errors.Errorf("phase %s: the token range sweep requires an oracle", p.Name)
+			}
+			continue
+		}
+		if phaseShape(p, shape) != nil && !phaseRates(p, rates).Limited() {
+			return nil, errors.Errorf("phase %s: a load shape requires a target rate", p.Name)
+		}
+	}
+	return phases, nil
+}
+
+// hasOracle reports whether the test clusters are validated against an
+// oracle cluster or the model.
+func hasOracle() bool {
+	return len(oracleClusterConfig.Hosts) > 0 || useModelOracle
+}
+
+// modelOracle reports whether the test clusters are validated against the
+// model instead of an oracle cluster.
+func modelOracle() bool {
+	return len(oracleClusterConfig.Hosts) == 0 && useModelOracle
+}
+
+// readOnly reports whether none of the phases writes.
+func readOnly(phases []scenario.Phase) bool {
+	for _, p := range phases {
+		if p.Mode != jobs.ReadMode && p.Mode != scenario.SweepMode {
+			return false
+		}
+	}
+	return true
+}
+
+func phaseRates(p *scenario.Phase, rates jobs.Rates) jobs.Rates {
+	if p.MutationRate != nil {
+		rates.Mutations = *p.MutationRate
+	}
+	if p.ValidationRate != nil {
+		rates.Validations = *p.ValidationRate
+	}
+	if p.TableMutationRates != nil {
+		rates.TableMutations = p.TableMutationRates
+	}
+	if p.TableValidationRates != nil {
+		rates.TableValidations = p.TableValidationRates
+	}
+	return rates
+}
+
+func phaseShape(p *scenario.Phase, shape ratelimit.Shape) ratelimit.Shape {
+	if p.Shape != nil {
+		return p.Shape
+	}
+	return shape
+}
+
+// phaseRunner runs the phases of a scenario one after the other.
+type phaseRunner struct {
+	schema       *typedef.Schema
+	store        store.Store
+	globalStatus *status.GlobalStatus
+	logger       *zap.Logger
+	shape        ratelimit.Shape
+	// pacer is the pacer of the running phase, for the status line.
+	pacer        *atomic.Pointer[jobs.Pacer]
+	generators   []*generators.Generator
+	rates        jobs.Rates
+	schemaConfig typedef.SchemaConfig
+	// record reports the statistics of each phase in the result.
+	record bool
+}
+
+// failed reports whether the run stops at the first failure and one was
+// found, the phases left are skipped then.
+func (r *phaseRunner) failed() bool {
+	return failFast && r.globalStatus.HasErrors()
+}
+
+func (r *phaseRunner) run(ctx context.Context, p *scenario.Phase, stopFlag *stop.Flag) {
+	if stopFlag.IsHardOrSoft() || ctx.Err() != nil {
+		return
+	}
+	gs := r.globalStatus
+	writeOps, writeErrors, readOps, readErrors := gs.WriteOps.Load(), gs.WriteErrors.Load(), gs.ReadOps.Load(), gs.ReadErrors.Load()
+	workers := concurrency
+	if p.Concurrency > 0 {
+		workers = p.Concurrency
+	}
+	logger := r.logger.With(zap.String("phase", p.Name))
+	logger.Info("starting phase", zap.String("mode", p.Mode), zap.Duration("duration", p.Duration), zap.Uint64("concurrency", workers))
+	start := time.Now()
+	if p.Mode == scenario.SweepMode {
+		if resyncTaintedPartitions {
+			jobs.ResyncTainted(ctx, r.schema, r.store, r.generators, gs, logger)
+		}
+		jobs.Sweep(ctx, r.schema, r.store, r.generators, tokenRangeSweepRanges, workers, gs, logger, stopFlag)
+	} else {
+		pCtx, cancel := context.WithTimeout(ctx, p.Duration+time.Second*2)
+		defer cancel()
+		pacer := jobs.NewPacer(r.schema, phaseRates(p, r.rates))
+		pacer.Shape(pCtx, phaseShape(p, r.shape))
+		r.pacer.Store(pacer)
+		schemaConfig := r.schemaConfig
+		if p.Workload != nil {
+			schemaConfig.Workload = p.Workload
+		}
+		jobsList := jobs.ListFromMode(p.Mode, p.Duration, workers)
+		if err := jobsList.Run(pCtx, r.schema, schemaConfig, r.store, pacer, r.generators, gs, logger, seed, stopFlag, failFast, verbose); err != nil {
+			logger.Debug("error detected", zap.Error(err))
+		}
+	}
+	elapsed := time.Since(start).Round(time.Millisecond)
+	logger.Info("phase finished", zap.Duration("elapsed", elapsed))
+	if r.record {
+		gs.Phases = append(gs.Phases, status.PhaseResult{
+			Name:        p.Name,
+			Mode:        p.Mode,
+			Elapsed:     elapsed.String(),
+			WriteOps:    gs.WriteOps.Load() - writeOps,
+			WriteErrors: gs.WriteErrors.Load() - writeErrors,
+			ReadOps:     gs.ReadOps.Load() - readOps,
+			ReadErrors:  gs.ReadErrors.Load() - readErrors,
+		})
+	}
+}
@@ -31,6 +31,7 @@ func createSchemaConfig(logger *zap.Logger) typedef.SchemaConfig {
 			ReplicationStrategy:              defaultConfig.ReplicationStrategy,
 			OracleReplicationStrategy:        defaultConfig.OracleReplicationStrategy,
 			TableOptions:                     defaultConfig.TableOptions,
+			Workload:                         defaultConfig.Workload,
 			MaxTables:                        defaultConfig.MaxTables,
 			MaxPartitionKeys:                 defaultConfig.MaxPartitionKeys,
 			MinPartitionKeys:                 defaultConfig.MinPartitionKeys,
@@ -44,6 +45,11 @@ func createSchemaConfig(logger *zap.Logger) typedef.SchemaConfig {
 			MaxStringLength:                  20,
 			UseCounters:                      defaultConfig.UseCounters,
 			UseLWT:                           defaultConfig.UseLWT,
+			CheckWriteTimes:                  defaultConfig.CheckWriteTimes,
+			TTLRatio:                         defaultConfig.TTLRatio,
+			MaxTTL:                           defaultConfig.MaxTTL,
+			ExpiringCollections:              defaultConfig.ExpiringCollections,
+			ResyncTaintedPartitions:          defaultConfig.ResyncTaintedPartitions,
 			CQLFeature:                       defaultConfig.CQLFeature,
 			AsyncObjectStabilizationAttempts: defaultConfig.AsyncObjectStabilizationAttempts,
 			AsyncObjectStabilizationDelay:    defaultConfig.AsyncObjectStabilizationDelay,
@@ -83,6 +89,11 @@ func createDefaultSchemaConfig(logger *zap.Logger) typedef.SchemaConfig {
 		MinStringLength:                  MinStringLength,
 		UseCounters:                      useCounters,
 		UseLWT:                           useLWT,
+		CheckWriteTimes:                  checkWriteTimes && !useServerSideTimestamps && !useLWT,
+		TTLRatio:                         ttlRatio,
+		MaxTTL:                           maxTTL,
+		ExpiringCollections:              !modelOracle(),
+		ResyncTaintedPartitions:          resyncTaintedPartitions,
 		CQLFeature:                       getCQLFeature(cqlFeatures),
 		AsyncObjectStabilizationAttempts: asyncObjectStabilizationAttempts,
 		AsyncObjectStabilizationDelay:    asyncObjectStabilizationDelay,
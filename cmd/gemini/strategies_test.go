@@ -22,6 +22,7 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"go.uber.org/zap"
 
+	"github.com/scylladb/gemini/pkg/cluster"
 	"github.com/scylladb/gemini/pkg/replication"
 	"github.com/scylladb/gemini/pkg/typedef"
 )
@@ -86,3 +87,58 @@ func TestReadSchema(t *testing.T) {
 		t.Errorf("schema not the same after marshal/unmarshal, diff=%s", diff)
 	}
 }
+
+func TestGetHostSelectionPolicy(t *testing.T) {
+	tests := map[string]struct {
+		cfg cluster.Config
+		err bool
+	}{
+		"round robin":                    {cfg: cluster.Config{HostSelectionPolicy: "round-robin"}},
+		"dc aware":                       {cfg: cluster.Config{HostSelectionPolicy: "dc-aware", LocalDC: "dc1"}},
+		"dc aware without datacenter":    {cfg: cluster.Config{HostSelectionPolicy: "dc-aware"}, err: true},
+		"token aware dc aware":           {cfg: cluster.Config{HostSelectionPolicy: "token-aware(dc-aware)", LocalDC: "dc1", RemoteFallback: true}},
+		"token routing":                  {cfg: cluster.Config{HostSelectionPolicy: "token-aware", TokenRouting: true}},
+		"token routing without replicas": {cfg: cluster.Config{HostSelectionPolicy: "dc-aware", LocalDC: "dc1", TokenRouting: true}, err: true},
+		"unknown":                        {cfg: cluster.Config{HostSelectionPolicy: "closest"}, err: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			policy, err := getHostSelectionPolicy(&tc.cfg)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error=%t, got %v", tc.err, err)
+			}
+			if !tc.err && policy == nil {
+				t.Error("expected a policy")
+			}
+		})
+	}
+}
+
+func TestParseTestClusters(t *testing.T) {
+	tests := map[string]struct {
+		args     []string
+		expected []cluster.Config
+		err      bool
+	}{
+		"none":         {},
+		"single":       {args: []string{"h1,h2", "h3"}, expected: []cluster.Config{{Hosts: []string{"h1", "h2", "h3"}}}},
+		"named":        {args: []string{"scylla=h1,h2", "cassandra=h3"}, expected: []cluster.Config{{Name: "scylla", Hosts: []string{"h1", "h2"}}, {Name: "cassandra", Hosts: []string{"h3"}}}},
+		"mixed":        {args: []string{"scylla=h1", "h2"}, err: true},
+		"twice":        {args: []string{"scylla=h1", "scylla=h2"}, err: true},
+		"oracle":       {args: []string{"oracle=h1"}, err: true},
+		"without name": {args: []string{"=h1"}, err: true},
+	}
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			got, err := parseTestClusters(tc.args)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected error=%t, got %v", tc.err, err)
+			}
+			if diff := cmp.Diff(tc.expected, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
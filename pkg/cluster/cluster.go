@@ -0,0 +1,243 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cluster holds the connection configuration of the clusters gemini
+// connects to and builds the driver configuration from it.
+package cluster
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pkg/errors"
+
+	"github.com/scylladb/gemini/pkg/auth"
+)
+
+// TLSConfig is the TLS configuration of the connections to a cluster. TLS
+// is enabled as soon as any of its files is set.
+type TLSConfig struct {
+	// CAFile is the PEM file of the certificate authorities the certificates
+	// of the nodes are verified with.
+	CAFile string `json:"ca_file"`
+	// CertFile and KeyFile are the PEM files of the client certificate and
+	// of its private key, both must be set to authenticate with it.
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// EnableHostVerification verifies that the certificate of a node
+	// matches its address.
+	EnableHostVerification bool `json:"enable_host_verification"`
+}
+
+// Enabled reports whether the connections use TLS.
+func (c TLSConfig) Enabled() bool {
+	return c.CAFile != "" || c.CertFile != "" || c.KeyFile != ""
+}
+
+// Config is the connection configuration of a cluster. Zero values are
+// left to the defaults given to Merge and then to the driver.
+type Config struct {
+	TLS TLSConfig `json:"tls"`
+	// Name is the name of a system under test, when there are several.
+	Name                string        `json:"name"`
+	Username            string        `json:"username"`
+	Password            string        `json:"password"`
+	Consistency         string        `json:"consistency"`
+	SerialConsistency   string        `json:"serial_consistency"`
+	Compression         string        `json:"compression"`
+	LocalDC             string        `json:"local_dc"`
+	HostSelectionPolicy string        `json:"host_selection_policy"`
+	Hosts               []string      `json:"hosts"`
+	RequestTimeout      time.Duration `json:"-"`
+	ConnectTimeout      time.Duration `json:"-"`
+	Port                int           `json:"port"`
+	ProtocolVersion     int           `json:"protocol_version"`
+	// RemoteFallback lets the driver connect to the hosts of the other
+	// datacenters than LocalDC, which it only falls back to.
+	RemoteFallback bool `json:"remote_fallback"`
+	// TokenRouting routes the statements with the partition key gemini
+	// generated them for, see TokenRoutingPolicy.
+	TokenRouting bool `json:"token_routing"`
+}
+
+// UnmarshalJSON reads the timeouts as durations such as "10s".
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type config Config
+	aux := struct {
+		*config
+		RequestTimeout string `json:"request_timeout"`
+		ConnectTimeout string `json:"connect_timeout"`
+	}{config: (*config)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	for _, d := range []struct {
+		dst   *time.Duration
+		name  string
+		value string
+	}{
+		{dst: &c.RequestTimeout, name: "request_timeout", value: aux.RequestTimeout},
+		{dst: &c.ConnectTimeout, name: "connect_timeout", value: aux.ConnectTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", d.name)
+		}
+		*d.dst = v
+	}
+	return nil
+}
+
+// Merge sets the fields of the configuration that are not set to the ones
+// of defaults.
+func (c *Config) Merge(defaults Config) {
+	if len(c.Hosts) == 0 {
+		c.Hosts = defaults.Hosts
+	}
+	mergeString(&c.Username, defaults.Username)
+	mergeString(&c.Password, defaults.Password)
+	mergeString(&c.Consistency, defaults.Consistency)
+	mergeString(&c.SerialConsistency, defaults.SerialConsistency)
+	mergeString(&c.Compression, defaults.Compression)
+	mergeString(&c.LocalDC, defaults.LocalDC)
+	mergeString(&c.HostSelectionPolicy, defaults.HostSelectionPolicy)
+	mergeString(&c.TLS.CAFile, defaults.TLS.CAFile)
+	mergeString(&c.TLS.CertFile, defaults.TLS.CertFile)
+	mergeString(&c.TLS.KeyFile, defaults.TLS.KeyFile)
+	c.TLS.EnableHostVerification = c.TLS.EnableHostVerification || defaults.TLS.EnableHostVerification
+	if c.RequestTimeout == 0 {
+		c.RequestTimeout = defaults.RequestTimeout
+	}
+	if c.ConnectTimeout == 0 {
+		c.ConnectTimeout = defaults.ConnectTimeout
+	}
+	if c.Port == 0 {
+		c.Port = defaults.Port
+	}
+	if c.ProtocolVersion == 0 {
+		c.ProtocolVersion = defaults.ProtocolVersion
+	}
+	c.RemoteFallback = c.RemoteFallback || defaults.RemoteFallback
+	c.TokenRouting = c.TokenRouting || defaults.TokenRouting
+}
+
+func mergeString(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+// ClusterConfig returns the driver configuration of the cluster, without
+// its host selection and retry policies.
+func (c *Config) ClusterConfig() (*gocql.ClusterConfig, error) {
+	if len(c.Hosts) == 0 {
+		return nil, errors.New("no hosts")
+	}
+	cluster := gocql.NewCluster(c.Hosts...)
+	if c.Port != 0 {
+		cluster.Port = c.Port
+	}
+	if c.RequestTimeout != 0 {
+		cluster.Timeout = c.RequestTimeout
+	}
+	if c.ConnectTimeout != 0 {
+		cluster.ConnectTimeout = c.ConnectTimeout
+	}
+	if c.ProtocolVersion != 0 {
+		cluster.ProtoVersion = c.ProtocolVersion
+	}
+	if c.LocalDC != "" && !c.RemoteFallback {
+		cluster.HostFilter = gocql.DataCentreHostFilter(c.LocalDC)
+	}
+	if c.Consistency != "" {
+		cons, err := gocql.ParseConsistencyWrapper(c.Consistency)
+		if err != nil {
+			return nil, err
+		}
+		cluster.Consistency = cons
+	}
+	if c.SerialConsistency != "" {
+		cons, err := gocql.ParseConsistencyWrapper(c.SerialConsistency)
+		if err != nil {
+			return nil, err
+		}
+		if !cons.IsSerial() {
+			return nil, errors.Errorf("invalid serial consistency %s, expected SERIAL or LOCAL_SERIAL", c.SerialConsistency)
+		}
+		cluster.SerialConsistency = cons
+	}
+	switch strings.ToLower(c.Compression) {
+	case "", "none":
+	case "snappy":
+		cluster.Compressor = gocql.SnappyCompressor{}
+	default:
+		return nil, errors.Errorf("unknown compression %s, expected none or snappy", c.Compression)
+	}
+	authenticator, err := auth.BuildAuthenticator(c.Username, c.Password)
+	if err != nil {
+		return nil, err
+	}
+	if authenticator != nil {
+		cluster.Authenticator = authenticator
+	}
+	if c.TLS.Enabled() {
+		if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+			return nil, errors.New("both the TLS certificate and key files must be set")
+		}
+		// The driver only reads the files once it connects.
+		for _, f := range []string{c.TLS.CAFile, c.TLS.CertFile, c.TLS.KeyFile} {
+			if f == "" {
+				continue
+			}
+			if _, err = os.Stat(f); err != nil {
+				return nil, errors.Wrap(err, "invalid TLS configuration")
+			}
+		}
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 c.TLS.CAFile,
+			CertPath:               c.TLS.CertFile,
+			KeyPath:                c.TLS.KeyFile,
+			EnableHostVerification: c.TLS.EnableHostVerification,
+		}
+	}
+	return cluster, nil
+}
+
+// File is a configuration file of the clusters. Test holds the settings
+// shared by the systems under test, Tests the ones of each of them if there
+// are several.
+type File struct {
+	Tests  []Config `json:"tests"`
+	Test   Config   `json:"test"`
+	Oracle Config   `json:"oracle"`
+}
+
+// ReadFile reads a JSON configuration file of the clusters.
+func ReadFile(name string) (*File, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/scylladb/gemini/pkg/cluster"
+)
+
+func TestClusterConfig(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ca, cert, key := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for _, f := range []string{ca, cert, key} {
+		if err := os.WriteFile(f, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hosts := []string{"127.0.0.1"}
+	tests := map[string]struct {
+		check func(t *testing.T, c *gocql.ClusterConfig)
+		cfg   cluster.Config
+		err   bool
+	}{
+		"defaults": {
+			cfg: cluster.Config{Hosts: hosts},
+			check: func(t *testing.T, c *gocql.ClusterConfig) {
+				if c.Port != 9042 || c.Compressor != nil || c.SslOpts != nil || c.Authenticator != nil || c.HostFilter != nil {
+					t.Errorf("unexpected config %+v", c)
+				}
+			},
+		},
+		"connection": {
+			cfg: cluster.Config{
+				Hosts:             hosts,
+				Port:              19042,
+				Consistency:       "local_quorum",
+				SerialConsistency: "LOCAL_SERIAL",
+				ProtocolVersion:   4,
+				Compression:       "snappy",
+				RequestTimeout:    time.Second,
+				ConnectTimeout:    2 * time.Second,
+				Username:          "user",
+				Password:          "pass",
+			},
+			check: func(t *testing.T, c *gocql.ClusterConfig) {
+				if c.Port != 19042 || c.Consistency != gocql.LocalQuorum || c.SerialConsistency != gocql.LocalSerial ||
+					c.ProtoVersion != 4 || c.Timeout != time.Second || c.ConnectTimeout != 2*time.Second {
+					t.Errorf("unexpected config %+v", c)
+				}
+				if _, ok := c.Compressor.(gocql.SnappyCompressor); !ok {
+					t.Errorf("expected snappy compression, got %v", c.Compressor)
+				}
+				if a, ok := c.Authenticator.(*gocql.PasswordAuthenticator); !ok || a.Username != "user" {
+					t.Errorf("unexpected authenticator %v", c.Authenticator)
+				}
+			},
+		},
+		"local datacenter": {
+			cfg: cluster.Config{Hosts: hosts, LocalDC: "dc1"},
+			check: func(t *testing.T, c *gocql.ClusterConfig) {
+				if c.HostFilter == nil || c.HostFilter.Accept(&gocql.HostInfo{}) {
+					t.Error("expected the hosts of the other datacenters to be filtered out")
+				}
+			},
+		},
+		"remote fallback": {
+			cfg: cluster.Config{Hosts: hosts, LocalDC: "dc1", RemoteFallback: true},
+			check: func(t *testing.T, c *gocql.ClusterConfig) {
+				if c.HostFilter != nil {
+					t.Error("expected the hosts of every datacenter to be used")
+				}
+			},
+		},
+		"tls": {
+			cfg: cluster.Config{Hosts: hosts, TLS: cluster.TLSConfig{CAFile: ca, CertFile: cert, KeyFile: key, EnableHostVerification: true}},
+			check: func(t *testing.T, c *gocql.ClusterConfig) {
+				if c.SslOpts == nil || c.SslOpts.CaPath != ca || c.SslOpts.CertPath != cert || c.SslOpts.KeyPath != key ||
+					!c.SslOpts.EnableHostVerification {
+					t.Errorf("unexpected TLS options %+v", c.SslOpts)
+				}
+			},
+		},
+		"no hosts":                 {err: true},
+		"invalid consistency":      {cfg: cluster.Config{Hosts: hosts, Consistency: "MOST"}, err: true},
+		"invalid serial":           {cfg: cluster.Config{Hosts: hosts, SerialConsistency: "QUORUM"}, err: true},
+		"invalid compression":      {cfg: cluster.Config{Hosts: hosts, Compression: "zstd"}, err: true},
+		"missing password":         {cfg: cluster.Config{Hosts: hosts, Username: "user"}, err: true},
+		"certificate without key":  {cfg: cluster.Config{Hosts: hosts, TLS: cluster.TLSConfig{CertFile: cert}}, err: true},
+		"missing certificate file": {cfg: cluster.Config{Hosts: hosts, TLS: cluster.TLSConfig{CAFile: filepath.Join(dir, "none")}}, err: true},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c, err := test.cfg.ClusterConfig()
+			if test.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, c)
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "clusters.json")
+	data := `{
+	"test": {"hosts": ["10.0.0.1"], "consistency": "ONE", "request_timeout": "5s", "tls": {"ca_file": "ca.pem"}},
+	"oracle": {"hosts": ["10.0.1.1"], "port": 9142, "connect_timeout": "1m"}
+}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := cluster.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flags take precedence over the file, which takes precedence over the
+	// defaults shared by both clusters.
+	test := cluster.Config{Consistency: "QUORUM"}
+	test.Merge(f.Test)
+	oracle := f.Oracle
+	defaults := cluster.Config{Consistency: "LOCAL_ONE", RequestTimeout: 30 * time.Second, ConnectTimeout: 30 * time.Second}
+	test.Merge(defaults)
+	oracle.Merge(defaults)
+	if test.Hosts[0] != "10.0.0.1" || test.Consistency != "QUORUM" || test.RequestTimeout != 5*time.Second ||
+		test.ConnectTimeout != 30*time.Second || test.TLS.CAFile != "ca.pem" {
+		t.Errorf("unexpected test cluster config %+v", test)
+	}
+	if oracle.Hosts[0] != "10.0.1.1" || oracle.Consistency != "LOCAL_ONE" || oracle.Port != 9142 ||
+		oracle.RequestTimeout != 30*time.Second || oracle.ConnectTimeout != time.Minute || oracle.TLS.Enabled() {
+		t.Errorf("unexpected oracle cluster config %+v", oracle)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"test": {"request_timeout": "soon"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cluster.ReadFile(path); err == nil {
+		t.Error("expected an invalid duration error")
+	}
+}
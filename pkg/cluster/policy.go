@@ -0,0 +1,51 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"github.com/gocql/gocql"
+
+	"github.com/scylladb/gemini/pkg/routingkey"
+)
+
+// TokenRoutingPolicy returns a host selection policy routing the statements
+// executed with a context carrying their partition, see
+// routingkey.NewContext, with the routing key gemini computes instead of
+// the one the driver computes from the prepared statement, if any.
+func TokenRoutingPolicy(policy gocql.HostSelectionPolicy) gocql.HostSelectionPolicy {
+	return &tokenRoutingPolicy{HostSelectionPolicy: policy}
+}
+
+type tokenRoutingPolicy struct {
+	gocql.HostSelectionPolicy
+}
+
+func (p *tokenRoutingPolicy) Pick(qry gocql.ExecutableQuery) gocql.NextHost {
+	if qry != nil {
+		if key := routingkey.FromContext(qry.Context()); key != nil {
+			qry = routedQuery{ExecutableQuery: qry, routingKey: key}
+		}
+	}
+	return p.HostSelectionPolicy.Pick(qry)
+}
+
+type routedQuery struct {
+	gocql.ExecutableQuery
+	routingKey []byte
+}
+
+func (q routedQuery) GetRoutingKey() ([]byte, error) {
+	return q.routingKey, nil
+}
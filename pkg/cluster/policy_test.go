@@ -0,0 +1,75 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/gocql/gocql"
+
+	"github.com/scylladb/gemini/pkg/cluster"
+	"github.com/scylladb/gemini/pkg/routingkey"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// recordingPolicy records the routing key of the last picked query.
+type recordingPolicy struct {
+	gocql.HostSelectionPolicy
+	routingKey []byte
+}
+
+func (p *recordingPolicy) Pick(qry gocql.ExecutableQuery) gocql.NextHost {
+	p.routingKey, _ = qry.GetRoutingKey()
+	return nil
+}
+
+type fakeQuery struct {
+	gocql.ExecutableQuery
+	ctx context.Context
+}
+
+func (q fakeQuery) Context() context.Context {
+	return q.ctx
+}
+
+func (q fakeQuery) GetRoutingKey() ([]byte, error) {
+	return []byte("driver"), nil
+}
+
+func TestTokenRoutingPolicy(t *testing.T) {
+	t.Parallel()
+	table := &typedef.Table{
+		Name:          "table1",
+		PartitionKeys: typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}, {Name: "pk1", Type: typedef.TYPE_TEXT}},
+	}
+	values := typedef.Values{int32(7), "a"}
+	want, err := (&routingkey.Creator{}).CreateRoutingKey(table, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &recordingPolicy{}
+	policy := cluster.TokenRoutingPolicy(recorder)
+	policy.Pick(fakeQuery{ctx: routingkey.NewContext(context.Background(), table, values)})
+	if !bytes.Equal(recorder.routingKey, want) {
+		t.Errorf("expected the routing key %x of the partition, got %x", want, recorder.routingKey)
+	}
+	policy.Pick(fakeQuery{ctx: context.Background()})
+	if string(recorder.routingKey) != "driver" {
+		t.Errorf("expected the routing key of the driver without a partition, got %x", recorder.routingKey)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/scylladb/gemini/pkg/inflight"
+	"github.com/scylladb/gemini/pkg/metrics"
 	"github.com/scylladb/gemini/pkg/routingkey"
 	"github.com/scylladb/gemini/pkg/typedef"
 
@@ -46,6 +47,7 @@ type GeneratorInterface interface {
 	GetOld() *typedef.ValueWithToken
 	GiveOld(_ *typedef.ValueWithToken)
 	ReleaseToken(_ uint64)
+	Lists() *ListRows
 }
 
 type Generator struct {
@@ -55,6 +57,8 @@ type Generator struct {
 	routingKeyCreator *routingkey.Creator
 	r                 *rand.Rand
 	wakeUpSignal      <-chan struct{}
+	tainted           *TaintedPartitions
+	lists             *ListRows
 	idxFunc           DistributionFunc
 	partitions        Partitions
 	partitionsConfig  typedef.PartitionRangeConfig
@@ -81,14 +85,19 @@ type Config struct {
 
 func NewGenerator(ctx context.Context, table *typedef.Table, config *Config, logger *zap.Logger) *Generator {
 	wakeUpSignal := make(chan struct{})
+	inFlightTokens := metrics.InFlightTokens.WithLabelValues(table.Name)
+	buffered := metrics.GeneratorBuffer.WithLabelValues(table.Name)
+	metrics.GeneratorBufferCapacity.WithLabelValues(table.Name).Set(float64(config.PartitionsCount * config.PkUsedBufferSize))
 	partitions := make([]*Partition, config.PartitionsCount)
 	for i := 0; i < len(partitions); i++ {
 		partitions[i] = &Partition{
-			ctx:          ctx,
-			values:       make(chan *typedef.ValueWithToken, config.PkUsedBufferSize),
-			oldValues:    make(chan *typedef.ValueWithToken, config.PkUsedBufferSize),
-			inFlight:     inflight.New(),
-			wakeUpSignal: wakeUpSignal,
+			ctx:            ctx,
+			values:         make(chan *typedef.ValueWithToken, config.PkUsedBufferSize),
+			oldValues:      make(chan *typedef.ValueWithToken, config.PkUsedBufferSize),
+			inFlight:       inflight.New(),
+			wakeUpSignal:   wakeUpSignal,
+			inFlightTokens: inFlightTokens,
+			buffered:       buffered,
 		}
 	}
 	gs := &Generator{
@@ -101,6 +110,8 @@ func NewGenerator(ctx context.Context, table *typedef.Table, config *Config, log
 		idxFunc:          config.PartitionsDistributionFunc,
 		logger:           logger,
 		wakeUpSignal:     wakeUpSignal,
+		tainted:          NewTaintedPartitions(),
+		lists:            NewListRows(),
 	}
 	gs.start()
 	return gs
@@ -148,6 +159,16 @@ func (g *Generator) ReleaseToken(token uint64) {
 	g.partitions[token%g.partitionCount].releaseToken(token)
 }
 
+// Tainted returns the partitions of the table whose state is indeterminate.
+func (g *Generator) Tainted() *TaintedPartitions {
+	return g.tainted
+}
+
+// Lists returns the rows of the table known to hold elements in their lists.
+func (g *Generator) Lists() *ListRows {
+	return g.lists
+}
+
 func (g *Generator) start() {
 	grp, gCtx := errgroup.WithContext(g.ctx)
 	g.ctx = gCtx
@@ -196,6 +217,7 @@ func (g *Generator) fillAllPartitions() {
 		partition := g.partitions[idx]
 		select {
 		case partition.values <- &typedef.ValueWithToken{Token: token, Value: values}:
+			partition.buffered.Inc()
 			g.cntEmitted++
 		default:
 			if !pFilled[idx] {
@@ -19,7 +19,10 @@ import (
 	"sync/atomic"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
 	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/metrics"
 	"github.com/scylladb/gemini/pkg/typedef"
 
 	"go.uber.org/zap"
@@ -55,3 +58,42 @@ func TestGenerator(t *testing.T) {
 		}
 	}
 }
+
+func TestGeneratorMetrics(t *testing.T) {
+	table := &typedef.Table{
+		Name:          "metrics_tbl",
+		PartitionKeys: generators.CreatePkColumns(1, "pk"),
+	}
+	cfg := &generators.Config{
+		PartitionsRangeConfig: typedef.PartitionRangeConfig{
+			MaxStringLength: 10,
+			MinStringLength: 0,
+			MaxBlobLength:   10,
+			MinBlobLength:   0,
+		},
+		PkUsedBufferSize: 10,
+		PartitionsCount:  2,
+		PartitionsDistributionFunc: func() generators.TokenIndex {
+			return 0
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	generator := generators.NewGenerator(ctx, table, cfg, zap.NewNop())
+	inFlight := metrics.InFlightTokens.WithLabelValues(table.Name)
+	v := generator.Get()
+	if got := testutil.ToFloat64(inFlight); got != 1 {
+		t.Errorf("expected 1 token in flight, got %v", got)
+	}
+	generator.ReleaseToken(v.Token)
+	generator.ReleaseToken(v.Token)
+	if got := testutil.ToFloat64(inFlight); got != 0 {
+		t.Errorf("expected no token in flight, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.GeneratorBufferCapacity.WithLabelValues(table.Name)); got != 20 {
+		t.Errorf("expected a buffer capacity of 20, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.GeneratorBuffer.WithLabelValues(table.Name)); got < 0 || got > 20 {
+		t.Errorf("expected the buffered keys to fit in the buffers, got %v", got)
+	}
+}
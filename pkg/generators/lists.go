@@ -0,0 +1,86 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generators
+
+import (
+	"sync"
+
+	"golang.org/x/exp/rand"
+
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// maxListRows bounds the number of rows kept by ListRows, the rows written
+// once it is full are not kept.
+const maxListRows = 1024
+
+// ListRows tracks rows known to hold elements in all their non-frozen lists,
+// one per partition, so that the elements of the lists can be set by index.
+type ListRows struct {
+	rows  []*typedef.ListRow
+	index map[uint64]int
+	mu    sync.Mutex
+}
+
+func NewListRows() *ListRows {
+	return &ListRows{index: make(map[uint64]int)}
+}
+
+// Record updates the rows after a mutation: the partitions the statement
+// writes to are forgotten, and the row it leaves with elements in its lists
+// is kept if the statement was applied.
+func (l *ListRows) Record(stmt *typedef.Stmt, applied bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, v := range stmt.Partitions() {
+		l.remove(v.Token)
+	}
+	if row := stmt.ListRow; applied && row != nil && len(l.rows) < maxListRows {
+		l.remove(row.Partition.Token)
+		l.index[row.Partition.Token] = len(l.rows)
+		l.rows = append(l.rows, row)
+	}
+}
+
+// Take removes a random row and returns it, nil if there is none. The row
+// is kept again by Record once it has been updated.
+func (l *ListRows) Take(r *rand.Rand) *typedef.ListRow {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.rows) == 0 {
+		return nil
+	}
+	row := l.rows[r.Intn(len(l.rows))]
+	l.remove(row.Partition.Token)
+	return row
+}
+
+func (l *ListRows) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.rows)
+}
+
+func (l *ListRows) remove(token uint64) {
+	i, ok := l.index[token]
+	if !ok {
+		return
+	}
+	last := len(l.rows) - 1
+	l.rows[i] = l.rows[last]
+	l.index[l.rows[i].Partition.Token] = i
+	l.rows = l.rows[:last]
+	delete(l.index, token)
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generators_test
+
+import (
+	"testing"
+
+	"golang.org/x/exp/rand"
+
+	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+func TestListRows(t *testing.T) {
+	t.Parallel()
+	r := rand.New(rand.NewSource(1))
+	lists := generators.NewListRows()
+	insert := func(token uint64) *typedef.Stmt {
+		v := &typedef.ValueWithToken{Token: token, Value: typedef.Values{token}}
+		return &typedef.Stmt{
+			ValuesWithToken: v,
+			ListRow:         &typedef.ListRow{Partition: v, Lengths: map[string]int{"col0": 2}},
+		}
+	}
+	lists.Record(insert(10), true)
+	lists.Record(insert(20), true)
+	lists.Record(insert(30), false)
+	if lists.Len() != 2 {
+		t.Fatalf("expected the rows of the applied inserts, got %d rows", lists.Len())
+	}
+
+	// Any other mutation of a partition forgets its row.
+	lists.Record(&typedef.Stmt{ValuesWithToken: &typedef.ValueWithToken{Token: 10}}, true)
+	row := lists.Take(r)
+	if row == nil || row.Partition.Token != 20 {
+		t.Fatalf("expected the row of partition 20, got %v", row)
+	}
+	if lists.Take(r) != nil {
+		t.Error("expected the taken row to be removed")
+	}
+
+	// The row is kept again once updated.
+	lists.Record(&typedef.Stmt{ValuesWithToken: row.Partition, ListRow: row}, true)
+	if lists.Len() != 1 {
+		t.Errorf("expected the updated row to be kept, got %d rows", lists.Len())
+	}
+}
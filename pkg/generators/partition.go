@@ -17,6 +17,8 @@ package generators
 import (
 	"context"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/scylladb/gemini/pkg/inflight"
 	"github.com/scylladb/gemini/pkg/typedef"
 )
@@ -27,6 +29,9 @@ type Partition struct {
 	oldValues    chan *typedef.ValueWithToken
 	inFlight     inflight.InFlight
 	wakeUpSignal chan<- struct{} // wakes up generator
+	// inFlightTokens and buffered are the gauges of the table.
+	inFlightTokens prometheus.Gauge
+	buffered       prometheus.Gauge
 }
 
 // get returns a new value and ensures that it's corresponding token
@@ -35,6 +40,7 @@ func (s *Partition) get() *typedef.ValueWithToken {
 	for {
 		v := s.pick()
 		if s.inFlight.AddIfNotPresent(v.Token) {
+			s.inFlightTokens.Inc()
 			return v
 		}
 	}
@@ -66,7 +72,9 @@ func (s *Partition) giveOld(v *typedef.ValueWithToken) {
 
 // releaseToken removes the corresponding token from the in-flight tracking.
 func (s *Partition) releaseToken(token uint64) {
-	s.inFlight.Delete(token)
+	if s.inFlight.Delete(token) {
+		s.inFlightTokens.Dec()
+	}
 }
 
 func (s *Partition) wakeUp() {
@@ -79,12 +87,15 @@ func (s *Partition) wakeUp() {
 func (s *Partition) pick() *typedef.ValueWithToken {
 	select {
 	case val := <-s.values:
+		s.buffered.Dec()
 		if len(s.values) <= cap(s.values)/4 {
 			s.wakeUp() // channel at 25% capacity, trigger generator
 		}
 		return val
 	default:
 		s.wakeUp() // channel empty, need to wait for new values
-		return <-s.values
+		val := <-s.values
+		s.buffered.Dec()
+		return val
 	}
 }
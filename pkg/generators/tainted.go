@@ -0,0 +1,80 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generators
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// TaintedPartitions tracks the partitions whose state is indeterminate
+// because a mutation failed or timed out on the oracle or on the test
+// system, so the two systems may legitimately disagree about them.
+type TaintedPartitions struct {
+	partitions map[uint64]typedef.Values
+	mu         sync.RWMutex
+}
+
+func NewTaintedPartitions() *TaintedPartitions {
+	return &TaintedPartitions{partitions: make(map[uint64]typedef.Values)}
+}
+
+// Taint marks the partition as indeterminate, it reports whether the
+// partition was not tainted already.
+func (t *TaintedPartitions) Taint(v *typedef.ValueWithToken) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.partitions[v.Token]; ok {
+		return false
+	}
+	t.partitions[v.Token] = v.Value.Copy()
+	return true
+}
+
+// Clear marks the partition as identical on both systems again.
+func (t *TaintedPartitions) Clear(token uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.partitions, token)
+}
+
+func (t *TaintedPartitions) IsTainted(token uint64) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.partitions[token]
+	return ok
+}
+
+func (t *TaintedPartitions) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.partitions)
+}
+
+// List returns the tainted partitions in token order.
+func (t *TaintedPartitions) List() []*typedef.ValueWithToken {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]*typedef.ValueWithToken, 0, len(t.partitions))
+	for token, values := range t.partitions {
+		out = append(out, &typedef.ValueWithToken{Token: token, Value: values})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Token < out[j].Token
+	})
+	return out
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generators_test
+
+import (
+	"testing"
+
+	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+func TestTaintedPartitions(t *testing.T) {
+	t.Parallel()
+	tainted := generators.NewTaintedPartitions()
+	values := typedef.Values{1}
+	for _, token := range []uint64{30, 10, 20} {
+		if !tainted.Taint(&typedef.ValueWithToken{Token: token, Value: values}) {
+			t.Errorf("partition %d was not tainted yet", token)
+		}
+	}
+	if tainted.Taint(&typedef.ValueWithToken{Token: 10, Value: values}) {
+		t.Error("partition 10 is already tainted")
+	}
+	values[0] = 2
+	if tainted.Len() != 3 || !tainted.IsTainted(20) || tainted.IsTainted(40) {
+		t.Fatalf("unexpected tainted partitions %v", tainted.List())
+	}
+
+	tainted.Clear(20)
+	list := tainted.List()
+	if len(list) != 2 || list[0].Token != 10 || list[1].Token != 30 {
+		t.Fatalf("unexpected tainted partitions %v", list)
+	}
+	if list[0].Value[0] != 1 {
+		t.Errorf("the values of a tainted partition must be copied, got %v", list[0].Value)
+	}
+}
@@ -25,7 +25,8 @@ const shrinkInflightsLimit = 1000
 
 type InFlight interface {
 	AddIfNotPresent(uint64) bool
-	Delete(uint64)
+	// Delete removes the value and reports whether it was present.
+	Delete(uint64) bool
 }
 
 // New creates a instance of a simple InFlight set.
@@ -64,9 +65,9 @@ type shardedSyncU64set struct {
 	shards [256]*syncU64set
 }
 
-func (s *shardedSyncU64set) Delete(v uint64) {
+func (s *shardedSyncU64set) Delete(v uint64) bool {
 	ss := s.shards[v%256]
-	ss.Delete(v)
+	return ss.Delete(v)
 }
 
 func (s *shardedSyncU64set) AddIfNotPresent(v uint64) bool {
@@ -106,15 +107,16 @@ func (s *syncU64set) Has(u uint64) bool {
 	return ok
 }
 
-func (s *syncU64set) Delete(u uint64) {
+func (s *syncU64set) Delete(u uint64) bool {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	_, ok := s.values[u]
 	if !ok {
-		return
+		return false
 	}
 	delete(s.values, u)
 	s.addDeleted(1)
+	return true
 }
 
 func (s *syncU64set) addDeleted(n uint64) {
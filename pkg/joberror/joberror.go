@@ -22,10 +22,69 @@ import (
 )
 
 type JobError struct {
-	Timestamp time.Time `json:"timestamp"`
-	Message   string    `json:"message"`
-	Query     string    `json:"query"`
-	StmtType  string    `json:"stmt-type"`
+	Timestamp  time.Time  `json:"timestamp"`
+	Message    string     `json:"message"`
+	Query      string     `json:"query"`
+	StmtType   string     `json:"stmt-type"`
+	System     string     `json:"system,omitempty"`
+	Reproducer string     `json:"reproducer,omitempty"`
+	Mismatches []Mismatch `json:"mismatches,omitempty"`
+	Traces     []Trace    `json:"traces,omitempty"`
+}
+
+// Trace is the server side trace of a failed statement run again on a
+// system with tracing enabled.
+type Trace struct {
+	System      string `json:"system"`
+	SessionID   string `json:"session-id"`
+	Coordinator string `json:"coordinator,omitempty"`
+	// Error is the error of the statement run again, if it failed again.
+	Error  string       `json:"error,omitempty"`
+	Events []TraceEvent `json:"events,omitempty"`
+	// Duration is the duration of the traced request in microseconds.
+	Duration int `json:"duration"`
+}
+
+// TraceEvent is an event of system_traces.events.
+type TraceEvent struct {
+	Time     time.Time `json:"time"`
+	Activity string    `json:"activity"`
+	Source   string    `json:"source"`
+	Thread   string    `json:"thread,omitempty"`
+	// Elapsed is the time elapsed on Source since the request started, in
+	// microseconds.
+	Elapsed int `json:"source-elapsed"`
+}
+
+type MismatchKind string
+
+const (
+	// MissingRow is a row returned by the oracle but not by the test cluster.
+	MissingRow MismatchKind = "missing-row"
+	// ExtraRow is a row returned by the test cluster but not by the oracle.
+	ExtraRow MismatchKind = "extra-row"
+	// DifferingCell is a cell with different values in the oracle and the test cluster.
+	DifferingCell MismatchKind = "differing-cell"
+	// OutOfOrderRow is a row returned by System after a row that follows it
+	// in primary key order.
+	OutOfOrderRow MismatchKind = "out-of-order-row"
+)
+
+// Mismatch describes a single difference between the oracle and the test results.
+// Values are rendered as CQL literals, null values are left empty.
+type Mismatch struct {
+	PrimaryKey  map[string]string `json:"primary-key"`
+	OracleValue *string           `json:"oracle-value,omitempty"`
+	TestValue   *string           `json:"test-value,omitempty"`
+	Kind        MismatchKind      `json:"kind"`
+	Column      string            `json:"column,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	System      string            `json:"system,omitempty"`
+	// Token is the token of the partition of the row.
+	Token uint64 `json:"-"`
+	// Expiring is set for the cells that have a TTL on either system, or
+	// that may have one when their TTL was not selected.
+	Expiring bool `json:"-"`
 }
 
 type ErrorList struct {
@@ -108,3 +108,35 @@ func TestErrorListSerialization(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestMismatchSerialization(t *testing.T) {
+	//nolint:lll
+	expected := []byte(`{"timestamp":"2020-02-01T00:00:00Z","message":"Some Message","query":"Some Query","stmt-type":"Some Type","mismatches":[{"primary-key":{"ck0":"2","pk0":"1"},"oracle-value":"a","kind":"differing-cell","column":"col0","type":"text"},{"primary-key":{"pk0":"3"},"kind":"missing-row"}]}`)
+	oracleValue := "a"
+	result, err := json.Marshal(joberror.JobError{
+		Timestamp: time.Date(2020, 02, 01, 0, 0, 0, 0, time.UTC),
+		Message:   "Some Message",
+		Query:     "Some Query",
+		StmtType:  "Some Type",
+		Mismatches: []joberror.Mismatch{
+			{
+				Kind:        joberror.DifferingCell,
+				PrimaryKey:  map[string]string{"pk0": "1", "ck0": "2"},
+				Column:      "col0",
+				Type:        "text",
+				OracleValue: &oracleValue,
+			},
+			{
+				Kind:       joberror.MissingRow,
+				PrimaryKey: map[string]string{"pk0": "3"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(expected, result); diff != "" {
+		t.Error(diff)
+	}
+}
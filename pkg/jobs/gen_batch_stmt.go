@@ -0,0 +1,208 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/scylladb/gocqlx/v2/qb"
+	"golang.org/x/exp/rand"
+
+	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/typedef"
+	"github.com/scylladb/gemini/pkg/utils"
+)
+
+const (
+	minBatchStmts = 2
+	maxBatchStmts = 4
+)
+
+// genBatchStmt generates a batch of 2 to 4 statements. A logged batch writes
+// a row of several partitions, an unlogged one several rows of the partition
+// of valuesWithToken. Counter tables get counter batches of updates.
+func genBatchStmt(
+	s *typedef.Schema,
+	t *typedef.Table,
+	g generators.GeneratorInterface,
+	valuesWithToken *typedef.ValueWithToken,
+	r *rand.Rand,
+	p *typedef.PartitionRangeConfig,
+	logged bool,
+) (*typedef.Stmt, error) {
+	n := utils.RandInt2(r, minBatchStmts, maxBatchStmts+1)
+	partitions := []*typedef.ValueWithToken{valuesWithToken}
+	if logged {
+		for len(partitions) < n {
+			v := g.Get()
+			if v == nil {
+				break
+			}
+			partitions = append(partitions, v)
+		}
+	}
+	var (
+		stmts []*typedef.Stmt
+		err   error
+	)
+	switch {
+	case t.IsCounterTable():
+		stmts, err = genCounterBatchStmts(s, t, partitions, r, p, n)
+	case logged:
+		stmts, err = genLoggedBatchStmts(s, t, partitions, r, p)
+	default:
+		stmts, err = genUnloggedBatchStmts(s, t, valuesWithToken, r, p, n)
+	}
+	if err != nil {
+		for _, v := range partitions[1:] {
+			g.GiveOld(v)
+		}
+		return nil, err
+	}
+
+	//nolint:staticcheck // gocql batches cannot be rendered to CQL for the oracle and the logs
+	builder := qb.Batch()
+	switch {
+	case t.IsCounterTable():
+		builder = builder.Counter()
+	case !logged:
+		builder = builder.UnLogged()
+	}
+	var (
+		types         typedef.Types
+		values        typedef.Values
+		notIdempotent bool
+	)
+	for _, stmt := range stmts {
+		builder = builder.Add(stmt.Query)
+		types = append(types, stmt.Types...)
+		values = append(values, stmt.Values...)
+		notIdempotent = notIdempotent || stmt.NotIdempotent
+	}
+	return &typedef.Stmt{
+		StmtCache: &typedef.StmtCache{
+			Query:         builder,
+			Types:         types,
+			QueryType:     typedef.BatchStatementType,
+			NotIdempotent: notIdempotent,
+		},
+		ValuesWithToken:      valuesWithToken,
+		OtherValuesWithToken: partitions[1:],
+		Values:               values,
+	}, nil
+}
+
+// genCounterBatchStmts increments the counters of n rows spread over the
+// partitions.
+func genCounterBatchStmts(
+	s *typedef.Schema,
+	t *typedef.Table,
+	partitions []*typedef.ValueWithToken,
+	r *rand.Rand,
+	p *typedef.PartitionRangeConfig,
+	n int,
+) ([]*typedef.Stmt, error) {
+	stmts := make([]*typedef.Stmt, 0, n)
+	for i := 0; i < n; i++ {
+		stmt, err := genUpdateStmt(s, t, partitions[i%len(partitions)], r, p)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+// genLoggedBatchStmts inserts or updates a row of each partition.
+func genLoggedBatchStmts(
+	s *typedef.Schema,
+	t *typedef.Table,
+	partitions []*typedef.ValueWithToken,
+	r *rand.Rand,
+	p *typedef.PartitionRangeConfig,
+) ([]*typedef.Stmt, error) {
+	stmts := make([]*typedef.Stmt, 0, len(partitions))
+	for _, v := range partitions {
+		stmt, err := genBatchWrite(s, t, v, r, p)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
+
+// genUnloggedBatchStmts inserts or updates distinct rows of a partition and
+// may end with a delete. The statements of a batch share their timestamp,
+// so that two writes of a row would be resolved by comparing their values
+// and a delete shadows the writes whatever its place: the rows are kept
+// distinct and the delete last for the oracles applying them in order to
+// agree with the cluster.
+func genUnloggedBatchStmts(
+	s *typedef.Schema,
+	t *typedef.Table,
+	valuesWithToken *typedef.ValueWithToken,
+	r *rand.Rand,
+	p *typedef.PartitionRangeConfig,
+	n int,
+) ([]*typedef.Stmt, error) {
+	stmts := make([]*typedef.Stmt, 0, n)
+	rows := make(map[string]struct{}, n)
+	var deleteStmt *typedef.Stmt
+	for i := 0; i < n; i++ {
+		if deleteStmt == nil && r.Intn(n) == 0 {
+			stmt, err := genDeleteRows(s, t, valuesWithToken, r, p)
+			if err != nil {
+				return nil, err
+			}
+			deleteStmt = stmt
+			continue
+		}
+		stmt, err := genBatchWrite(s, t, valuesWithToken, r, p)
+		if err != nil {
+			return nil, err
+		}
+		row := batchWriteRow(t, stmt)
+		if _, ok := rows[row]; ok {
+			continue
+		}
+		rows[row] = struct{}{}
+		stmts = append(stmts, stmt)
+	}
+	if deleteStmt != nil {
+		stmts = append(stmts, deleteStmt)
+	}
+	return stmts, nil
+}
+
+// genBatchWrite generates an insert or, on tables with regular columns, an
+// update of a row.
+func genBatchWrite(s *typedef.Schema, t *typedef.Table, valuesWithToken *typedef.ValueWithToken, r *rand.Rand, p *typedef.PartitionRangeConfig) (*typedef.Stmt, error) {
+	if len(t.Columns) > 0 && r.Intn(2) == 0 {
+		return genUpdateStmt(s, t, valuesWithToken, r, p)
+	}
+	return genInsertStmt(s, t, valuesWithToken, r, p, false)
+}
+
+// batchWriteRow returns the clustering key values of the row written by an
+// insert or an update, the clustering keys being after the partition keys
+// in the values of an insert and last in the ones of an update.
+func batchWriteRow(t *typedef.Table, stmt *typedef.Stmt) string {
+	pkLen, ckLen := t.PartitionKeys.LenValues(), t.ClusteringKeys.LenValues()
+	if stmt.QueryType == typedef.UpdateStatementType {
+		return fmt.Sprint(stmt.Values[len(stmt.Values)-ckLen:])
+	}
+	return fmt.Sprint(stmt.Values[pkLen : pkLen+ckLen])
+}
@@ -23,8 +23,11 @@ import (
 	"github.com/scylladb/gemini/pkg/generators"
 	"github.com/scylladb/gemini/pkg/typedef"
 	"github.com/scylladb/gemini/pkg/utils"
+	"github.com/scylladb/gemini/pkg/workload"
 )
 
+// GenCheckStmt generates a validation query of a shape drawn from the
+// workload profile among the ones the table supports.
 func GenCheckStmt(
 	s *typedef.Schema,
 	table *typedef.Table,
@@ -32,83 +35,118 @@ func GenCheckStmt(
 	rnd *rand.Rand,
 	p *typedef.PartitionRangeConfig,
 ) *typedef.Stmt {
-	n := 0
+	kind := p.Workload.Check(rnd, func(kind string) bool {
+		switch {
+		case workload.IsViewCheck(kind):
+			return len(table.MaterializedViews) > 0
+		case kind == workload.SingleIndex:
+			return len(table.Indexes) > 0
+		default:
+			return true
+		}
+	})
 	mvNum := -1
-	maxClusteringRels := 0
-	numQueryPKs := 0
-	if len(table.MaterializedViews) > 0 && rnd.Int()%2 == 0 {
+	if workload.IsViewCheck(kind) {
 		mvNum = utils.RandInt2(rnd, 0, len(table.MaterializedViews))
 	}
+	stmt := genCheckStmt(s, table, g, rnd, p, kind, mvNum)
+	if stmt != nil && p.CheckWriteTimes {
+		selectWriteTimes(stmt, table, mvNum)
+	}
+	return stmt
+}
 
-	switch mvNum {
-	case -1:
-		if len(table.Indexes) > 0 {
-			n = rnd.Intn(5)
-		} else {
-			n = rnd.Intn(4)
-		}
-		switch n {
-		case 0:
-			return genSinglePartitionQuery(s, table, g)
-		case 1:
-			numQueryPKs = utils.RandInt2(rnd, 1, table.PartitionKeys.Len())
-			multiplier := int(math.Pow(float64(numQueryPKs), float64(table.PartitionKeys.Len())))
-			if multiplier > 100 {
-				numQueryPKs = 1
-			}
-			return genMultiplePartitionQuery(s, table, g, numQueryPKs)
-		case 2:
-			maxClusteringRels = utils.RandInt2(rnd, 0, table.ClusteringKeys.Len())
-			return genClusteringRangeQuery(s, table, g, rnd, p, maxClusteringRels)
-		case 3:
-			numQueryPKs = utils.RandInt2(rnd, 1, table.PartitionKeys.Len())
-			multiplier := int(math.Pow(float64(numQueryPKs), float64(table.PartitionKeys.Len())))
-			if multiplier > 100 {
-				numQueryPKs = 1
-			}
-			maxClusteringRels = utils.RandInt2(rnd, 0, table.ClusteringKeys.Len())
-			return genMultiplePartitionClusteringRangeQuery(s, table, g, rnd, p, numQueryPKs, maxClusteringRels)
-		case 4:
-			// Reducing the probability to hit these since they often take a long time to run
-			switch rnd.Intn(5) {
-			case 0:
-				idxCount := utils.RandInt2(rnd, 1, len(table.Indexes))
-				return genSingleIndexQuery(s, table, g, rnd, p, idxCount)
-			default:
-				return genSinglePartitionQuery(s, table, g)
-			}
-		}
-	default:
-		n = rnd.Intn(4)
-		switch n {
-		case 0:
-			return genSinglePartitionQueryMv(s, table, g, rnd, p, mvNum)
-		case 1:
-			lenPartitionKeys := table.MaterializedViews[mvNum].PartitionKeys.Len()
-			numQueryPKs = utils.RandInt2(rnd, 1, lenPartitionKeys)
-			multiplier := int(math.Pow(float64(numQueryPKs), float64(lenPartitionKeys)))
-			if multiplier > 100 {
-				numQueryPKs = 1
-			}
-			return genMultiplePartitionQueryMv(s, table, g, rnd, p, mvNum, numQueryPKs)
-		case 2:
-			lenClusteringKeys := table.MaterializedViews[mvNum].ClusteringKeys.Len()
-			maxClusteringRels = utils.RandInt2(rnd, 0, lenClusteringKeys)
-			return genClusteringRangeQueryMv(s, table, g, rnd, p, mvNum, maxClusteringRels)
-		case 3:
-			lenPartitionKeys := table.MaterializedViews[mvNum].PartitionKeys.Len()
-			numQueryPKs = utils.RandInt2(rnd, 1, lenPartitionKeys)
-			multiplier := int(math.Pow(float64(numQueryPKs), float64(lenPartitionKeys)))
-			if multiplier > 100 {
-				numQueryPKs = 1
-			}
-			lenClusteringKeys := table.MaterializedViews[mvNum].ClusteringKeys.Len()
-			maxClusteringRels = utils.RandInt2(rnd, 0, lenClusteringKeys)
-			return genMultiplePartitionClusteringRangeQueryMv(s, table, g, rnd, p, mvNum, numQueryPKs, maxClusteringRels)
+func genCheckStmt(
+	s *typedef.Schema,
+	table *typedef.Table,
+	g generators.GeneratorInterface,
+	rnd *rand.Rand,
+	p *typedef.PartitionRangeConfig,
+	kind string,
+	mvNum int,
+) *typedef.Stmt {
+	switch kind {
+	case workload.SinglePartition:
+		return genSinglePartitionQuery(s, table, g)
+	case workload.MultiplePartitions:
+		return genMultiplePartitionQuery(s, table, g, randNumQueryPKs(rnd, table.PartitionKeys.Len()))
+	case workload.ClusteringRange:
+		maxClusteringRels := utils.RandInt2(rnd, 0, table.ClusteringKeys.Len())
+		return genClusteringRangeQuery(s, table, g, rnd, p, maxClusteringRels)
+	case workload.MultiplePartitionsClusteringRange:
+		numQueryPKs := randNumQueryPKs(rnd, table.PartitionKeys.Len())
+		maxClusteringRels := utils.RandInt2(rnd, 0, table.ClusteringKeys.Len())
+		return genMultiplePartitionClusteringRangeQuery(s, table, g, rnd, p, numQueryPKs, maxClusteringRels)
+	case workload.SingleIndex:
+		idxCount := utils.RandInt2(rnd, 1, len(table.Indexes))
+		return genSingleIndexQuery(s, table, g, rnd, p, idxCount)
+	case workload.ViewSinglePartition:
+		return genSinglePartitionQueryMv(s, table, g, rnd, p, mvNum)
+	case workload.ViewMultiplePartitions:
+		numQueryPKs := randNumQueryPKs(rnd, table.MaterializedViews[mvNum].PartitionKeys.Len())
+		return genMultiplePartitionQueryMv(s, table, g, rnd, p, mvNum, numQueryPKs)
+	case workload.ViewClusteringRange:
+		maxClusteringRels := utils.RandInt2(rnd, 0, table.MaterializedViews[mvNum].ClusteringKeys.Len())
+		return genClusteringRangeQueryMv(s, table, g, rnd, p, mvNum, maxClusteringRels)
+	case workload.ViewMultiplePartitionsClusteringRange:
+		numQueryPKs := randNumQueryPKs(rnd, table.MaterializedViews[mvNum].PartitionKeys.Len())
+		maxClusteringRels := utils.RandInt2(rnd, 0, table.MaterializedViews[mvNum].ClusteringKeys.Len())
+		return genMultiplePartitionClusteringRangeQueryMv(s, table, g, rnd, p, mvNum, numQueryPKs, maxClusteringRels)
+	}
+	return nil
+}
+
+// randNumQueryPKs draws the number of partitions a query selects, 1 if the
+// cartesian product of the values of the partition keys would be too large.
+func randNumQueryPKs(rnd *rand.Rand, lenPartitionKeys int) int {
+	n := utils.RandInt2(rnd, 1, lenPartitionKeys)
+	if int(math.Pow(float64(n), float64(lenPartitionKeys))) > 100 {
+		return 1
+	}
+	return n
+}
+
+// selectWriteTimes replaces the * of a check statement with the columns of
+// the table or view, followed by the WRITETIME and TTL of every regular
+// column stored as a single cell.
+func selectWriteTimes(stmt *typedef.Stmt, table *typedef.Table, mvNum int) {
+	builder, ok := stmt.Query.(*qb.SelectBuilder)
+	if !ok {
+		return
+	}
+	table.RLock()
+	defer table.RUnlock()
+	t := table
+	if mvNum >= 0 {
+		t = table.MaterializedViews[mvNum].AsTable(table)
+	}
+	var metadata []string
+	for _, col := range t.Columns {
+		if hasSingleCell(col.Type) {
+			metadata = append(metadata, "WRITETIME("+col.Name+")", "TTL("+col.Name+")")
 		}
 	}
+	if len(metadata) == 0 {
+		return
+	}
+	columns := make([]string, 0, len(t.PartitionKeys)+len(t.ClusteringKeys)+len(t.Columns)+len(metadata))
+	for _, cols := range []typedef.Columns{t.PartitionKeys, t.ClusteringKeys, t.Columns} {
+		columns = append(columns, cols.Names()...)
+	}
+	builder.Columns(append(columns, metadata...)...)
+}
 
-	return nil
+// hasSingleCell reports whether WRITETIME and TTL can be selected for
+// a column of the type, which rules out counters and multi-cell values.
+func hasSingleCell(typ typedef.Type) bool {
+	switch t := typ.(type) {
+	case *typedef.CounterType, *typedef.BagType, *typedef.MapType:
+		return false
+	case *typedef.UDTType:
+		return t.Frozen
+	default:
+		return true
+	}
 }
 
 func genSinglePartitionQuery(
@@ -19,6 +19,9 @@ import (
 	"path"
 	"testing"
 
+	"github.com/scylladb/gocqlx/v2/qb"
+
+	"github.com/scylladb/gemini/pkg/typedef"
 	"github.com/scylladb/gemini/pkg/utils"
 )
 
@@ -241,3 +244,24 @@ func BenchmarkGenSingleIndexQuery(t *testing.B) {
 			})
 	}
 }
+
+func TestSelectWriteTimes(t *testing.T) {
+	t.Parallel()
+	table := &typedef.Table{
+		Name:           "table1",
+		PartitionKeys:  typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+		ClusteringKeys: typedef.Columns{{Name: "ck0", Type: typedef.TYPE_INT}},
+		Columns: typedef.Columns{
+			{Name: "col0", Type: typedef.TYPE_TEXT},
+			{Name: "col1", Type: &typedef.BagType{ComplexType: typedef.TYPE_SET, ValueType: typedef.TYPE_INT}},
+			{Name: "col2", Type: &typedef.TupleType{ValueTypes: []typedef.SimpleType{typedef.TYPE_INT}, Frozen: true}},
+		},
+	}
+	stmt := &typedef.Stmt{StmtCache: &typedef.StmtCache{Query: qb.Select("ks1.table1").Where(qb.Eq("pk0"))}}
+	selectWriteTimes(stmt, table, -1)
+	query, _ := stmt.Query.ToCql()
+	expected := "SELECT pk0,ck0,col0,col1,col2,WRITETIME(col0),TTL(col0),WRITETIME(col2),TTL(col2) FROM ks1.table1 WHERE pk0=? "
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+}
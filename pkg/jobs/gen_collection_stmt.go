@@ -0,0 +1,118 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"golang.org/x/exp/rand"
+
+	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// collectionUpdates returns the kinds of collection updates that apply to
+// the table, none if it has no non-frozen collection.
+func collectionUpdates(t *typedef.Table) []typedef.StatementCacheType {
+	if len(t.Columns.Collections()) == 0 {
+		return nil
+	}
+	out := []typedef.StatementCacheType{typedef.CacheUpdateCollectionAdd, typedef.CacheUpdateCollectionRemove, typedef.CacheUpdateCollection}
+	if len(t.Columns.Lists()) > 0 {
+		out = append(out, typedef.CacheUpdateListPrepend, typedef.CacheUpdateListElement)
+	}
+	if len(t.Columns.Maps()) > 0 {
+		out = append(out, typedef.CacheUpdateMapElement)
+	}
+	return out
+}
+
+// genUpdateCollectionStmt updates the elements of the non-frozen collections
+// of a row with a kind of update drawn among the ones of the table. The
+// elements of lists are set on a row known to hold them, the elements are
+// prepended to the lists of a new row instead if there is none.
+func genUpdateCollectionStmt(
+	_ *typedef.Schema,
+	t *typedef.Table,
+	g generators.GeneratorInterface,
+	valuesWithToken *typedef.ValueWithToken,
+	r *rand.Rand,
+	p *typedef.PartitionRangeConfig,
+) (*typedef.Stmt, error) {
+	kinds := collectionUpdates(t)
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	kind := kinds[r.Intn(len(kinds))]
+	if kind == typedef.CacheUpdateListElement {
+		if stmt := genListElementStmt(t, g.Lists().Take(r), r, p); stmt != nil {
+			g.GiveOld(valuesWithToken)
+			return stmt, nil
+		}
+		kind = typedef.CacheUpdateListPrepend
+	}
+	return genCollectionStmt(t, kind, valuesWithToken, r, p), nil
+}
+
+// genListElementStmt sets an element of each list of the row at an index
+// drawn below the length of the list, it returns nil if the row is nil or
+// does not know all the lists of the table.
+func genListElementStmt(t *typedef.Table, row *typedef.ListRow, r *rand.Rand, p *typedef.PartitionRangeConfig) *typedef.Stmt {
+	if row == nil {
+		return nil
+	}
+	stmtCache := t.GetQueryCache(typedef.CacheUpdateListElement)
+	lists := t.Columns.Lists()
+	values := make(typedef.Values, 0, 2*lists.LenValues()+t.PartitionKeys.LenValues()+t.ClusteringKeys.LenValues())
+	for _, col := range lists {
+		n := row.Lengths[col.Name]
+		if n == 0 {
+			return nil
+		}
+		values = append(values, int32(r.Intn(n)))
+		values = appendValue(col.Type.(*typedef.BagType).ValueType, r, p, values)
+	}
+	values = values.CopyFrom(row.Partition.Value)
+	values = values.CopyFrom(row.Clustering)
+	return &typedef.Stmt{
+		StmtCache:       stmtCache,
+		ValuesWithToken: row.Partition,
+		Values:          values,
+		// Setting elements keeps the lengths of the lists.
+		ListRow: row,
+	}
+}
+
+func genCollectionStmt(
+	t *typedef.Table,
+	kind typedef.StatementCacheType,
+	valuesWithToken *typedef.ValueWithToken,
+	r *rand.Rand,
+	p *typedef.PartitionRangeConfig,
+) *typedef.Stmt {
+	stmtCache := t.GetQueryCache(kind)
+	columnTypes := stmtCache.Types[:len(stmtCache.Types)-t.PartitionKeys.Len()-t.ClusteringKeys.Len()]
+	values := make(typedef.Values, 0, len(stmtCache.Types))
+	for _, typ := range columnTypes {
+		values = appendValue(typ, r, p, values)
+	}
+	values = values.CopyFrom(valuesWithToken.Value)
+	for _, ck := range t.ClusteringKeys {
+		values = appendValue(ck.Type, r, p, values)
+	}
+	return &typedef.Stmt{
+		StmtCache:       stmtCache,
+		ValuesWithToken: valuesWithToken,
+		Values:          values,
+	}
+}
@@ -45,6 +45,7 @@ var (
 		"col1":   {TYPE_DATE},
 		"col5":   {TYPE_ASCII, TYPE_DATE, TYPE_BLOB, TYPE_BIGINT, TYPE_FLOAT},
 		"col5c":  {TYPE_ASCII, &mapType, TYPE_BLOB, &tupleType, TYPE_FLOAT},
+		"col3cl": {&listType, &setType, &intMapType},
 		"col1cr": {&counterType},
 		"col3cr": {&counterType, &counterType, &counterType},
 		"colAll": {
@@ -71,6 +72,9 @@ var (
 	counterType CounterType
 	tupleType   TupleType
 	mapType     MapType
+	listType    = BagType{ComplexType: TYPE_LIST, ValueType: TYPE_INT}
+	setType     = BagType{ComplexType: TYPE_SET, ValueType: TYPE_TEXT}
+	intMapType  = MapType{ComplexType: TYPE_MAP, KeyType: TYPE_INT, ValueType: TYPE_TEXT}
 
 	updateExpected = flag.Bool("update-expected", false, "make test to update expected results")
 )
@@ -103,6 +107,36 @@ var (
 		"pk3_ck3_col3cr",
 	}
 
+	genDeleteColumnsStmtCases = []string{
+		"pk1_ck0_col1",
+		"pk1_ck1_col1",
+		"pk3_ck3_col5",
+		"pk1_ck1_col3cl",
+		"pk1_ck1_col1cr",
+	}
+
+	genBatchStmtCases = []string{
+		"pk1_ck0_col0",
+		"pk1_ck1_col1",
+		"pk3_ck3_col5",
+		"pk1_ck1_col1cr",
+		"pk3_ck3_col3cr",
+	}
+
+	genTTLStmtCases = []string{
+		"pk1_ck0_col1",
+		"pk1_ck1_col1",
+		"pk3_ck3_col5",
+		"pk1_ck1_col3cl",
+		"pk1_ck1_col1cr",
+	}
+
+	genUpdateCollectionStmtCases = []string{
+		"pk1_ck0_col3cl",
+		"pk1_ck1_col3cl",
+		"pk3_ck3_col3cl",
+	}
+
 	genDeleteStmtCases = []string{
 		"pk1_ck0_col1",
 		"pk1_ck1_col1",
@@ -24,18 +24,17 @@ import (
 	"github.com/scylladb/gemini/pkg/builders"
 	"github.com/scylladb/gemini/pkg/generators"
 	"github.com/scylladb/gemini/pkg/typedef"
+	"github.com/scylladb/gemini/pkg/workload"
 )
 
-func GenDDLStmt(s *typedef.Schema, t *typedef.Table, r *rand.Rand, _ *typedef.PartitionRangeConfig, sc *typedef.SchemaConfig) (*typedef.Stmts, error) {
-	maxVariant := 1
+func GenDDLStmt(s *typedef.Schema, t *typedef.Table, r *rand.Rand, p *typedef.PartitionRangeConfig, sc *typedef.SchemaConfig) (*typedef.Stmts, error) {
 	validCols := t.ValidColumnsForDelete()
-	if validCols.Len() > 0 {
-		maxVariant = 2
-	}
-	switch n := r.Intn(maxVariant + 2); n {
-	// case 0: // Alter column not supported in Cassandra from 3.0.11
-	//	return t.alterColumn(s.Keyspace.Name)
-	case 2:
+	kind := p.Workload.SchemaChange(r, func(kind string) bool {
+		return kind != workload.DropColumn || validCols.Len() > 0
+	})
+	switch kind {
+	// Alter column not supported in Cassandra from 3.0.11
+	case workload.DropColumn:
 		return genDropColumnStmt(t, s.Keyspace.Name, validCols.Random())
 	default:
 		column := typedef.ColumnDef{Name: generators.GenColumnName("col", len(t.Columns)+1), Type: generators.GenColumnType(len(t.Columns)+1, sc)}
@@ -24,8 +24,11 @@ import (
 
 	"github.com/scylladb/gemini/pkg/generators"
 	"github.com/scylladb/gemini/pkg/typedef"
+	"github.com/scylladb/gemini/pkg/workload"
 )
 
+// GenMutateStmt generates a mutation of a kind drawn from the workload
+// profile, inserts only unless deletes is set.
 func GenMutateStmt(s *typedef.Schema, t *typedef.Table, g generators.GeneratorInterface, r *rand.Rand, p *typedef.PartitionRangeConfig, deletes bool) (*typedef.Stmt, error) {
 	t.RLock()
 	defer t.RUnlock()
@@ -34,27 +37,47 @@ func GenMutateStmt(s *typedef.Schema, t *typedef.Table, g generators.GeneratorIn
 	if valuesWithToken == nil {
 		return nil, nil
 	}
-	useLWT := false
-	if p.UseLWT && r.Uint32()%10 == 0 {
-		useLWT = true
-	}
-
-	if !deletes {
-		return genInsertOrUpdateStmt(s, t, valuesWithToken, r, p, useLWT)
-	}
-	switch n := r.Intn(1000); n {
-	case 10, 100:
-		return genDeleteRows(s, t, valuesWithToken, r, p)
-	default:
-		switch r.Intn(2) {
-		case 0:
-			if t.KnownIssues[typedef.KnownIssuesJSONWithTuples] {
-				return genInsertOrUpdateStmt(s, t, valuesWithToken, r, p, useLWT)
-			}
-			return genInsertJSONStmt(s, t, valuesWithToken, r, p)
+	kind := p.Workload.Mutation(r, func(kind string) bool {
+		switch kind {
+		case workload.DDL:
+			return false
+		case workload.Insert, workload.InsertIfNotExists:
+			return true
+		case workload.UpdateCollection:
+			return deletes && len(t.Columns.Collections()) > 0
+		case workload.DeleteRange:
+			return deletes && len(t.ClusteringKeys) > 0
+		case workload.DeleteColumns:
+			return deletes && len(t.Columns.NonCounters()) > 0
 		default:
-			return genInsertOrUpdateStmt(s, t, valuesWithToken, r, p, useLWT)
+			return deletes
+		}
+	})
+	switch kind {
+	case workload.Delete:
+		return genDeleteRows(s, t, valuesWithToken, r, p)
+	case workload.DeletePartition:
+		return genDeletePartition(s, t, valuesWithToken, r, p)
+	case workload.DeleteRow:
+		return genDeleteRow(s, t, valuesWithToken, r, p)
+	case workload.DeleteRange:
+		return genDeleteRange(s, t, valuesWithToken, r, p)
+	case workload.DeleteColumns:
+		return genDeleteColumns(s, t, valuesWithToken, r, p)
+	case workload.UpdateCollection:
+		return genUpdateCollectionStmt(s, t, g, valuesWithToken, r, p)
+	case workload.UnloggedBatch, workload.LoggedBatch:
+		return genBatchStmt(s, t, g, valuesWithToken, r, p, kind == workload.LoggedBatch)
+	case workload.InsertJSON:
+		if t.KnownIssues[typedef.KnownIssuesJSONWithTuples] {
+			return genInsertOrUpdateStmt(s, t, valuesWithToken, r, p, false)
 		}
+		return genInsertJSONStmt(s, t, valuesWithToken, r, p)
+	case workload.InsertIfNotExists:
+		// LWT inserts are only generated with --use-lwt.
+		return genInsertOrUpdateStmt(s, t, valuesWithToken, r, p, p.UseLWT)
+	default:
+		return genInsertOrUpdateStmt(s, t, valuesWithToken, r, p, false)
 	}
 }
 
@@ -83,11 +106,11 @@ func genUpdateStmt(_ *typedef.Schema, t *typedef.Table, valuesWithToken *typedef
 	for _, ck := range t.ClusteringKeys {
 		values = appendValue(ck.Type, r, p, values)
 	}
-	return &typedef.Stmt{
+	return withTTL(t, &typedef.Stmt{
 		StmtCache:       stmtCache,
 		ValuesWithToken: valuesWithToken,
 		Values:          values,
-	}, nil
+	}, r, p), nil
 }
 
 func genInsertStmt(
@@ -103,19 +126,34 @@ func genInsertStmt(
 	for _, ck := range t.ClusteringKeys {
 		values = append(values, ck.Type.GenValue(r, p)...)
 	}
+	lengths := make(map[string]int)
 	for _, col := range t.Columns {
-		values = append(values, col.Type.GenValue(r, p)...)
+		value := col.Type.GenValue(r, p)
+		if bt, ok := col.Type.(*typedef.BagType); ok && !bt.Frozen && bt.ComplexType == typedef.TYPE_LIST {
+			lengths[col.Name] = len(value[0].([]interface{}))
+		}
+		values = append(values, value...)
 	}
 	cacheType := typedef.CacheInsert
 	if useLWT {
 		cacheType = typedef.CacheInsertIfNotExists
 	}
 	stmtCache := t.GetQueryCache(cacheType)
-	return &typedef.Stmt{
+	stmt := &typedef.Stmt{
 		StmtCache:       stmtCache,
 		ValuesWithToken: valuesWithToken,
 		Values:          values,
-	}, nil
+	}
+	// A conditional insert may leave the row as it was.
+	if len(lengths) > 0 && !useLWT {
+		ckStart := len(valuesWithToken.Value)
+		stmt.ListRow = &typedef.ListRow{
+			Partition:  valuesWithToken,
+			Clustering: values[ckStart : ckStart+t.ClusteringKeys.LenValues()].Copy(),
+			Lengths:    lengths,
+		}
+	}
+	return withTTL(t, stmt, r, p), nil
 }
 
 func genInsertJSONStmt(
@@ -180,6 +218,125 @@ func genDeleteRows(_ *typedef.Schema, t *typedef.Table, valuesWithToken *typedef
 	}, nil
 }
 
+func genDeletePartition(_ *typedef.Schema, t *typedef.Table, valuesWithToken *typedef.ValueWithToken, _ *rand.Rand, _ *typedef.PartitionRangeConfig) (*typedef.Stmt, error) {
+	return &typedef.Stmt{
+		StmtCache:       t.GetQueryCache(typedef.CacheDeletePartition),
+		ValuesWithToken: valuesWithToken,
+		Values:          valuesWithToken.Value.Copy(),
+	}, nil
+}
+
+func genDeleteRow(_ *typedef.Schema, t *typedef.Table, valuesWithToken *typedef.ValueWithToken, r *rand.Rand, p *typedef.PartitionRangeConfig) (*typedef.Stmt, error) {
+	values := make(typedef.Values, 0, t.PartitionKeys.LenValues()+t.ClusteringKeys.LenValues())
+	values = values.CopyFrom(valuesWithToken.Value)
+	for _, ck := range t.ClusteringKeys {
+		values = appendValue(ck.Type, r, p, values)
+	}
+	return &typedef.Stmt{
+		StmtCache:       t.GetQueryCache(typedef.CacheDeleteRow),
+		ValuesWithToken: valuesWithToken,
+		Values:          values,
+	}, nil
+}
+
+// genDeleteRange deletes the rows of a range of a clustering key following
+// a prefix of the clustering keys of random length, the range is bounded on
+// one side or both and each bound is open or closed.
+func genDeleteRange(s *typedef.Schema, t *typedef.Table, valuesWithToken *typedef.ValueWithToken, r *rand.Rand, p *typedef.PartitionRangeConfig) (*typedef.Stmt, error) {
+	if len(t.ClusteringKeys) == 0 {
+		return genDeletePartition(s, t, valuesWithToken, r, p)
+	}
+	builder := qb.Delete(s.Keyspace.Name + "." + t.Name)
+	types := make([]typedef.Type, 0, len(t.PartitionKeys)+len(t.ClusteringKeys)+1)
+	for _, pk := range t.PartitionKeys {
+		builder = builder.Where(qb.Eq(pk.Name))
+		types = append(types, pk.Type)
+	}
+	values := valuesWithToken.Value.Copy()
+	prefix := r.Intn(len(t.ClusteringKeys))
+	for _, ck := range t.ClusteringKeys[:prefix] {
+		builder = builder.Where(qb.Eq(ck.Name))
+		types = append(types, ck.Type)
+		values = appendValue(ck.Type, r, p, values)
+	}
+	ck := t.ClusteringKeys[prefix]
+	bounds := r.Intn(3)
+	if bounds != 1 {
+		lower := qb.Gt(ck.Name)
+		if r.Intn(2) == 0 {
+			lower = qb.GtOrEq(ck.Name)
+		}
+		builder = builder.Where(lower)
+		types = append(types, ck.Type)
+		values = appendValue(ck.Type, r, p, values)
+	}
+	if bounds != 0 {
+		upper := qb.Lt(ck.Name)
+		if r.Intn(2) == 0 {
+			upper = qb.LtOrEq(ck.Name)
+		}
+		builder = builder.Where(upper)
+		types = append(types, ck.Type)
+		values = appendValue(ck.Type, r, p, values)
+	}
+	return &typedef.Stmt{
+		StmtCache: &typedef.StmtCache{
+			Query:     builder,
+			Types:     types,
+			QueryType: typedef.DeleteRangeStatementType,
+		},
+		ValuesWithToken: valuesWithToken,
+		Values:          values,
+	}, nil
+}
+
+// genDeleteColumns deletes some of the columns of a row and the values of
+// keys of its non-frozen maps.
+func genDeleteColumns(s *typedef.Schema, t *typedef.Table, valuesWithToken *typedef.ValueWithToken, r *rand.Rand, p *typedef.PartitionRangeConfig) (*typedef.Stmt, error) {
+	columns := t.Columns.NonCounters()
+	if len(columns) == 0 {
+		return genDeleteRow(s, t, valuesWithToken, r, p)
+	}
+	var (
+		names  []string
+		types  []typedef.Type
+		values typedef.Values
+	)
+	first := r.Intn(len(columns))
+	for i, col := range columns {
+		if i != first && r.Intn(2) == 0 {
+			continue
+		}
+		if mt, ok := col.Type.(*typedef.MapType); ok && !mt.Frozen && r.Intn(2) == 0 {
+			names = append(names, col.Name+"[?]")
+			types = append(types, mt.KeyType)
+			values = appendValue(mt.KeyType, r, p, values)
+			continue
+		}
+		names = append(names, col.Name)
+	}
+	builder := qb.Delete(s.Keyspace.Name + "." + t.Name).Columns(names...)
+	for _, pk := range t.PartitionKeys {
+		builder = builder.Where(qb.Eq(pk.Name))
+		types = append(types, pk.Type)
+	}
+	values = append(values, valuesWithToken.Value...)
+	for _, ck := range t.ClusteringKeys {
+		builder = builder.Where(qb.Eq(ck.Name))
+		types = append(types, ck.Type)
+		values = appendValue(ck.Type, r, p, values)
+	}
+	return &typedef.Stmt{
+		StmtCache: &typedef.StmtCache{
+			Query:     builder,
+			Types:     types,
+			QueryType: typedef.DeleteColumnsStatementType,
+		},
+		ValuesWithToken: valuesWithToken,
+		Values:          values,
+	}, nil
+}
+
 func convertForJSON(vType typedef.Type, value interface{}) interface{} {
 	switch vType {
 	case typedef.TYPE_BLOB:
@@ -18,7 +18,9 @@ package jobs
 import (
 	"path"
 	"testing"
+	"time"
 
+	"github.com/scylladb/gemini/pkg/typedef"
 	"github.com/scylladb/gemini/pkg/utils"
 )
 
@@ -51,6 +53,52 @@ func TestGenUpdateStmt(t *testing.T) {
 	})
 }
 
+func TestGenInsertTTLStmt(t *testing.T) {
+	RunStmtTest(t, path.Join(mutateDataPath, "insert_ttl.json"), genTTLStmtCases, func(t *testing.T, caseName string, expected *expectedStore) {
+		schema, prc, gen, rnd, opts := getAllForTestStmt(t, caseName)
+		prc.TTLRatio, prc.MaxTTL = 1, time.Minute
+		stmt, err := genInsertOrUpdateStmt(schema, schema.Tables[0], gen.Get(), rnd, prc, opts.useLWT)
+		validateStmt(t, stmt, err)
+		expected.CompareOrStore(t, caseName, stmt)
+	})
+}
+
+func TestExpiringWrites(t *testing.T) {
+	t.Parallel()
+	pk := typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}}
+	tables := map[string]*typedef.Table{
+		"plain":       {PartitionKeys: pk, Columns: typedef.Columns{{Name: "col0", Type: typedef.TYPE_TEXT}}},
+		"counters":    {PartitionKeys: pk, Columns: typedef.Columns{{Name: "col0", Type: &typedef.CounterType{}}}},
+		"collections": {PartitionKeys: pk, Columns: typedef.Columns{{Name: "col0", Type: &typedef.BagType{ComplexType: typedef.TYPE_LIST, ValueType: typedef.TYPE_INT}}}},
+	}
+	tests := []struct {
+		table       string
+		collections bool
+		want        bool
+	}{
+		{table: "plain", want: true},
+		{table: "counters", collections: true},
+		{table: "collections"},
+		{table: "collections", collections: true, want: true},
+	}
+	for _, test := range tests {
+		p := &typedef.PartitionRangeConfig{ExpiringCollections: test.collections}
+		if got := expiringWrites(tables[test.table], p); got != test.want {
+			t.Errorf("%s with expiring collections %v: expected %v, got %v", test.table, test.collections, test.want, got)
+		}
+	}
+}
+
+func TestGenUpdateTTLStmt(t *testing.T) {
+	RunStmtTest(t, path.Join(mutateDataPath, "update_ttl.json"), genTTLStmtCases, func(t *testing.T, caseName string, expected *expectedStore) {
+		schema, prc, gen, rnd, _ := getAllForTestStmt(t, caseName)
+		prc.TTLRatio, prc.MaxTTL = 1, time.Minute
+		stmt, err := genUpdateStmt(schema, schema.Tables[0], gen.Get(), rnd, prc)
+		validateStmt(t, stmt, err)
+		expected.CompareOrStore(t, caseName, stmt)
+	})
+}
+
 func TestGenDeleteRows(t *testing.T) {
 	RunStmtTest(t, path.Join(mutateDataPath, "delete.json"), genDeleteStmtCases, func(t *testing.T, caseName string, expected *expectedStore) {
 		schema, prc, gen, rnd, _ := getAllForTestStmt(t, caseName)
@@ -60,6 +108,96 @@ func TestGenDeleteRows(t *testing.T) {
 	})
 }
 
+func TestGenUpdateCollectionStmt(t *testing.T) {
+	RunStmtTest(t, path.Join(mutateDataPath, "update_collection.json"), genUpdateCollectionStmtCases,
+		func(t *testing.T, caseName string, expected *expectedStore) {
+			schema, prc, gen, rnd, _ := getAllForTestStmt(t, caseName)
+			table := schema.Tables[0]
+			stmts := &typedef.Stmts{QueryType: typedef.UpdateStatementType}
+			for _, kind := range collectionUpdates(table) {
+				var stmt *typedef.Stmt
+				if kind == typedef.CacheUpdateListElement {
+					// The elements are set on a row inserted with lists.
+					insert, err := genInsertStmt(schema, table, gen.Get(), rnd, prc, false)
+					validateStmt(t, insert, err)
+					stmt = genListElementStmt(table, insert.ListRow, rnd, prc)
+					if stmt == nil || stmt.ListRow != insert.ListRow {
+						t.Fatalf("expected the elements of the lists of %v to be set", insert.ListRow)
+					}
+					if index := stmt.Values[0].(int32); int(index) >= insert.ListRow.Lengths["col0"] {
+						t.Errorf("index %d out of the list of %d elements", index, insert.ListRow.Lengths["col0"])
+					}
+				} else {
+					stmt = genCollectionStmt(table, kind, gen.Get(), rnd, prc)
+				}
+				appends := kind == typedef.CacheUpdateListPrepend || kind == typedef.CacheUpdateCollectionAdd && len(table.Columns.Lists()) > 0
+				if stmt.NotIdempotent != appends {
+					t.Errorf("%s: expected not idempotent %v", kind.ToString(), appends)
+				}
+				stmts.List = append(stmts.List, stmt)
+			}
+			validateStmt(t, stmts, nil)
+			expected.CompareOrStore(t, caseName, stmts)
+		})
+}
+
+func TestGenUnloggedBatchStmt(t *testing.T) {
+	RunStmtTest(t, path.Join(mutateDataPath, "unlogged_batch.json"), genBatchStmtCases, func(t *testing.T, caseName string, expected *expectedStore) {
+		schema, prc, gen, rnd, _ := getAllForTestStmt(t, caseName)
+		stmt, err := genBatchStmt(schema, schema.Tables[0], gen, gen.Get(), rnd, prc, false)
+		validateStmt(t, stmt, err)
+		expected.CompareOrStore(t, caseName, stmt)
+	})
+}
+
+func TestGenLoggedBatchStmt(t *testing.T) {
+	RunStmtTest(t, path.Join(mutateDataPath, "logged_batch.json"), genBatchStmtCases, func(t *testing.T, caseName string, expected *expectedStore) {
+		schema, prc, gen, rnd, _ := getAllForTestStmt(t, caseName)
+		stmt, err := genBatchStmt(schema, schema.Tables[0], gen, gen.Get(), rnd, prc, true)
+		validateStmt(t, stmt, err)
+		if len(stmt.Partitions()) < minBatchStmts {
+			t.Errorf("expected a batch of several partitions, got %d", len(stmt.Partitions()))
+		}
+		expected.CompareOrStore(t, caseName, stmt)
+	})
+}
+
+func TestGenDeletePartition(t *testing.T) {
+	RunStmtTest(t, path.Join(mutateDataPath, "delete_partition.json"), genDeleteStmtCases, func(t *testing.T, caseName string, expected *expectedStore) {
+		schema, prc, gen, rnd, _ := getAllForTestStmt(t, caseName)
+		stmt, err := genDeletePartition(schema, schema.Tables[0], gen.Get(), rnd, prc)
+		validateStmt(t, stmt, err)
+		expected.CompareOrStore(t, caseName, stmt)
+	})
+}
+
+func TestGenDeleteRow(t *testing.T) {
+	RunStmtTest(t, path.Join(mutateDataPath, "delete_row.json"), genDeleteStmtCases, func(t *testing.T, caseName string, expected *expectedStore) {
+		schema, prc, gen, rnd, _ := getAllForTestStmt(t, caseName)
+		stmt, err := genDeleteRow(schema, schema.Tables[0], gen.Get(), rnd, prc)
+		validateStmt(t, stmt, err)
+		expected.CompareOrStore(t, caseName, stmt)
+	})
+}
+
+func TestGenDeleteRange(t *testing.T) {
+	RunStmtTest(t, path.Join(mutateDataPath, "delete_range.json"), genDeleteStmtCases, func(t *testing.T, caseName string, expected *expectedStore) {
+		schema, prc, gen, rnd, _ := getAllForTestStmt(t, caseName)
+		stmt, err := genDeleteRange(schema, schema.Tables[0], gen.Get(), rnd, prc)
+		validateStmt(t, stmt, err)
+		expected.CompareOrStore(t, caseName, stmt)
+	})
+}
+
+func TestGenDeleteColumns(t *testing.T) {
+	RunStmtTest(t, path.Join(mutateDataPath, "delete_columns.json"), genDeleteColumnsStmtCases, func(t *testing.T, caseName string, expected *expectedStore) {
+		schema, prc, gen, rnd, _ := getAllForTestStmt(t, caseName)
+		stmt, err := genDeleteColumns(schema, schema.Tables[0], gen.Get(), rnd, prc)
+		validateStmt(t, stmt, err)
+		expected.CompareOrStore(t, caseName, stmt)
+	})
+}
+
 func BenchmarkGenInsertStmt(t *testing.B) {
 	utils.SetUnderTest()
 	for idx := range genInsertStmtCases {
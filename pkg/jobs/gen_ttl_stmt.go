@@ -0,0 +1,76 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"math"
+	"time"
+
+	"github.com/scylladb/gocqlx/v2/qb"
+	"golang.org/x/exp/rand"
+
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// expiringWrites reports whether the inserts and updates of the table may
+// be written with a TTL. Counters can not expire, and the elements of
+// non-frozen collections expire separately, which the model store does not
+// keep track of, see p.ExpiringCollections.
+func expiringWrites(t *typedef.Table, p *typedef.PartitionRangeConfig) bool {
+	return !t.IsCounterTable() && (p.ExpiringCollections || len(t.Columns.Collections()) == 0)
+}
+
+// withTTL writes a fraction p.TTLRatio of the inserts and updates with a
+// TTL, the statement is returned as is otherwise.
+func withTTL(t *typedef.Table, stmt *typedef.Stmt, r *rand.Rand, p *typedef.PartitionRangeConfig) *typedef.Stmt {
+	if p.TTLRatio <= 0 || !expiringWrites(t, p) || r.Float64() >= p.TTLRatio {
+		return stmt
+	}
+	ttl := genTTL(r, p.MaxTTL)
+	// The cached builders are shared, the TTL is set on a copy.
+	var query qb.Builder
+	switch b := stmt.Query.(type) {
+	case *qb.InsertBuilder:
+		builder := *b
+		query = builder.TTL(ttl)
+	case *qb.UpdateBuilder:
+		builder := *b
+		query = builder.TTL(ttl)
+	default:
+		return stmt
+	}
+	out := *stmt
+	// The lists of an expiring row are not known to hold elements for long.
+	out.ListRow = nil
+	out.StmtCache = &typedef.StmtCache{
+		Query:         query,
+		Types:         stmt.Types,
+		QueryType:     stmt.QueryType,
+		NotIdempotent: stmt.NotIdempotent,
+		LenValue:      stmt.LenValue,
+	}
+	return &out
+}
+
+// genTTL draws a TTL between 1s and maxTTL from a log-uniform distribution,
+// so that TTLs of a few seconds, which expire while gemini runs, are as
+// likely as long ones.
+func genTTL(r *rand.Rand, maxTTL time.Duration) time.Duration {
+	if maxTTL <= time.Second {
+		return time.Second
+	}
+	seconds := math.Exp(r.Float64() * math.Log(maxTTL.Seconds()))
+	return time.Duration(seconds) * time.Second
+}
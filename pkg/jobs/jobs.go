@@ -19,11 +19,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/metrics"
+	"github.com/scylladb/gemini/pkg/routingkey"
 	"github.com/scylladb/gemini/pkg/store"
 	"github.com/scylladb/gemini/pkg/typedef"
+	"github.com/scylladb/gemini/pkg/workload"
 
 	"github.com/scylladb/gemini/pkg/joberror"
 	"github.com/scylladb/gemini/pkg/status"
@@ -63,7 +67,7 @@ type List struct {
 type job struct {
 	function func(
 		context.Context,
-		<-chan time.Duration,
+		*Pacer,
 		*typedef.Schema,
 		typedef.SchemaConfig,
 		*typedef.Table,
@@ -107,7 +111,7 @@ func (l List) Run(
 	schema *typedef.Schema,
 	schemaConfig typedef.SchemaConfig,
 	s store.Store,
-	pump <-chan time.Duration,
+	pacer *Pacer,
 	generators []*generators.Generator,
 	globalStatus *status.GlobalStatus,
 	logger *zap.Logger,
@@ -125,11 +129,16 @@ func (l List) Run(
 	})
 
 	partitionRangeConfig := typedef.PartitionRangeConfig{
-		MaxBlobLength:   schemaConfig.MaxBlobLength,
-		MinBlobLength:   schemaConfig.MinBlobLength,
-		MaxStringLength: schemaConfig.MaxStringLength,
-		MinStringLength: schemaConfig.MinStringLength,
-		UseLWT:          schemaConfig.UseLWT,
+		MaxBlobLength:       schemaConfig.MaxBlobLength,
+		MinBlobLength:       schemaConfig.MinBlobLength,
+		MaxStringLength:     schemaConfig.MaxStringLength,
+		MinStringLength:     schemaConfig.MinStringLength,
+		UseLWT:              schemaConfig.UseLWT,
+		CheckWriteTimes:     schemaConfig.CheckWriteTimes,
+		TTLRatio:            schemaConfig.TTLRatio,
+		MaxTTL:              schemaConfig.MaxTTL,
+		ExpiringCollections: schemaConfig.ExpiringCollections,
+		Workload:            schemaConfig.Workload,
 	}
 	logger.Info("start jobs")
 	for j := range schema.Tables {
@@ -140,7 +149,7 @@ func (l List) Run(
 				jobF := l.jobs[idx].function
 				r := rand.New(rand.NewSource(seed))
 				g.Go(func() error {
-					return jobF(gCtx, pump, schema, schemaConfig, table, s, r, &partitionRangeConfig, gen, globalStatus, logger, stopFlag, failFast, verbose)
+					return jobF(gCtx, pacer, schema, schemaConfig, table, s, r, &partitionRangeConfig, gen, globalStatus, logger, stopFlag, failFast, verbose)
 				})
 			}
 		}
@@ -149,10 +158,10 @@ func (l List) Run(
 }
 
 // mutationJob continuously applies mutations against the database
-// for as long as the pump is active.
+// at the pace of the pacer.
 func mutationJob(
 	ctx context.Context,
-	pump <-chan time.Duration,
+	pacer *Pacer,
 	schema *typedef.Schema,
 	schemaCfg typedef.SchemaConfig,
 	table *typedef.Table,
@@ -175,15 +184,11 @@ func mutationJob(
 		if stopFlag.IsHardOrSoft() {
 			return nil
 		}
-		select {
-		case <-ctx.Done():
+		if err := pacer.waitMutation(ctx, table.Name); err != nil {
 			logger.Debug("mutation job terminated")
 			return nil
-		case hb := <-pump:
-			time.Sleep(hb)
 		}
-		ind := r.Intn(1000000)
-		if ind%100000 == 0 {
+		if p.Workload.Mutation(r, workload.All) == workload.DDL {
 			_ = ddl(ctx, schema, schemaConfig, table, s, r, p, globalStatus, logger, verbose)
 		} else {
 			_ = mutation(ctx, schema, schemaConfig, table, s, r, p, g, globalStatus, true, logger)
@@ -196,10 +201,10 @@ func mutationJob(
 }
 
 // validationJob continuously applies validations against the database
-// for as long as the pump is active.
+// at the pace of the pacer.
 func validationJob(
 	ctx context.Context,
-	pump <-chan time.Duration,
+	pacer *Pacer,
 	schema *typedef.Schema,
 	schemaCfg typedef.SchemaConfig,
 	table *typedef.Table,
@@ -223,11 +228,8 @@ func validationJob(
 		if stopFlag.IsHardOrSoft() {
 			return nil
 		}
-		select {
-		case <-ctx.Done():
+		if err := pacer.waitValidation(ctx, table.Name); err != nil {
 			return nil
-		case hb := <-pump:
-			time.Sleep(hb)
 		}
 		stmt := GenCheckStmt(schema, table, g, r, p)
 		if stmt == nil {
@@ -241,13 +243,24 @@ func validationJob(
 			globalStatus.ReadOps.Add(1)
 		case errors.Is(err, context.Canceled):
 			return nil
+		case errors.Is(err, errTaintedPartition):
+			globalStatus.SkippedReads.Add(1)
 		default:
-			globalStatus.AddReadError(&joberror.JobError{
-				Timestamp: time.Now(),
-				StmtType:  stmt.QueryType.ToString(),
-				Message:   "Validation failed: " + err.Error(),
-				Query:     stmt.PrettyCQL(),
-			})
+			for _, se := range systemErrors(err) {
+				jobErr := &joberror.JobError{
+					Timestamp: time.Now(),
+					StmtType:  stmt.QueryType.ToString(),
+					Message:   "Validation failed: " + se.err.Error(),
+					Query:     stmt.PrettyCQL(),
+					System:    se.system,
+					Traces:    se.traces,
+				}
+				var validationErr *store.ValidationError
+				if errors.As(se.err, &validationErr) {
+					jobErr.Mismatches = validationErr.Mismatches
+				}
+				globalStatus.AddReadError(jobErr)
+			}
 		}
 
 		if failFast && globalStatus.HasErrors() {
@@ -258,10 +271,10 @@ func validationJob(
 }
 
 // warmupJob continuously applies mutations against the database
-// for as long as the pump is active or the supplied duration expires.
+// at the pace of the pacer until the supplied duration expires.
 func warmupJob(
 	ctx context.Context,
-	_ <-chan time.Duration,
+	pacer *Pacer,
 	schema *typedef.Schema,
 	schemaCfg typedef.SchemaConfig,
 	table *typedef.Table,
@@ -284,11 +297,9 @@ func warmupJob(
 		if stopFlag.IsHardOrSoft() {
 			return nil
 		}
-		select {
-		case <-ctx.Done():
+		if err := pacer.waitMutation(ctx, table.Name); err != nil {
 			logger.Debug("warmup job terminated")
 			return nil
-		default:
 		}
 		// Do we care about errors during warmup?
 		_ = mutation(ctx, schema, schemaConfig, table, s, r, p, g, globalStatus, false, logger)
@@ -333,22 +344,29 @@ func ddl(
 		}
 		return nil
 	}
+	ctx = store.WithTarget(ctx, store.Target{Table: table.Name, Schema: true})
 	for _, ddlStmt := range ddlStmts.List {
 		if w := logger.Check(zap.DebugLevel, "ddl statement"); w != nil {
 			w.Write(zap.String("pretty_cql", ddlStmt.PrettyCQL()))
 		}
-		if err = s.Mutate(ctx, ddlStmt.Query); err != nil {
+		if err = s.Mutate(ctx, ddlStmt.Query); err != nil && !errors.Is(err, store.ErrOracleMutation) {
 			if errors.Is(err, context.Canceled) {
 				return nil
 			}
-			globalStatus.AddWriteError(&joberror.JobError{
-				Timestamp: time.Now(),
-				StmtType:  ddlStmts.QueryType.ToString(),
-				Message:   "DDL failed: " + err.Error(),
-				Query:     ddlStmt.PrettyCQL(),
-			})
+			metrics.DDLEvents.WithLabelValues(table.Name, ddlStmts.QueryType.ToString(), "failed").Inc()
+			for _, se := range systemErrors(err) {
+				globalStatus.AddWriteError(&joberror.JobError{
+					Timestamp: time.Now(),
+					StmtType:  ddlStmts.QueryType.ToString(),
+					Message:   "DDL failed: " + se.err.Error(),
+					Query:     ddlStmt.PrettyCQL(),
+					System:    se.system,
+					Traces:    se.traces,
+				})
+			}
 			return err
 		}
+		metrics.DDLEvents.WithLabelValues(table.Name, ddlStmts.QueryType.ToString(), "applied").Inc()
 		globalStatus.WriteOps.Add(1)
 	}
 	ddlStmts.PostStmtHook()
@@ -385,25 +403,51 @@ func mutation(
 		return err
 	}
 	mutateQuery := mutateStmt.Query
+	if mutateStmt.NotIdempotent {
+		mutateQuery = store.NotIdempotent(mutateQuery)
+	}
 	mutateValues := mutateStmt.Values
-	if mutateStmt.ValuesWithToken != nil {
-		defer func() {
-			g.GiveOld(mutateStmt.ValuesWithToken)
-		}()
+	partitions := mutateStmt.Partitions()
+	defer func() {
+		for _, v := range partitions {
+			g.GiveOld(v)
+		}
+	}()
+	target := store.Target{Table: table.Name}
+	if len(partitions) == 1 {
+		ctx = routingkey.NewContext(ctx, table, mutateStmt.ValuesWithToken.Value)
+		target.Token, target.HasToken = mutateStmt.ValuesWithToken.Token, true
 	}
+	ctx = store.WithTarget(ctx, target)
 	if w := logger.Check(zap.DebugLevel, "mutation statement"); w != nil {
 		w.Write(zap.String("pretty_cql", mutateStmt.PrettyCQL()))
 	}
-	if err = s.Mutate(ctx, mutateQuery, mutateValues...); err != nil {
+	err = s.Mutate(ctx, mutateQuery, mutateValues...)
+	g.Lists().Record(mutateStmt, err == nil)
+	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			return nil
 		}
-		globalStatus.AddWriteError(&joberror.JobError{
-			Timestamp: time.Now(),
-			StmtType:  mutateStmt.QueryType.ToString(),
-			Message:   "Mutation failed: " + err.Error(),
-			Query:     mutateStmt.PrettyCQL(),
-		})
+		oracleFailed := errors.Is(err, store.ErrOracleMutation)
+		// A statement the oracle rejects as invalid is applied nowhere.
+		if !oracleFailed || !errors.Is(err, store.ErrInvalidRequest) {
+			for _, v := range partitions {
+				taint(g, v, globalStatus, logger)
+			}
+		}
+		if oracleFailed {
+			return nil
+		}
+		for _, se := range systemErrors(err) {
+			globalStatus.AddWriteError(&joberror.JobError{
+				Timestamp: time.Now(),
+				StmtType:  mutateStmt.QueryType.ToString(),
+				Message:   "Mutation failed: " + se.err.Error(),
+				Query:     mutateStmt.PrettyCQL(),
+				System:    se.system,
+				Traces:    se.traces,
+			})
+		}
 	} else {
 		globalStatus.WriteOps.Add(1)
 	}
@@ -417,13 +461,20 @@ func validation(
 	s store.Store,
 	stmt *typedef.Stmt,
 	g *generators.Generator,
-	_ *status.GlobalStatus,
+	globalStatus *status.GlobalStatus,
 	logger *zap.Logger,
 ) error {
 	if stmt.ValuesWithToken != nil {
 		defer func() {
 			g.ReleaseToken(stmt.ValuesWithToken.Token)
 		}()
+		// Views and indexes are not partitioned like their base table.
+		if !stmt.QueryType.PossibleAsyncOperation() {
+			ctx = routingkey.NewContext(ctx, table, stmt.ValuesWithToken.Value)
+		}
+	}
+	if !untaint(ctx, sc, table, s, g, stmt.ValuesWithToken, globalStatus, logger) {
+		return errTaintedPartition
 	}
 	if w := logger.Check(zap.DebugLevel, "validation statement"); w != nil {
 		w.Write(zap.String("pretty_cql", stmt.PrettyCQL()))
@@ -449,6 +500,7 @@ func validation(
 			if attempt > 1 {
 				logger.Info(fmt.Sprintf("Validation successfully completed on %d attempt.", attempt))
 			}
+			metrics.Validations.WithLabelValues(table.Name, "success").Inc()
 			return nil
 		}
 		if errors.Is(err, context.Canceled) {
@@ -456,6 +508,9 @@ func validation(
 			// to skip logging part it is returned here
 			return err
 		}
+		if inTaintedPartitions(err, g) {
+			return errTaintedPartition
+		}
 		if attempt == maxAttempts {
 			break
 		}
@@ -471,6 +526,7 @@ func validation(
 			logger.Info(fmt.Sprintf("Retring failed validation stoped by done context. %d attempt from %d attempts. Error: %s", attempt, maxAttempts, err))
 			return nil
 		}
+		metrics.ValidationRetries.WithLabelValues(table.Name).Inc()
 		attempt++
 	}
 
@@ -479,6 +535,7 @@ func validation(
 	} else {
 		logger.Info(fmt.Sprintf("Validation failed. Error: %s", err))
 	}
+	metrics.Validations.WithLabelValues(table.Name, "failure").Inc()
 
 	return err
 }
@@ -491,3 +548,39 @@ func unWrapErr(err error) error {
 	}
 	return err
 }
+
+type systemError struct {
+	err    error
+	system string
+	// traces are the traces of the statement run again on the oracle and
+	// on the system, see store.TracedError.
+	traces []joberror.Trace
+}
+
+// systemErrors splits the error of a store operation into the errors of
+// each system under test, which is left empty if there is a single one.
+func systemErrors(err error) []systemError {
+	var traces []joberror.Trace
+	var traced *store.TracedError
+	if errors.As(err, &traced) {
+		traces = traced.Traces
+	}
+	var errs store.SystemErrors
+	if !errors.As(err, &errs) {
+		return []systemError{{err: err, traces: traces}}
+	}
+	out := make([]systemError, 0, len(errs))
+	for system, systemErr := range errs {
+		se := systemError{err: systemErr, system: system}
+		for _, t := range traces {
+			if t.System == system || t.System == "oracle" {
+				se.traces = append(se.traces, t)
+			}
+		}
+		out = append(out, se)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].system < out[j].system
+	})
+	return out
+}
@@ -0,0 +1,195 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/scylladb/gemini/pkg/ratelimit"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// shapeInterval is the interval the target rates follow their load shape
+// at.
+const shapeInterval = 100 * time.Millisecond
+
+// Rates are the target rates of the jobs in operations per second, 0 does
+// not limit them. Mutations and Validations are the rates of all the tables
+// together, TableMutations and TableValidations the rates of each table by
+// name, the rate of the empty name applying to the tables that are not
+// listed.
+type Rates struct {
+	TableMutations   map[string]float64
+	TableValidations map[string]float64
+	Mutations        float64
+	Validations      float64
+}
+
+// Limited reports whether any of the rates limits the operations.
+func (r Rates) Limited() bool {
+	if r.Mutations > 0 || r.Validations > 0 {
+		return true
+	}
+	for _, rates := range []map[string]float64{r.TableMutations, r.TableValidations} {
+		for _, rate := range rates {
+			if rate > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Pacer paces the mutations, schema changes included, and the validations
+// of the jobs at their target rates.
+type Pacer struct {
+	mutations   *ratelimit.Limiter
+	validations *ratelimit.Limiter
+	tables      map[string]tableLimiters
+	// targets are the limiters with the rates they were created with,
+	// which the load shapes scale.
+	targets []target
+}
+
+type target struct {
+	limiter *ratelimit.Limiter
+	rate    float64
+}
+
+type tableLimiters struct {
+	mutations   *ratelimit.Limiter
+	validations *ratelimit.Limiter
+}
+
+// NewPacer returns the pacer of the jobs of the tables of schema.
+func NewPacer(schema *typedef.Schema, rates Rates) *Pacer {
+	p := &Pacer{
+		tables: make(map[string]tableLimiters, len(schema.Tables)),
+	}
+	p.mutations = p.newLimiter(rates.Mutations)
+	p.validations = p.newLimiter(rates.Validations)
+	for _, table := range schema.Tables {
+		p.tables[table.Name] = tableLimiters{
+			mutations:   p.newLimiter(tableRate(rates.TableMutations, table.Name)),
+			validations: p.newLimiter(tableRate(rates.TableValidations, table.Name)),
+		}
+	}
+	return p
+}
+
+// Limited reports whether any of the operations are limited.
+func (p *Pacer) Limited() bool {
+	return p != nil && len(p.targets) > 0
+}
+
+// Shape scales the target rates with the factors of shape, from now on
+// until ctx is done.
+func (p *Pacer) Shape(ctx context.Context, shape ratelimit.Shape) {
+	if !p.Limited() || shape == nil {
+		return
+	}
+	start := time.Now()
+	p.scale(shape.Factor(0))
+	go func() {
+		ticker := time.NewTicker(shapeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				p.scale(shape.Factor(now.Sub(start)))
+			}
+		}
+	}()
+}
+
+func (p *Pacer) scale(factor float64) {
+	for _, t := range p.targets {
+		t.limiter.SetRate(t.rate * factor)
+	}
+}
+
+func tableRate(rates map[string]float64, table string) float64 {
+	if rate, ok := rates[table]; ok {
+		return rate
+	}
+	return rates[""]
+}
+
+// newLimiter returns nil if rate does not limit the operations. The burst of
+// a tenth of a second smooths the pauses of the jobs out without exceeding
+// the rate for long.
+func (p *Pacer) newLimiter(rate float64) *ratelimit.Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	l := ratelimit.New(rate, int(rate/10))
+	p.targets = append(p.targets, target{limiter: l, rate: rate})
+	return l
+}
+
+// Targets returns the target rates of the mutations and of the validations
+// of all the tables together, 0 if they are not limited.
+func (p *Pacer) Targets() (mutations, validations float64) {
+	if p == nil {
+		return 0, 0
+	}
+	mutations, validations = p.mutations.Rate(), p.validations.Rate()
+	var tableMutations, tableValidations float64
+	for _, t := range p.tables {
+		if tableMutations >= 0 && t.mutations != nil {
+			tableMutations += t.mutations.Rate()
+		} else {
+			tableMutations = -1
+		}
+		if tableValidations >= 0 && t.validations != nil {
+			tableValidations += t.validations.Rate()
+		} else {
+			tableValidations = -1
+		}
+	}
+	// The tables can limit all the operations more than the global rate.
+	if tableMutations > 0 && (mutations == 0 || tableMutations < mutations) {
+		mutations = tableMutations
+	}
+	if tableValidations > 0 && (validations == 0 || tableValidations < validations) {
+		validations = tableValidations
+	}
+	return mutations, validations
+}
+
+// waitMutation blocks until a mutation of table can run or ctx is done.
+func (p *Pacer) waitMutation(ctx context.Context, table string) error {
+	if p == nil {
+		return ctx.Err()
+	}
+	if err := p.mutations.Wait(ctx); err != nil {
+		return err
+	}
+	return p.tables[table].mutations.Wait(ctx)
+}
+
+// waitValidation blocks until a validation of table can run or ctx is done.
+func (p *Pacer) waitValidation(ctx context.Context, table string) error {
+	if p == nil {
+		return ctx.Err()
+	}
+	if err := p.validations.Wait(ctx); err != nil {
+		return err
+	}
+	return p.tables[table].validations.Wait(ctx)
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"testing"
+
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+func TestPacerTargets(t *testing.T) {
+	t.Parallel()
+	schema := &typedef.Schema{Tables: []*typedef.Table{{Name: "table1"}, {Name: "table2"}}}
+	p := NewPacer(schema, Rates{
+		Mutations:        1000,
+		TableMutations:   map[string]float64{"": 100, "table2": 200},
+		TableValidations: map[string]float64{"table1": 50},
+	})
+	if !p.Limited() {
+		t.Fatal("expected the pacer to limit the operations")
+	}
+	if p.tables["table1"].mutations.Rate() != 100 || p.tables["table2"].mutations.Rate() != 200 {
+		t.Errorf("unexpected table mutation rates")
+	}
+	// The tables limit the mutations more than the global rate, the
+	// validations of table2 are not limited.
+	if m, v := p.Targets(); m != 300 || v != 0 {
+		t.Errorf("expected targets of 300 and 0, got %f and %f", m, v)
+	}
+	p.scale(0.5)
+	if m, _ := p.Targets(); m != 150 {
+		t.Errorf("expected a target of 150 at half the rates, got %f", m)
+	}
+
+	if p = NewPacer(schema, Rates{}); p.Limited() {
+		t.Error("expected no limit")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/scylladb/gocqlx/v2/qb"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/joberror"
+	"github.com/scylladb/gemini/pkg/status"
+	"github.com/scylladb/gemini/pkg/stop"
+	"github.com/scylladb/gemini/pkg/store"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+const sweepStmtType = "TokenRangeSweep"
+
+// TokenRange is a range of the Murmur3 token ring, exclusive of Start and
+// inclusive of End.
+type TokenRange struct {
+	Start int64
+	End   int64
+}
+
+// SplitTokenRing splits the whole token ring (math.MinInt64, math.MaxInt64]
+// into n contiguous ranges of about the same size.
+func SplitTokenRing(n uint64) []TokenRange {
+	if n == 0 {
+		n = 1
+	}
+	width := math.MaxUint64 / n
+	ranges := make([]TokenRange, 0, n)
+	start := int64(math.MinInt64)
+	for i := uint64(1); i <= n; i++ {
+		end := int64(math.MaxInt64)
+		if i < n {
+			end = int64(uint64(start) + width)
+		}
+		ranges = append(ranges, TokenRange{Start: start, End: end})
+		start = end
+	}
+	return ranges
+}
+
+type sweepTarget struct {
+	// table is the table or the view as seen by the query, its keys
+	// determine the order of the returned rows.
+	table  *typedef.Table
+	result *sweepCounters
+	// tainted holds the tainted partitions of the base table.
+	tainted *generators.TaintedPartitions
+	query   qb.Builder
+	name    string
+	token   string
+}
+
+type sweepCounters struct {
+	rows           atomic.Uint64
+	mismatchedRows atomic.Uint64
+	failedRanges   atomic.Uint64
+}
+
+type sweepTask struct {
+	target *sweepTarget
+	tokens TokenRange
+}
+
+// Sweep reads every table and materialized view range by range from both
+// systems and compares all of their rows. It is meant to run once the
+// mutations are over, so that partitions never picked by the validation
+// jobs are validated too. Ranges whose mismatches are all in tainted
+// partitions are skipped.
+func Sweep(
+	ctx context.Context,
+	schema *typedef.Schema,
+	s store.Store,
+	generators []*generators.Generator,
+	ranges, workers uint64,
+	globalStatus *status.GlobalStatus,
+	logger *zap.Logger,
+	stopFlag *stop.Flag,
+) {
+	logger = logger.Named("token_range_sweep")
+	sCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopFlag.SetOnHardStopHandler(cancel)
+
+	targets := sweepTargets(schema, generators)
+	tasks := make(chan sweepTask)
+	go func() {
+		defer close(tasks)
+		for _, tokens := range SplitTokenRing(ranges) {
+			for _, target := range targets {
+				select {
+				case tasks <- sweepTask{target: target, tokens: tokens}:
+				case <-sCtx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	logger.Info("starting token range sweep", zap.Int("targets", len(targets)), zap.Uint64("ranges", ranges))
+	var wg sync.WaitGroup
+	if workers == 0 {
+		workers = 1
+	}
+	for i := uint64(0); i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				if stopFlag.IsHardOrSoft() {
+					cancel()
+					continue
+				}
+				sweepRange(sCtx, s, task, globalStatus, logger)
+			}
+		}()
+	}
+	wg.Wait()
+	logger.Info("token range sweep finished")
+
+	results := make([]status.SweepResult, 0, len(targets))
+	for _, target := range targets {
+		results = append(results, status.SweepResult{
+			Table:          target.name,
+			Rows:           target.result.rows.Load(),
+			MismatchedRows: target.result.mismatchedRows.Load(),
+			FailedRanges:   target.result.failedRanges.Load(),
+		})
+	}
+	globalStatus.Sweep = results
+}
+
+func sweepTargets(schema *typedef.Schema, gens []*generators.Generator) []*sweepTarget {
+	var targets []*sweepTarget
+	var tainted *generators.TaintedPartitions
+	add := func(table *typedef.Table, name string) {
+		token := fmt.Sprintf("token(%s)", strings.Join(table.PartitionKeys.Names(), ","))
+		targets = append(targets, &sweepTarget{
+			table:   table,
+			result:  &sweepCounters{},
+			tainted: tainted,
+			query:   qb.Select(name).Where(qb.GtLit(token, "?"), qb.LtOrEqLit(token, "?")),
+			name:    name,
+			token:   token,
+		})
+	}
+	for i, table := range schema.Tables {
+		tainted = gens[i].Tainted()
+		add(table, schema.Keyspace.Name+"."+table.Name)
+		for i := range table.MaterializedViews {
+			mv := &table.MaterializedViews[i]
+			add(mv.AsTable(table), schema.Keyspace.Name+"."+mv.Name)
+		}
+	}
+	return targets
+}
+
+func sweepRange(ctx context.Context, s store.Store, task sweepTask, globalStatus *status.GlobalStatus, logger *zap.Logger) {
+	target := task.target
+	result, err := s.Compare(ctx, target.table, target.query, task.tokens.Start, task.tokens.End)
+	target.result.rows.Add(uint64(result.Rows))
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	query := fmt.Sprintf("SELECT * FROM %s WHERE %s>%d AND %s<=%d", target.name, target.token, task.tokens.Start, target.token, task.tokens.End)
+	if err != nil {
+		logger.Error("token range sweep failed", zap.String("query", query), zap.Error(err))
+		target.result.failedRanges.Add(1)
+		for _, se := range systemErrors(err) {
+			globalStatus.AddReadError(&joberror.JobError{
+				Timestamp: time.Now(),
+				StmtType:  sweepStmtType,
+				Message:   "Token range sweep failed: " + se.err.Error(),
+				Query:     query,
+				System:    se.system,
+			})
+		}
+		return
+	}
+	if result.MismatchedRows == 0 {
+		return
+	}
+	if allTainted(result.Mismatches, target.tainted) {
+		globalStatus.SkippedReads.Add(1)
+		return
+	}
+	target.result.mismatchedRows.Add(uint64(result.MismatchedRows))
+	globalStatus.AddReadError(&joberror.JobError{
+		Timestamp:  time.Now(),
+		StmtType:   sweepStmtType,
+		Message:    fmt.Sprintf("Token range sweep found %d mismatched rows out of %d", result.MismatchedRows, result.Rows),
+		Query:      query,
+		Mismatches: result.Mismatches,
+	})
+}
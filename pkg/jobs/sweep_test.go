@@ -0,0 +1,41 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSplitTokenRing(t *testing.T) {
+	t.Parallel()
+	for _, n := range []uint64{1, 2, 3, 256, 1000} {
+		ranges := SplitTokenRing(n)
+		if uint64(len(ranges)) != n {
+			t.Fatalf("expected %d ranges, got %d", n, len(ranges))
+		}
+		if ranges[0].Start != math.MinInt64 || ranges[len(ranges)-1].End != math.MaxInt64 {
+			t.Errorf("ranges %v do not cover the whole ring", ranges)
+		}
+		for i, r := range ranges {
+			if r.Start >= r.End {
+				t.Errorf("range %d is empty: %v", i, r)
+			}
+			if i > 0 && ranges[i-1].End != r.Start {
+				t.Errorf("ranges %d and %d are not contiguous", i-1, i)
+			}
+		}
+	}
+}
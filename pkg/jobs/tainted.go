@@ -0,0 +1,152 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/joberror"
+	"github.com/scylladb/gemini/pkg/status"
+	"github.com/scylladb/gemini/pkg/store"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// errTaintedPartition is returned by validation when the statement reads
+// a tainted partition only, the result of such a read is not validated.
+var errTaintedPartition = errors.New("validation of a tainted partition skipped")
+
+// taint records that the partition written by a failed mutation may now
+// differ between the oracle and the test system.
+func taint(g *generators.Generator, v *typedef.ValueWithToken, globalStatus *status.GlobalStatus, logger *zap.Logger) {
+	if v == nil {
+		return
+	}
+	if g.Tainted().Taint(v) {
+		globalStatus.TaintedPartitions.Add(1)
+		logger.Info("partition tainted by a failed mutation", zap.Uint64("token", v.Token))
+	}
+}
+
+// untaint re-synchronizes a tainted partition from the oracle when this is
+// enabled, it reports whether the partition can be validated.
+func untaint(
+	ctx context.Context,
+	sc *typedef.SchemaConfig,
+	table *typedef.Table,
+	s store.Store,
+	g *generators.Generator,
+	v *typedef.ValueWithToken,
+	globalStatus *status.GlobalStatus,
+	logger *zap.Logger,
+) bool {
+	if v == nil || !g.Tainted().IsTainted(v.Token) {
+		return true
+	}
+	if !sc.ResyncTaintedPartitions {
+		return false
+	}
+	if err := s.Resync(ctx, table, v.Value...); err != nil {
+		logger.Info("unable to re-synchronize tainted partition", zap.Uint64("token", v.Token), zap.Error(err))
+		return false
+	}
+	g.Tainted().Clear(v.Token)
+	globalStatus.ResyncedPartitions.Add(1)
+	return true
+}
+
+// inTaintedPartitions reports whether all the rows that differ between the
+// systems belong to tainted partitions.
+func inTaintedPartitions(err error, g *generators.Generator) bool {
+	if errs := systemErrors(err); len(errs) > 1 {
+		for _, se := range errs {
+			if !inTaintedPartitions(se.err, g) {
+				return false
+			}
+		}
+		return true
+	}
+	var validationErr *store.ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+	return allTainted(validationErr.Mismatches, g.Tainted())
+}
+
+// allTainted reports whether all the mismatches are in tainted partitions.
+// Only the first mismatches are reported by a comparison, the others are
+// assumed to be alike.
+func allTainted(mismatches []joberror.Mismatch, tainted *generators.TaintedPartitions) bool {
+	if len(mismatches) == 0 || tainted.Len() == 0 {
+		return false
+	}
+	for _, m := range mismatches {
+		if !tainted.IsTainted(m.Token) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResyncTainted re-synchronizes from the oracle all the partitions still
+// tainted, so that the token range sweep does not report them.
+func ResyncTainted(
+	ctx context.Context,
+	schema *typedef.Schema,
+	s store.Store,
+	generators []*generators.Generator,
+	globalStatus *status.GlobalStatus,
+	logger *zap.Logger,
+) {
+	for i, table := range schema.Tables {
+		tainted := generators[i].Tainted()
+		for _, v := range tainted.List() {
+			if err := s.Resync(ctx, table, v.Value...); err != nil {
+				logger.Info("unable to re-synchronize tainted partition", zap.String("table", table.Name), zap.Uint64("token", v.Token), zap.Error(err))
+				continue
+			}
+			tainted.Clear(v.Token)
+			globalStatus.ResyncedPartitions.Add(1)
+		}
+	}
+}
+
+// ReportTainted counts and lists the partitions still tainted in the final
+// report, nothing is reported when no mutation failed.
+func ReportTainted(schema *typedef.Schema, generators []*generators.Generator, globalStatus *status.GlobalStatus) {
+	if globalStatus.TaintedPartitions.Load() == 0 {
+		return
+	}
+	var out []status.TaintedPartition
+	for i, table := range schema.Tables {
+		for _, v := range generators[i].Tainted().List() {
+			key := make([]string, 0, len(v.Value))
+			for _, value := range v.Value {
+				key = append(key, fmt.Sprintf("%v", value))
+			}
+			out = append(out, status.TaintedPartition{Table: table.Name, PartitionKey: key, Token: v.Token})
+		}
+	}
+	globalStatus.Tainted = &status.TaintedResult{
+		Partitions: out,
+		Tainted:    globalStatus.TaintedPartitions.Load(),
+		Resynced:   globalStatus.ResyncedPartitions.Load(),
+		Skipped:    globalStatus.SkippedReads.Load(),
+	}
+}
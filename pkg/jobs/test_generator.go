@@ -19,6 +19,7 @@ import (
 
 	"golang.org/x/exp/rand"
 
+	"github.com/scylladb/gemini/pkg/generators"
 	"github.com/scylladb/gemini/pkg/routingkey"
 	"github.com/scylladb/gemini/pkg/typedef"
 )
@@ -28,6 +29,7 @@ type MockGenerator struct {
 	rand              *rand.Rand
 	partitionsConfig  *typedef.PartitionRangeConfig
 	routingKeyCreator *routingkey.Creator
+	lists             *generators.ListRows
 }
 
 func NewTestGenerator(
@@ -36,7 +38,7 @@ func NewTestGenerator(
 	partitionsConfig *typedef.PartitionRangeConfig,
 	routingKeyCreator *routingkey.Creator,
 ) *MockGenerator {
-	return &MockGenerator{table: table, rand: rnd, partitionsConfig: partitionsConfig, routingKeyCreator: routingKeyCreator}
+	return &MockGenerator{table: table, rand: rnd, partitionsConfig: partitionsConfig, routingKeyCreator: routingKeyCreator, lists: generators.NewListRows()}
 }
 
 func (g *MockGenerator) Get() *typedef.ValueWithToken {
@@ -63,6 +65,10 @@ func (g *MockGenerator) GiveOld(_ *typedef.ValueWithToken) {
 func (g *MockGenerator) ReleaseToken(_ uint64) {
 }
 
+func (g *MockGenerator) Lists() *generators.ListRows {
+	return g.lists
+}
+
 func (g *MockGenerator) createPartitionKeyValues(r *rand.Rand) []interface{} {
 	var values []interface{}
 	for _, pk := range g.table.PartitionKeys {
@@ -0,0 +1,273 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package journal records the statements applied to the clusters during a
+// run, so that the run can be replayed against a fresh pair of clusters.
+//
+// A journal is a gob stream made of a Header followed by one record per
+// statement. It is flushed periodically, a journal cut short by a crash
+// is readable up to its last complete record.
+package journal
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Version is the version of the journal format.
+const Version = 1
+
+const flushInterval = time.Second
+
+// Outcome is the result of a statement on one of the clusters.
+type Outcome string
+
+const (
+	// Applied statements succeeded.
+	Applied Outcome = "applied"
+	// Failed statements failed or timed out, they may have been applied.
+	Failed Outcome = "failed"
+	// Skipped statements were not sent to the cluster at all.
+	Skipped Outcome = "skipped"
+)
+
+// Result is the outcome of a statement on one of the clusters.
+type Result struct {
+	Outcome Outcome
+	Error   string
+}
+
+// NewResult returns the result of a statement sent to a cluster.
+func NewResult(err error) Result {
+	if err != nil {
+		return Result{Outcome: Failed, Error: err.Error()}
+	}
+	return Result{Outcome: Applied}
+}
+
+// Header describes the run the journal was recorded in.
+type Header struct {
+	// Schema is the schema of the run as JSON.
+	Schema                  json.RawMessage
+	Version                 int
+	UseServerSideTimestamps bool
+}
+
+// Entry is a statement applied to the clusters.
+type Entry struct {
+	// Time is the client timestamp the statement was written with.
+	Time   time.Time
+	Values []interface{}
+	Query  string
+	// OracleQuery is set when the statement sent to the oracle differs,
+	// as for the creation of the keyspace.
+	OracleQuery string
+	Table       string
+	Oracle      Result
+	// Test is the result on the systems under test, the first failure if
+	// there are several of them.
+	Test Result
+	// Tests holds the result on each system under test by name, if there
+	// are several of them.
+	Tests map[string]Result
+	Token uint64
+	// HasToken is set when the statement writes to the single partition
+	// of the given Token.
+	HasToken bool
+	// Schema is set for statements changing the schema.
+	Schema bool
+	// Check is set for validation queries that found mismatches, Table is
+	// then the table they validate. They are not replayed.
+	Check bool
+}
+
+// TestResult returns the result of the statement on a system under test.
+func (e *Entry) TestResult(system string) Result {
+	if r, ok := e.Tests[system]; ok {
+		return r
+	}
+	return e.Test
+}
+
+// Writer appends entries to a journal file, it is safe for concurrent use.
+type Writer struct {
+	err   error
+	file  *os.File
+	buf   *bufio.Writer
+	enc   *gob.Encoder
+	done  chan struct{}
+	flush sync.WaitGroup
+	mu    sync.Mutex
+}
+
+// Create creates the journal file and writes its header.
+func Create(path string, header Header) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create journal %s", path)
+	}
+	buf := bufio.NewWriter(file)
+	w := &Writer{file: file, buf: buf, enc: gob.NewEncoder(buf), done: make(chan struct{})}
+	header.Version = Version
+	if err = w.enc.Encode(&header); err != nil {
+		_ = file.Close()
+		return nil, errors.Wrapf(err, "unable to write journal %s", path)
+	}
+	w.flush.Add(1)
+	go w.flushPeriodically()
+	return w, nil
+}
+
+// Record appends an entry to the journal. Once writing failed every
+// subsequent call returns the same error.
+func (w *Writer) Record(e *Entry) error {
+	rec, err := toRecord(e)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = w.enc.Encode(rec)
+	}
+	return w.err
+}
+
+func (w *Writer) flushPeriodically() {
+	defer w.flush.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			_ = w.Flush()
+		}
+	}
+}
+
+// Flush writes the buffered entries to the journal file.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = w.buf.Flush()
+	}
+	return w.err
+}
+
+// Close flushes the journal to disk and closes it.
+func (w *Writer) Close() error {
+	close(w.done)
+	w.flush.Wait()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = w.buf.Flush()
+	}
+	if w.err == nil {
+		w.err = w.file.Sync()
+	}
+	if err := w.file.Close(); w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// Reader reads the entries of a journal in the order they were recorded.
+type Reader struct {
+	file   *os.File
+	dec    *gob.Decoder
+	Header Header
+}
+
+// Open opens a journal and reads its header.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open journal %s", path)
+	}
+	r := &Reader{file: file, dec: gob.NewDecoder(bufio.NewReader(file))}
+	if err = r.dec.Decode(&r.Header); err != nil {
+		_ = file.Close()
+		return nil, errors.Wrapf(err, "unable to read journal %s", path)
+	}
+	if r.Header.Version != Version {
+		_ = file.Close()
+		return nil, errors.Errorf("unsupported journal version %d", r.Header.Version)
+	}
+	return r, nil
+}
+
+// Next returns the next entry, or io.EOF once all entries were read.
+// A record cut short at the end of the journal is ignored.
+func (r *Reader) Next() (*Entry, error) {
+	var rec record
+	if err := r.dec.Decode(&rec); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, errors.Wrap(err, "unable to read journal entry")
+	}
+	return rec.entry(), nil
+}
+
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// Filter selects the entries to replay. Schema changes are always
+// selected since the other statements depend on them, validation queries
+// never are.
+type Filter struct {
+	From   time.Time
+	To     time.Time
+	Tables map[string]struct{}
+	Tokens map[uint64]struct{}
+}
+
+// Match reports whether the entry is selected by the filter.
+func (f *Filter) Match(e *Entry) bool {
+	if e.Check {
+		return false
+	}
+	if e.Schema {
+		return true
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Time.After(f.To) {
+		return false
+	}
+	if len(f.Tables) > 0 {
+		if _, ok := f.Tables[e.Table]; !ok {
+			return false
+		}
+	}
+	if len(f.Tokens) > 0 {
+		if _, ok := f.Tokens[e.Token]; !ok || !e.HasToken {
+			return false
+		}
+	}
+	return true
+}
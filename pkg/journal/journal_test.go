@@ -0,0 +1,164 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gopkg.in/inf.v0"
+
+	"github.com/scylladb/gemini/pkg/journal"
+)
+
+func readAll(t *testing.T, path string) (journal.Header, []*journal.Entry) {
+	t.Helper()
+	r, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var entries []*journal.Entry
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return r.Header, entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "journal")
+	header := journal.Header{Schema: json.RawMessage(`{"keyspace":{"name":"ks1"}}`), UseServerSideTimestamps: true}
+	ts := time.Unix(1700000000, 123456000).UTC()
+	entries := []*journal.Entry{
+		{
+			Time:        ts,
+			Query:       "CREATE KEYSPACE IF NOT EXISTS ks1 WITH replication = {'class':'SimpleStrategy'}",
+			OracleQuery: "CREATE KEYSPACE IF NOT EXISTS ks1 WITH replication = {'class':'NetworkTopologyStrategy'}",
+			Schema:      true,
+			Oracle:      journal.NewResult(nil),
+			Test:        journal.NewResult(nil),
+		},
+		{
+			Time:  ts.Add(time.Millisecond),
+			Query: "INSERT INTO ks1.table1 (pk0,col0,col1,col2,col3) VALUES (?,?,?,?,?)",
+			Values: []interface{}{
+				int32(1), nil, inf.NewDec(12345, 3), big.NewInt(42),
+				[]interface{}{"a", map[interface{}]interface{}{int64(1): "b"}, map[string]interface{}{"f": nil}},
+			},
+			Table:    "table1",
+			Token:    1234,
+			HasToken: true,
+			Oracle:   journal.NewResult(nil),
+			Test:     journal.NewResult(errors.New("timeout")),
+		},
+	}
+
+	w, err := journal.Create(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err = w.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Record(&journal.Entry{Query: "INSERT", Values: []interface{}{struct{}{}}}); err == nil {
+		t.Error("values of unknown types must not be journaled")
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gotHeader, got := readAll(t, path)
+	header.Version = journal.Version
+	if diff := cmp.Diff(header, gotHeader); diff != "" {
+		t.Errorf("header mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(entries, got, cmpopts.EquateEmpty(), cmp.Comparer(func(x, y *inf.Dec) bool { return x.Cmp(y) == 0 }),
+		cmp.Comparer(func(x, y *big.Int) bool { return x.Cmp(y) == 0 })); diff != "" {
+		t.Errorf("entries mismatch (-want +got):\n%s", diff)
+	}
+
+	// A journal cut short by a crash is readable up to its last complete entry.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, data[:len(data)-5], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, got = readAll(t, path); len(got) != 1 {
+		t.Errorf("expected the complete entry only, got %d entries", len(got))
+	}
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	ts := time.Now()
+	insert := &journal.Entry{Time: ts, Table: "table1", Token: 10, HasToken: true}
+	batch := &journal.Entry{Time: ts, Table: "table1", Token: 0}
+	ddl := &journal.Entry{Time: ts.Add(-time.Hour), Table: "table2", Schema: true}
+
+	tests := map[string]struct {
+		filter journal.Filter
+		want   []bool
+	}{
+		"empty": {
+			want: []bool{true, true, true},
+		},
+		"from": {
+			filter: journal.Filter{From: ts.Add(time.Second)},
+			want:   []bool{false, false, true},
+		},
+		"to": {
+			filter: journal.Filter{To: ts},
+			want:   []bool{true, true, true},
+		},
+		"table": {
+			filter: journal.Filter{Tables: map[string]struct{}{"table2": {}}},
+			want:   []bool{false, false, true},
+		},
+		"token": {
+			filter: journal.Filter{Tokens: map[uint64]struct{}{10: {}, 0: {}}},
+			want:   []bool{true, false, true},
+		},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			for i, e := range []*journal.Entry{insert, batch, ddl} {
+				if got := test.filter.Match(e); got != test.want[i] {
+					t.Errorf("entry %d: expected %t, got %t", i, test.want[i], got)
+				}
+			}
+		})
+	}
+}
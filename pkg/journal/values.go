@@ -0,0 +1,167 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"encoding/gob"
+	"math/big"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pkg/errors"
+	"gopkg.in/inf.v0"
+)
+
+func init() {
+	// The types of the values generated by gemini that gob does not know
+	// about. Collections are encoded as a value tree instead.
+	gob.Register(&inf.Dec{})
+	gob.Register(&big.Int{})
+	gob.Register(gocql.UUID{})
+	gob.Register(gocql.Duration{})
+	gob.Register(time.Time{})
+	gob.Register(time.Duration(0))
+}
+
+type valueKind uint8
+
+const (
+	valueNull valueKind = iota
+	valueScalar
+	valueList
+	valueMap
+	valueUDT
+)
+
+// value is the encoded form of a bound value. gob is not able to encode
+// nil interface values nor collections of interface values, so these are
+// encoded as a tree of values.
+type value struct {
+	Scalar interface{}
+	Fields map[string]value
+	List   []value
+	Keys   []value
+	Kind   valueKind
+}
+
+// record is the encoded form of an Entry.
+type record struct {
+	Entry
+	Values []value
+}
+
+func toRecord(e *Entry) (*record, error) {
+	rec := &record{Entry: *e, Values: make([]value, 0, len(e.Values))}
+	rec.Entry.Values = nil
+	for _, v := range e.Values {
+		enc, err := encodeValue(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to journal query '%s'", e.Query)
+		}
+		rec.Values = append(rec.Values, enc)
+	}
+	return rec, nil
+}
+
+func (rec *record) entry() *Entry {
+	e := rec.Entry
+	e.Values = make([]interface{}, 0, len(rec.Values))
+	for _, v := range rec.Values {
+		e.Values = append(e.Values, v.decode())
+	}
+	return &e
+}
+
+func encodeValue(v interface{}) (value, error) {
+	switch val := v.(type) {
+	case nil:
+		return value{Kind: valueNull}, nil
+	case []interface{}:
+		out := value{Kind: valueList, List: make([]value, 0, len(val))}
+		for _, elem := range val {
+			enc, err := encodeValue(elem)
+			if err != nil {
+				return value{}, err
+			}
+			out.List = append(out.List, enc)
+		}
+		return out, nil
+	case map[interface{}]interface{}:
+		out := value{Kind: valueMap, Keys: make([]value, 0, len(val)), List: make([]value, 0, len(val))}
+		for k, elem := range val {
+			key, err := encodeValue(k)
+			if err != nil {
+				return value{}, err
+			}
+			enc, err := encodeValue(elem)
+			if err != nil {
+				return value{}, err
+			}
+			out.Keys = append(out.Keys, key)
+			out.List = append(out.List, enc)
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := value{Kind: valueUDT, Fields: make(map[string]value, len(val))}
+		for name, elem := range val {
+			enc, err := encodeValue(elem)
+			if err != nil {
+				return value{}, err
+			}
+			out.Fields[name] = enc
+		}
+		return out, nil
+	case *inf.Dec:
+		if val == nil {
+			return value{Kind: valueNull}, nil
+		}
+	case *big.Int:
+		if val == nil {
+			return value{Kind: valueNull}, nil
+		}
+	case bool, string, []byte, int, int8, int16, int32, int64, float32, float64,
+		gocql.UUID, gocql.Duration, time.Time, time.Duration:
+	default:
+		return value{}, errors.Errorf("values of type %T can not be journaled", v)
+	}
+	return value{Kind: valueScalar, Scalar: v}, nil
+}
+
+func (v value) decode() interface{} {
+	switch v.Kind {
+	case valueScalar:
+		return v.Scalar
+	case valueList:
+		out := make([]interface{}, 0, len(v.List))
+		for _, elem := range v.List {
+			out = append(out, elem.decode())
+		}
+		return out
+	case valueMap:
+		out := make(map[interface{}]interface{}, len(v.List))
+		for i, elem := range v.List {
+			out[v.Keys[i].decode()] = elem.decode()
+		}
+		return out
+	case valueUDT:
+		out := make(map[string]interface{}, len(v.Fields))
+		for name, elem := range v.Fields {
+			out[name] = elem.decode()
+		}
+		return out
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics holds the Prometheus metrics gemini exposes on --bind.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// latencyBuckets range from half a millisecond to about 16 seconds.
+var latencyBuckets = prometheus.ExponentialBuckets(0.0005, 2, 16)
+
+var (
+	// CQLRequests counts the requests by system and method, see the help.
+	CQLRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_cql_requests",
+		Help: "How many CQL requests processed, partitioned by system and CQL query type aka 'method' (batch, delete, insert, update).",
+	}, []string{"system", "method"},
+	)
+
+	// CQLRequestLatency is the latency of each CQL request, the first page
+	// of the result of a query.
+	CQLRequestLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gemini_cql_request_latency_seconds",
+		Help:    "Latency of the CQL requests, partitioned by system and CQL query type aka 'method'.",
+		Buckets: latencyBuckets,
+	}, []string{"system", "method"},
+	)
+
+	// CheckReadLatency is the latency of the reads of a validation, until
+	// the result is loaded completely or its first page is.
+	CheckReadLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gemini_check_read_latency_seconds",
+		Help:    "Latency of the reads of the validations, partitioned by system.",
+		Buckets: latencyBuckets,
+	}, []string{"system"},
+	)
+
+	// MutationRetries counts the attempts to apply a mutation again after
+	// it failed.
+	MutationRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_mutation_retries",
+		Help: "How many times mutations were retried after a failure, partitioned by system.",
+	}, []string{"system"},
+	)
+
+	// Validations counts the validations by table and result, success or
+	// failure once the retries of the validation are exhausted.
+	Validations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_validations",
+		Help: "How many validations completed, partitioned by table and result (success, failure).",
+	}, []string{"table", "result"},
+	)
+
+	// ValidationRetries counts the attempts to validate a query again after
+	// a mismatch, on materialized views and secondary indexes.
+	ValidationRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_validation_retries",
+		Help: "How many times validations were retried after a failure, partitioned by table.",
+	}, []string{"table"},
+	)
+
+	// DDLEvents counts the schema changes by table, statement type and
+	// result, applied or failed.
+	DDLEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_ddl_events",
+		Help: "How many schema changes were run, partitioned by table, statement type and result (applied, failed).",
+	}, []string{"table", "type", "result"},
+	)
+
+	// InFlightTokens is the number of partitions that are mutated or
+	// validated at the moment.
+	InFlightTokens = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gemini_inflight_tokens",
+		Help: "How many partition tokens are in use by the jobs, partitioned by table.",
+	}, []string{"table"},
+	)
+
+	// GeneratorBuffer is the number of partition keys generated ahead of
+	// the jobs, GeneratorBufferCapacity the number that fits in the buffers.
+	GeneratorBuffer = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gemini_generator_buffer",
+		Help: "How many generated partition keys are buffered for the jobs, partitioned by table.",
+	}, []string{"table"},
+	)
+	GeneratorBufferCapacity = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gemini_generator_buffer_capacity",
+		Help: "How many generated partition keys can be buffered for the jobs, partitioned by table.",
+	}, []string{"table"},
+	)
+)
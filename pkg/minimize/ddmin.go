@@ -0,0 +1,78 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minimize
+
+// ddmin implements the delta debugging algorithm of Zeller and Hildebrandt.
+// Given items for which fails returns true, it returns a subset for which
+// fails still returns true and that does not fail anymore once any single
+// item is removed from it.
+func ddmin(items []int, fails func([]int) (bool, error)) ([]int, error) {
+	granularity := 2
+	for len(items) >= 2 {
+		chunks := split(items, granularity)
+		reduced := false
+		for _, chunk := range chunks {
+			ok, err := fails(chunk)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				items, granularity, reduced = chunk, 2, true
+				break
+			}
+		}
+		// With two chunks the complements are the chunks themselves.
+		if !reduced && granularity > 2 {
+			for i := range chunks {
+				complement := make([]int, 0, len(items)-len(chunks[i]))
+				for j, chunk := range chunks {
+					if j != i {
+						complement = append(complement, chunk...)
+					}
+				}
+				ok, err := fails(complement)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					items, granularity, reduced = complement, granularity-1, true
+					break
+				}
+			}
+		}
+		if !reduced {
+			if granularity >= len(items) {
+				break
+			}
+			granularity *= 2
+			if granularity > len(items) {
+				granularity = len(items)
+			}
+		}
+	}
+	return items, nil
+}
+
+// split splits items into n chunks of about the same size.
+func split(items []int, n int) [][]int {
+	chunks := make([][]int, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		end := start + (len(items)-start)/(n-i)
+		chunks = append(chunks, items[start:end])
+		start = end
+	}
+	return chunks
+}
@@ -0,0 +1,362 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package minimize shrinks the history of a failed validation recorded in
+// a journal to a small set of mutations, tables and columns that still
+// make the validation fail with the same mismatch.
+package minimize
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/joberror"
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/store"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// ErrNotReproduced is returned when the complete history does not make the
+// validation fail.
+var ErrNotReproduced = errors.New("the failure does not reproduce")
+
+// History is what a journal recorded until a failed validation.
+type History struct {
+	// Check is the failed validation.
+	Check *journal.Entry
+	// Statements are the schema changes and the mutations applied before
+	// the validation, in the order they were journaled.
+	Statements []*journal.Entry
+}
+
+// Load reads the history of the n-th failed validation of a journal,
+// counting from 1.
+func Load(r *journal.Reader, n int) (*History, error) {
+	h := &History{}
+	checks := 0
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.Errorf("the journal holds %d failed validations", checks)
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case e.Check:
+			if checks++; checks == n {
+				h.Check = e
+				return h, nil
+			}
+		case e.Schema:
+			// The schema is created from the journal header, only its
+			// changes during the run are kept.
+			if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(e.Query)), "ALTER") {
+				h.Statements = append(h.Statements, e)
+			}
+		default:
+			h.Statements = append(h.Statements, e)
+		}
+	}
+}
+
+// Result is the minimized history.
+type Result struct {
+	// Schema is the schema without the dropped tables and columns.
+	Schema *typedef.Schema
+	// Query is the failed validation with its values inlined.
+	Query string
+	// Statements are the remaining schema changes and mutations.
+	Statements []*journal.Entry
+	Mismatch   joberror.Mismatch
+	Trials     int
+}
+
+// candidate is a subset of the history and of the schema.
+type candidate struct {
+	dropped    map[string]struct{}
+	statements []int
+}
+
+// Minimizer replays candidates on fresh keyspaces until it found the
+// smallest one still failing the validation with the same mismatch.
+type Minimizer struct {
+	store   store.Store
+	schema  *typedef.Schema
+	history *History
+	logger  *zap.Logger
+	target  *joberror.Mismatch
+	trials  int
+}
+
+// New returns a minimizer replaying candidates with the store, which must
+// have been created for the schema of the journal.
+func New(st store.Store, schema *typedef.Schema, history *History, logger *zap.Logger) *Minimizer {
+	return &Minimizer{store: st, schema: schema, history: history, logger: logger}
+}
+
+// Run minimizes the history. It first drops the tables the validation
+// does not depend on, then the mutations and then the columns.
+func (m *Minimizer) Run(ctx context.Context) (*Result, error) {
+	c := candidate{dropped: map[string]struct{}{}}
+	for i := range m.history.Statements {
+		c.statements = append(c.statements, i)
+	}
+	fails, err := m.trial(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if !fails {
+		return nil, ErrNotReproduced
+	}
+	m.logger.Info("failure reproduced", zap.Int("statements", len(c.statements)), zap.Any("mismatch", m.target))
+
+	for _, t := range m.schema.Tables {
+		if t.Name == m.history.Check.Table {
+			continue
+		}
+		next := c.without(map[string]struct{}{t.Name: {}}, m.statementsOf(t.Name))
+		if fails, err = m.trial(ctx, next); err != nil {
+			return nil, err
+		}
+		if fails {
+			c = next
+		}
+	}
+	m.logger.Info("tables minimized", zap.Int("dropped", len(c.dropped)))
+
+	if c.statements, err = ddmin(c.statements, func(statements []int) (bool, error) {
+		return m.trial(ctx, candidate{dropped: c.dropped, statements: statements})
+	}); err != nil {
+		return nil, err
+	}
+	m.logger.Info("statements minimized", zap.Int("statements", len(c.statements)))
+
+	for _, t := range m.schema.Tables {
+		if _, ok := c.dropped[t.Name]; ok {
+			continue
+		}
+		for _, col := range t.Columns {
+			next := c.without(map[string]struct{}{t.Name + "." + col.Name: {}}, nil)
+			if fails, err = m.trial(ctx, next); err != nil {
+				return nil, err
+			}
+			if fails {
+				c = next
+			}
+		}
+	}
+	m.logger.Info("columns minimized", zap.Int("dropped", len(c.dropped)))
+	return m.result(c)
+}
+
+// statementsOf returns the statements of the history on the table.
+func (m *Minimizer) statementsOf(table string) map[int]struct{} {
+	out := make(map[int]struct{})
+	for i, e := range m.history.Statements {
+		if e.Table == table {
+			out[i] = struct{}{}
+		}
+	}
+	return out
+}
+
+func (c candidate) without(dropped map[string]struct{}, statements map[int]struct{}) candidate {
+	next := candidate{dropped: make(map[string]struct{}, len(c.dropped)+len(dropped))}
+	for _, d := range []map[string]struct{}{c.dropped, dropped} {
+		for k := range d {
+			next.dropped[k] = struct{}{}
+		}
+	}
+	for _, i := range c.statements {
+		if _, ok := statements[i]; !ok {
+			next.statements = append(next.statements, i)
+		}
+	}
+	return next
+}
+
+// trial replays the candidate on a fresh keyspace and reports whether the
+// validation fails with the target mismatch. The first trial sets the
+// target to the first mismatch found.
+func (m *Minimizer) trial(ctx context.Context, c candidate) (bool, error) {
+	m.trials++
+	keyspace := fmt.Sprintf("%s_min%d", m.schema.Keyspace.Name, m.trials)
+	schema := m.subset(keyspace, c.dropped)
+	if err := m.create(ctx, schema); err != nil {
+		return false, err
+	}
+	defer m.drop(schema)
+
+	rename := strings.NewReplacer(" "+m.schema.Keyspace.Name+".", " "+keyspace+".")
+	for _, i := range c.statements {
+		e := m.rewrite(schema, m.history.Statements[i], rename, c.dropped)
+		if e == nil {
+			continue
+		}
+		if err := m.store.Replay(ctx, e); err != nil {
+			m.logger.Debug("replay of statement failed", zap.String("query", e.Query), zap.Error(err))
+		}
+	}
+
+	table := m.table(m.history.Check.Table)
+	if table == nil {
+		return false, errors.Errorf("unknown table %s", m.history.Check.Table)
+	}
+	err := m.store.Check(ctx, table, builder{query: rename.Replace(m.history.Check.Query)}, m.history.Check.Values...)
+	var validationErr *store.ValidationError
+	if !errors.As(err, &validationErr) {
+		if err != nil {
+			m.logger.Debug("validation failed without mismatches", zap.Error(err))
+		}
+		return false, nil
+	}
+	if m.target == nil {
+		if len(validationErr.Mismatches) == 0 {
+			return false, nil
+		}
+		m.target = &validationErr.Mismatches[0]
+		return true, nil
+	}
+	for _, mismatch := range validationErr.Mismatches {
+		if mismatch.Kind == m.target.Kind && mismatch.Column == m.target.Column &&
+			reflect.DeepEqual(mismatch.PrimaryKey, m.target.PrimaryKey) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// rewrite returns the statement as it is replayed on the schema, or nil if
+// it does not write anything to it.
+func (m *Minimizer) rewrite(schema *typedef.Schema, e *journal.Entry, rename *strings.Replacer, dropped map[string]struct{}) *journal.Entry {
+	out := *e
+	if e.Schema {
+		out.Query, out.OracleQuery = rename.Replace(e.Query), ""
+		return &out
+	}
+	query, values, ok, err := store.RewriteMutation(schema, e, dropped)
+	if err != nil {
+		m.logger.Debug("unable to rewrite statement", zap.String("query", e.Query), zap.Error(err))
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	out.Query, out.Values, out.OracleQuery = query, values, ""
+	return &out
+}
+
+func (m *Minimizer) create(ctx context.Context, schema *typedef.Schema) error {
+	testKeyspace, oracleKeyspace := generators.GetCreateKeyspaces(schema)
+	if err := m.store.Create(ctx, builder{query: testKeyspace}, builder{query: oracleKeyspace}); err != nil {
+		return errors.Wrap(err, "unable to create keyspace")
+	}
+	for _, stmt := range generators.GetCreateSchema(schema) {
+		if err := m.store.Mutate(ctx, builder{query: stmt}); err != nil && !errors.Is(err, store.ErrOracleMutation) {
+			return errors.Wrap(err, "unable to create schema")
+		}
+	}
+	return nil
+}
+
+func (m *Minimizer) drop(schema *typedef.Schema) {
+	for _, stmt := range generators.GetDropSchema(schema) {
+		if err := m.store.Mutate(context.Background(), builder{query: stmt}); err != nil {
+			m.logger.Warn("unable to drop keyspace", zap.String("keyspace", schema.Keyspace.Name), zap.Error(err))
+		}
+	}
+}
+
+func (m *Minimizer) table(name string) *typedef.Table {
+	for _, t := range m.schema.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// subset returns the schema in the given keyspace without the dropped
+// tables, columns and the indexes and views that depend on them.
+func (m *Minimizer) subset(keyspace string, dropped map[string]struct{}) *typedef.Schema {
+	schema := &typedef.Schema{Keyspace: m.schema.Keyspace}
+	schema.Keyspace.Name = keyspace
+	for _, t := range m.schema.Tables {
+		if _, ok := dropped[t.Name]; ok {
+			continue
+		}
+		isDropped := func(col *typedef.ColumnDef) bool {
+			_, ok := dropped[t.Name+"."+col.Name]
+			return ok
+		}
+		table := &typedef.Table{
+			Name:           t.Name,
+			PartitionKeys:  t.PartitionKeys,
+			ClusteringKeys: t.ClusteringKeys,
+			KnownIssues:    t.KnownIssues,
+			TableOptions:   t.TableOptions,
+		}
+		for _, col := range t.Columns {
+			if !isDropped(col) {
+				table.Columns = append(table.Columns, col)
+			}
+		}
+		for _, idx := range t.Indexes {
+			if idx.Column == nil || !isDropped(idx.Column) {
+				table.Indexes = append(table.Indexes, idx)
+			}
+		}
+		for _, mv := range t.MaterializedViews {
+			if mv.NonPrimaryKey == nil || !isDropped(mv.NonPrimaryKey) {
+				table.MaterializedViews = append(table.MaterializedViews, mv)
+			}
+		}
+		schema.Tables = append(schema.Tables, table)
+	}
+	return schema
+}
+
+func (m *Minimizer) result(c candidate) (*Result, error) {
+	schema := m.subset(m.schema.Keyspace.Name, c.dropped)
+	res := &Result{Schema: schema, Mismatch: *m.target, Trials: m.trials}
+	rename := strings.NewReplacer()
+	for _, i := range c.statements {
+		if e := m.rewrite(schema, m.history.Statements[i], rename, c.dropped); e != nil {
+			res.Statements = append(res.Statements, e)
+		}
+	}
+	query, err := store.FormatQuery(schema, m.history.Check.Query, m.history.Check.Values)
+	if err != nil {
+		return nil, err
+	}
+	res.Query = query
+	return res, nil
+}
+
+// builder renders a journaled statement.
+type builder struct {
+	query string
+}
+
+func (b builder) ToCql() (stmt string, names []string) {
+	return b.query, nil
+}
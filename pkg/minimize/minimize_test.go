@@ -0,0 +1,180 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package minimize
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/scylladb/gocqlx/v2/qb"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/joberror"
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/replication"
+	"github.com/scylladb/gemini/pkg/store"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+func TestDDMin(t *testing.T) {
+	t.Parallel()
+	items := make([]int, 0, 50)
+	for i := 0; i < 50; i++ {
+		items = append(items, i)
+	}
+	var trials int
+	got, err := ddmin(items, func(subset []int) (bool, error) {
+		trials++
+		var found int
+		for _, i := range subset {
+			if i == 3 || i == 17 || i == 42 {
+				found++
+			}
+		}
+		return found == 3, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{3, 17, 42}, got); diff != "" {
+		t.Errorf("unexpected subset (-want +got):\n%s", diff)
+	}
+	if trials > 200 {
+		t.Errorf("expected less than 200 trials, got %d", trials)
+	}
+}
+
+// buggyStore is a store whose test cluster loses the update of col0 of a
+// row inserted before.
+type buggyStore struct {
+	store.Store
+	keyspace string
+	inserted bool
+	updated  bool
+}
+
+func (s *buggyStore) Create(_ context.Context, test, _ qb.Builder) error {
+	query, _ := test.ToCql()
+	s.keyspace = strings.Fields(query)[5]
+	s.inserted, s.updated = false, false
+	return nil
+}
+
+func (s *buggyStore) Mutate(context.Context, qb.Builder, ...interface{}) error {
+	return nil
+}
+
+func (s *buggyStore) Replay(_ context.Context, e *journal.Entry) error {
+	if !strings.Contains(e.Query, " "+s.keyspace+".") {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(e.Query, "INSERT INTO "+s.keyspace+".table1") && e.Values[0] == 1 && e.Values[1] == 1:
+		s.inserted = true
+	case strings.HasPrefix(e.Query, "UPDATE "+s.keyspace+".table1") && strings.Contains(e.Query, "col0=?") &&
+		e.Values[len(e.Values)-2] == 1 && e.Values[len(e.Values)-1] == 1:
+		s.updated = s.inserted
+	}
+	return nil
+}
+
+func (s *buggyStore) Check(_ context.Context, _ *typedef.Table, builder qb.Builder, _ ...interface{}) error {
+	query, _ := builder.ToCql()
+	if !strings.Contains(query, " "+s.keyspace+".") || !s.updated {
+		return nil
+	}
+	return &store.ValidationError{Mismatches: []joberror.Mismatch{
+		{Kind: joberror.DifferingCell, Column: "col0", PrimaryKey: map[string]string{"pk0": "1", "ck0": "1"}},
+	}}
+}
+
+func TestMinimize(t *testing.T) {
+	t.Parallel()
+	schema := &typedef.Schema{
+		Keyspace: typedef.Keyspace{Name: "ks1", Replication: replication.NewSimpleStrategy(), OracleReplication: replication.NewSimpleStrategy()},
+		Tables: []*typedef.Table{
+			{
+				Name:           "table1",
+				PartitionKeys:  typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+				ClusteringKeys: typedef.Columns{{Name: "ck0", Type: typedef.TYPE_INT}},
+				Columns: typedef.Columns{
+					{Name: "col0", Type: typedef.TYPE_TEXT},
+					{Name: "col1", Type: &typedef.TupleType{ValueTypes: []typedef.SimpleType{typedef.TYPE_INT, typedef.TYPE_TEXT}}},
+				},
+			},
+			{
+				Name:          "table2",
+				PartitionKeys: typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+				Columns:       typedef.Columns{{Name: "col0", Type: &typedef.CounterType{}}},
+			},
+		},
+	}
+	insert := "INSERT INTO ks1.table1 (pk0,ck0,col0,col1) VALUES (?,?,?,(?,?))"
+	update := "UPDATE ks1.table1 SET col0=?,col1=(?,?) WHERE pk0=? AND ck0=?"
+	ts := time.UnixMicro(1700000000000000)
+	history := &History{
+		Check: &journal.Entry{Query: "SELECT * FROM ks1.table1 WHERE pk0=?", Values: []interface{}{1}, Table: "table1", Check: true},
+	}
+	for i, e := range []*journal.Entry{
+		{Query: insert, Values: []interface{}{1, 2, "x", 1, "y"}, Table: "table1"},
+		{Query: "UPDATE ks1.table2 SET col0=col0+? WHERE pk0=?", Values: []interface{}{int64(1), 1}, Table: "table2"},
+		{Query: insert, Values: []interface{}{1, 1, "a", 2, "b"}, Table: "table1"},
+		{Query: insert, Values: []interface{}{2, 1, "c", 3, "d"}, Table: "table1"},
+		{Query: update, Values: []interface{}{"e", 4, "f", 1, 2}, Table: "table1"},
+		{Query: update, Values: []interface{}{"g", 5, "h", 1, 1}, Table: "table1"},
+		{Query: insert, Values: []interface{}{1, 3, "i", 6, "j"}, Table: "table1"},
+	} {
+		e.Time = ts.Add(time.Duration(i) * time.Second)
+		history.Statements = append(history.Statements, e)
+	}
+
+	st := &buggyStore{}
+	result, err := New(st, schema, history, zap.NewNop()).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries []string
+	for _, e := range result.Statements {
+		s, fmtErr := store.FormatMutation(result.Schema, e, false)
+		if fmtErr != nil {
+			t.Fatal(fmtErr)
+		}
+		queries = append(queries, s)
+	}
+	want := []string{
+		"INSERT INTO ks1.table1 (pk0,ck0,col0) VALUES (1,1,'a')",
+		"UPDATE ks1.table1 SET col0='g' WHERE pk0=1 AND ck0=1",
+	}
+	if diff := cmp.Diff(want, queries); diff != "" {
+		t.Errorf("unexpected statements (-want +got):\n%s", diff)
+	}
+	if len(result.Schema.Tables) != 1 || len(result.Schema.Tables[0].Columns) != 1 {
+		t.Errorf("expected table2 and col1 to be dropped, got %+v", result.Schema.Tables)
+	}
+	if result.Query != "SELECT * FROM ks1.table1 WHERE pk0=1" {
+		t.Errorf("unexpected query %s", result.Query)
+	}
+	if !result.Statements[0].Time.Equal(ts.Add(2 * time.Second)) {
+		t.Errorf("the statements must keep their timestamp, got %s", result.Statements[0].Time)
+	}
+
+	history.Statements = history.Statements[:2]
+	if _, err = New(&buggyStore{}, schema, history, zap.NewNop()).Run(context.Background()); err != ErrNotReproduced {
+		t.Errorf("expected the failure not to reproduce, got %v", err)
+	}
+}
@@ -94,7 +94,57 @@ var CacheBuilders = CacheBuilderFnMap{
 	typedef.CacheInsert:            genInsertStmtCache,
 	typedef.CacheInsertIfNotExists: genInsertIfNotExistsStmtCache,
 	typedef.CacheDelete:            genDeleteStmtCache,
+	typedef.CacheDeletePartition:   genDeletePartitionStmtCache,
+	typedef.CacheDeleteRow:         genDeleteRowStmtCache,
 	typedef.CacheUpdate:            genUpdateStmtCache,
+	typedef.CacheUpdateCollectionAdd: func(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache {
+		out := genCollectionStmtCache(s, t, t.Columns.Collections(), func(b *qb.UpdateBuilder, col *typedef.ColumnDef) []typedef.Type {
+			b.Add(col.Name)
+			return []typedef.Type{col.Type}
+		})
+		// Adding to a set or a map again changes nothing, appending to a
+		// list again appends the values twice.
+		out.NotIdempotent = len(t.Columns.Lists()) > 0
+		return out
+	},
+	typedef.CacheUpdateCollectionRemove: func(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache {
+		return genCollectionStmtCache(s, t, t.Columns.Collections(), func(b *qb.UpdateBuilder, col *typedef.ColumnDef) []typedef.Type {
+			b.Remove(col.Name)
+			if mt, ok := col.Type.(*typedef.MapType); ok {
+				// The keys of a map are removed by a set of keys.
+				return []typedef.Type{&typedef.BagType{ComplexType: typedef.TYPE_SET, ValueType: mt.KeyType}}
+			}
+			return []typedef.Type{col.Type}
+		})
+	},
+	typedef.CacheUpdateCollection: func(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache {
+		return genCollectionStmtCache(s, t, t.Columns.Collections(), func(b *qb.UpdateBuilder, col *typedef.ColumnDef) []typedef.Type {
+			b.Set(col.Name)
+			return []typedef.Type{col.Type}
+		})
+	},
+	typedef.CacheUpdateListPrepend: func(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache {
+		out := genCollectionStmtCache(s, t, t.Columns.Lists(), func(b *qb.UpdateBuilder, col *typedef.ColumnDef) []typedef.Type {
+			b.SetLit(col.Name, "?+"+col.Name)
+			return []typedef.Type{col.Type}
+		})
+		out.NotIdempotent = true
+		return out
+	},
+	typedef.CacheUpdateListElement: func(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache {
+		return genCollectionStmtCache(s, t, t.Columns.Lists(), func(b *qb.UpdateBuilder, col *typedef.ColumnDef) []typedef.Type {
+			// The index is drawn below the length of a known list, see typedef.ListRow.
+			b.SetLit(col.Name+"[?]", "?")
+			return []typedef.Type{typedef.TYPE_INT, col.Type.(*typedef.BagType).ValueType}
+		})
+	},
+	typedef.CacheUpdateMapElement: func(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache {
+		return genCollectionStmtCache(s, t, t.Columns.Maps(), func(b *qb.UpdateBuilder, col *typedef.ColumnDef) []typedef.Type {
+			mt := col.Type.(*typedef.MapType)
+			b.SetLit(col.Name+"[?]", "?")
+			return []typedef.Type{mt.KeyType, mt.ValueType}
+		})
+	},
 }.ToList()
 
 func genInsertStmtCache(
@@ -153,6 +203,36 @@ func genUpdateStmtCache(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache
 		allTypes = append(allTypes, cdef.Type)
 	}
 
+	for _, pk := range t.PartitionKeys {
+		builder = builder.Where(qb.Eq(pk.Name))
+		allTypes = append(allTypes, pk.Type)
+	}
+	for _, ck := range t.ClusteringKeys {
+		builder = builder.Where(qb.Eq(ck.Name))
+		allTypes = append(allTypes, ck.Type)
+	}
+	return &typedef.StmtCache{
+		Query:         builder,
+		Types:         allTypes,
+		QueryType:     typedef.UpdateStatementType,
+		NotIdempotent: t.IsCounterTable(),
+	}
+}
+
+// genCollectionStmtCache updates the given collection columns of a row, set
+// adds the assignment of a column to the builder and returns the types of
+// its values.
+func genCollectionStmtCache(
+	s *typedef.Schema,
+	t *typedef.Table,
+	columns typedef.Columns,
+	set func(b *qb.UpdateBuilder, col *typedef.ColumnDef) []typedef.Type,
+) *typedef.StmtCache {
+	var allTypes []typedef.Type
+	builder := qb.Update(s.Keyspace.Name + "." + t.Name)
+	for _, col := range columns {
+		allTypes = append(allTypes, set(builder, col)...)
+	}
 	for _, pk := range t.PartitionKeys {
 		builder = builder.Where(qb.Eq(pk.Name))
 		allTypes = append(allTypes, pk.Type)
@@ -187,3 +267,29 @@ func genDeleteStmtCache(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache
 		QueryType: typedef.DeleteStatementType,
 	}
 }
+
+func genDeletePartitionStmtCache(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache {
+	var allTypes []typedef.Type
+	builder := qb.Delete(s.Keyspace.Name + "." + t.Name)
+	for _, pk := range t.PartitionKeys {
+		builder = builder.Where(qb.Eq(pk.Name))
+		allTypes = append(allTypes, pk.Type)
+	}
+	return &typedef.StmtCache{
+		Query:     builder,
+		Types:     allTypes,
+		QueryType: typedef.DeletePartitionStatementType,
+	}
+}
+
+func genDeleteRowStmtCache(s *typedef.Schema, t *typedef.Table) *typedef.StmtCache {
+	out := genDeletePartitionStmtCache(s, t)
+	builder := out.Query.(*qb.DeleteBuilder)
+	for _, ck := range t.ClusteringKeys {
+		builder = builder.Where(qb.Eq(ck.Name))
+		out.Types = append(out.Types, ck.Type)
+	}
+	out.Query = builder
+	out.QueryType = typedef.DeleteRowStatementType
+	return out
+}
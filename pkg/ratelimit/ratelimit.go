@@ -0,0 +1,123 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit holds the token buckets pacing the jobs at a target rate
+// of operations per second.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxDelay bounds the waits for a token, so that the waiting operations
+// follow the changes of the rate.
+const maxDelay = 100 * time.Millisecond
+
+// Limiter is a token bucket filled at a rate of tokens per second, each
+// operation taking one token. A nil Limiter does not limit the operations,
+// a Limiter with a rate of 0 lets none run until its rate is raised.
+type Limiter struct {
+	last   time.Time
+	rate   float64
+	burst  float64
+	tokens float64
+	mu     sync.Mutex
+}
+
+// New returns a limiter of rate operations per second, of which burst can
+// run at once after the limiter was idle. The bucket starts full.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Rate returns the rate of the limiter, 0 for a nil limiter.
+func (l *Limiter) Rate() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// SetRate changes the rate of the limiter, the tokens added so far are
+// kept.
+func (l *Limiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(time.Now())
+	l.rate = rate
+}
+
+// Wait blocks until the operation can run or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	for {
+		delay, ok := l.take(time.Now())
+		if ok {
+			return ctx.Err()
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// take takes a token if there is one, or returns how long to wait before
+// trying again.
+func (l *Limiter) take(now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+	if l.rate <= 0 {
+		return maxDelay, false
+	}
+	delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	switch {
+	case delay > maxDelay:
+		delay = maxDelay
+	case delay <= 0:
+		// Rounding errors.
+		delay = time.Microsecond
+	}
+	return delay, false
+}
+
+func (l *Limiter) advance(now time.Time) {
+	if !now.After(l.last) {
+		return
+	}
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	t.Parallel()
+	l := New(100, 2)
+	start := time.Unix(0, 0)
+	// The burst runs at once, the next operation has to wait for a token.
+	for i := 0; i < 2; i++ {
+		if _, ok := l.take(start); !ok {
+			t.Fatalf("operation %d: expected a token of the burst", i)
+		}
+	}
+	if delay, ok := l.take(start); ok || delay != 10*time.Millisecond {
+		t.Errorf("expected a delay of 10ms, got %s", delay)
+	}
+	if delay, ok := l.take(start.Add(5 * time.Millisecond)); ok || delay != 5*time.Millisecond {
+		t.Errorf("expected a delay of 5ms, got %s", delay)
+	}
+	if _, ok := l.take(start.Add(10 * time.Millisecond)); !ok {
+		t.Error("expected a token after 10ms")
+	}
+	// An idle limiter fills up to its burst only.
+	now := start.Add(time.Hour)
+	for i, expected := range []bool{true, true, false} {
+		if _, ok := l.take(now); ok != expected {
+			t.Errorf("operation %d after idling: expected a token %v, got %v", i, expected, ok)
+		}
+	}
+}
+
+func TestSetRate(t *testing.T) {
+	t.Parallel()
+	var l *Limiter
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l = New(0, 1)
+	start := time.Unix(0, 0)
+	if _, ok := l.take(start); !ok {
+		t.Fatal("expected the token the bucket starts with")
+	}
+	if delay, ok := l.take(start.Add(time.Hour)); ok || delay != maxDelay {
+		t.Fatalf("expected a paused limiter to wait %s, got %s", maxDelay, delay)
+	}
+	// Waits are bounded, so that the operations follow a higher rate.
+	l.rate = 0.001
+	if delay, ok := l.take(start.Add(time.Hour)); ok || delay != maxDelay {
+		t.Errorf("expected a delay of %s, got %s", maxDelay, delay)
+	}
+}
+
+func TestWait(t *testing.T) {
+	t.Parallel()
+	l := New(1000, 1)
+	start := time.Now()
+	for i := 0; i < 51; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected 51 operations at 1000/s to take at least 50ms, took %s", elapsed)
+	}
+
+	l = New(1, 1)
+	_ = l.Wait(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("expected the wait to be canceled")
+	}
+}
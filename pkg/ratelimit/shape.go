@@ -0,0 +1,235 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Shape is a load shape, the factor the target rates are multiplied by at
+// each point of time of a run.
+type Shape interface {
+	Factor(elapsed time.Duration) float64
+}
+
+// Ramp goes linearly from the factor From to the factor To over Duration
+// and then stays at To.
+type Ramp struct {
+	From     float64
+	To       float64
+	Duration time.Duration
+}
+
+func (r Ramp) Factor(elapsed time.Duration) float64 {
+	if elapsed >= r.Duration {
+		return r.To
+	}
+	return r.From + (r.To-r.From)*float64(elapsed)/float64(r.Duration)
+}
+
+// Burst stays at the factor Base except for the first For of every Every,
+// during which it is at the factor Peak.
+type Burst struct {
+	Base  float64
+	Peak  float64
+	Every time.Duration
+	For   time.Duration
+}
+
+func (b Burst) Factor(elapsed time.Duration) float64 {
+	if elapsed%b.Every < b.For {
+		return b.Peak
+	}
+	return b.Base
+}
+
+// Sine oscillates around the factor Base by Amplitude with a period of
+// Period, without going below 0.
+type Sine struct {
+	Base      float64
+	Amplitude float64
+	Period    time.Duration
+}
+
+func (s Sine) Factor(elapsed time.Duration) float64 {
+	return math.Max(0, s.Base+s.Amplitude*math.Sin(2*math.Pi*float64(elapsed)/float64(s.Period)))
+}
+
+// Step is a step of a Steps schedule.
+type Step struct {
+	Duration time.Duration
+	Factor   float64
+}
+
+// Steps goes through its steps in order and then stays at the factor of the
+// last one, or starts over if Repeat is set.
+type Steps struct {
+	Steps  []Step
+	Repeat bool
+}
+
+func (s Steps) Factor(elapsed time.Duration) float64 {
+	var total time.Duration
+	for _, step := range s.Steps {
+		total += step.Duration
+	}
+	if s.Repeat && total > 0 {
+		elapsed %= total
+	}
+	for _, step := range s.Steps {
+		if elapsed < step.Duration {
+			return step.Factor
+		}
+		elapsed -= step.Duration
+	}
+	return s.Steps[len(s.Steps)-1].Factor
+}
+
+// ParseShape parses a load shape given as its kind followed by its
+// parameters, such as:
+//
+//	ramp:from=0.1,to=1,duration=10m
+//	burst:factor=3,every=1m,for=10s,base=1
+//	sine:amplitude=0.5,period=10m,base=1
+//	step:5m=0.5,5m=1,10m=2,repeat=true
+//
+// The parameters that are left out take the values of the examples, except
+// the durations of ramp, burst and sine which are required.
+func ParseShape(spec string) (Shape, error) {
+	kind, params, _ := strings.Cut(spec, ":")
+	p, err := parseParams(params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s load shape", kind)
+	}
+	var s Shape
+	switch kind {
+	case "ramp":
+		s, err = parseRamp(p)
+	case "burst":
+		s, err = parseBurst(p)
+	case "sine":
+		s, err = parseSine(p)
+	case "step":
+		s, err = parseSteps(p)
+	default:
+		return nil, errors.Errorf("unknown load shape %q, expected ramp, burst, sine or step", kind)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s load shape", kind)
+	}
+	return s, nil
+}
+
+type param struct {
+	key   string
+	value string
+}
+
+// params are the parameters of a shape in order, since the durations of the
+// steps are repeated.
+type params []param
+
+func parseParams(s string) (params, error) {
+	var p params
+	if s == "" {
+		return p, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		key, value, found := strings.Cut(kv, "=")
+		if !found {
+			return nil, errors.Errorf("parameter %q is not a key=value pair", kv)
+		}
+		p = append(p, param{key: strings.TrimSpace(key), value: strings.TrimSpace(value)})
+	}
+	return p, nil
+}
+
+// get parses the parameters of the keys of dst, the ones that are left out
+// keep their value. Unknown parameters are an error.
+func (p params) get(floats map[string]*float64, durations map[string]*time.Duration) error {
+	for _, kv := range p {
+		var err error
+		if dst, ok := floats[kv.key]; ok {
+			if *dst, err = strconv.ParseFloat(kv.value, 64); err != nil || *dst < 0 {
+				return errors.Errorf("invalid %s %q, expected a non-negative number", kv.key, kv.value)
+			}
+		} else if dst, ok := durations[kv.key]; ok {
+			if *dst, err = time.ParseDuration(kv.value); err != nil || *dst <= 0 {
+				return errors.Errorf("invalid %s %q, expected a positive duration", kv.key, kv.value)
+			}
+		} else {
+			return errors.Errorf("unknown parameter %q", kv.key)
+		}
+	}
+	for key, dst := range durations {
+		if *dst == 0 {
+			return errors.Errorf("missing %s", key)
+		}
+	}
+	return nil
+}
+
+func parseRamp(p params) (Shape, error) {
+	r := Ramp{From: 0.1, To: 1}
+	err := p.get(map[string]*float64{"from": &r.From, "to": &r.To}, map[string]*time.Duration{"duration": &r.Duration})
+	return r, err
+}
+
+func parseBurst(p params) (Shape, error) {
+	b := Burst{Base: 1, Peak: 3}
+	err := p.get(
+		map[string]*float64{"base": &b.Base, "factor": &b.Peak},
+		map[string]*time.Duration{"every": &b.Every, "for": &b.For},
+	)
+	return b, err
+}
+
+func parseSine(p params) (Shape, error) {
+	s := Sine{Base: 1, Amplitude: 0.5}
+	err := p.get(map[string]*float64{"base": &s.Base, "amplitude": &s.Amplitude}, map[string]*time.Duration{"period": &s.Period})
+	return s, err
+}
+
+func parseSteps(p params) (Shape, error) {
+	var s Steps
+	for _, kv := range p {
+		if kv.key == "repeat" {
+			repeat, err := strconv.ParseBool(kv.value)
+			if err != nil {
+				return nil, errors.Errorf("invalid repeat %q", kv.value)
+			}
+			s.Repeat = repeat
+			continue
+		}
+		d, err := time.ParseDuration(kv.key)
+		if err != nil || d <= 0 {
+			return nil, errors.Errorf("invalid duration %q of a step", kv.key)
+		}
+		f, err := strconv.ParseFloat(kv.value, 64)
+		if err != nil || f < 0 {
+			return nil, errors.Errorf("invalid factor %q of a step", kv.value)
+		}
+		s.Steps = append(s.Steps, Step{Duration: d, Factor: f})
+	}
+	if len(s.Steps) == 0 {
+		return nil, errors.New("no step")
+	}
+	return s, nil
+}
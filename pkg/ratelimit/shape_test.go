@@ -0,0 +1,87 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestShapes(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		factors map[time.Duration]float64
+		spec    string
+	}{
+		"ramp": {
+			spec:    "ramp:from=0,to=2,duration=10s",
+			factors: map[time.Duration]float64{0: 0, 5 * time.Second: 1, 10 * time.Second: 2, time.Hour: 2},
+		},
+		"ramp defaults": {
+			spec:    "ramp:duration=1m",
+			factors: map[time.Duration]float64{0: 0.1, time.Minute: 1},
+		},
+		"burst": {
+			spec:    "burst:base=0.5,factor=4,every=1m,for=10s",
+			factors: map[time.Duration]float64{0: 4, 9 * time.Second: 4, 10 * time.Second: 0.5, 61 * time.Second: 4},
+		},
+		"sine": {
+			spec:    "sine:amplitude=2,period=4s",
+			factors: map[time.Duration]float64{0: 1, time.Second: 3, 2 * time.Second: 1, 3 * time.Second: 0},
+		},
+		"step": {
+			spec:    "step:1m=0.5,2m=2",
+			factors: map[time.Duration]float64{0: 0.5, time.Minute: 2, 2 * time.Minute: 2, time.Hour: 2},
+		},
+		"repeated step": {
+			spec:    "step:1m=0.5,2m=2,repeat=true",
+			factors: map[time.Duration]float64{0: 0.5, time.Minute: 2, 3 * time.Minute: 0.5, 4 * time.Minute: 2},
+		},
+	}
+	for name, tc := range tests {
+		s, err := ParseShape(tc.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for elapsed, expected := range tc.factors {
+			if f := s.Factor(elapsed); math.Abs(f-expected) > 1e-9 {
+				t.Errorf("%s: expected a factor of %f after %s, got %f", name, expected, elapsed, f)
+			}
+		}
+	}
+}
+
+func TestParseShapeErrors(t *testing.T) {
+	t.Parallel()
+	for _, spec := range []string{
+		"",
+		"square:period=1m",
+		"ramp",
+		"ramp:from=1,to=2",
+		"ramp:to=-1,duration=1m",
+		"burst:every=1m",
+		"burst:every=1m,for=1s,height=2",
+		"sine:period=0s",
+		"step:",
+		"step:1m",
+		"step:1m=x",
+		"step:1m=1,repeat=maybe",
+	} {
+		if _, err := ParseShape(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
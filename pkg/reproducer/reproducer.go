@@ -0,0 +1,192 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reproducer turns the validation failures of a run into CQL
+// scripts reproducing them with cqlsh on a single cluster.
+package reproducer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/scylladb/gemini/pkg/generators"
+	"github.com/scylladb/gemini/pkg/joberror"
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/store"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+type reproducer struct {
+	failure   *joberror.JobError
+	tokens    map[uint64]struct{}
+	mutations []*journal.Entry
+}
+
+// Write writes a script to dir for every failure that found mismatched
+// rows. A script creates the schema, applies the mutations the test
+// cluster received on the partitions of the mismatched rows until the
+// failure, in timestamp order, and runs the failing query. The path of the
+// script is set in the Reproducer field of the failure. It returns the
+// number of scripts written.
+func Write(dir string, schema *typedef.Schema, journalPath string, failures []*joberror.JobError) (int, error) {
+	var reproducers []*reproducer
+	for _, failure := range failures {
+		if len(failure.Mismatches) == 0 {
+			continue
+		}
+		r := &reproducer{failure: failure, tokens: make(map[uint64]struct{})}
+		for _, m := range failure.Mismatches {
+			r.tokens[m.Token] = struct{}{}
+		}
+		reproducers = append(reproducers, r)
+	}
+	if len(reproducers) == 0 {
+		return 0, nil
+	}
+
+	j, err := journal.Open(journalPath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = j.Close()
+	}()
+	for {
+		var e *journal.Entry
+		if e, err = j.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, err
+		}
+		if e.Schema || e.Check || !e.HasToken || e.Test.Outcome == journal.Skipped {
+			continue
+		}
+		for _, r := range reproducers {
+			if _, ok := r.tokens[e.Token]; ok && !e.Time.After(r.failure.Timestamp) {
+				r.mutations = append(r.mutations, e)
+			}
+		}
+	}
+
+	for i, r := range reproducers {
+		path := filepath.Join(dir, fmt.Sprintf("reproducer-%03d.cql", i+1))
+		if err = r.script(schema, j.Header.UseServerSideTimestamps).WriteFile(path); err != nil {
+			return i, err
+		}
+		r.failure.Reproducer = path
+	}
+	return len(reproducers), nil
+}
+
+func (r *reproducer) script(schema *typedef.Schema, useServerSideTimestamps bool) *Script {
+	// Tokens are shown as the signed values cqlsh returns for token().
+	values := make([]int64, 0, len(r.tokens))
+	for token := range r.tokens {
+		values = append(values, int64(token))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	tokens := make([]string, 0, len(values))
+	for _, token := range values {
+		tokens = append(tokens, strconv.FormatInt(token, 10))
+	}
+	sort.SliceStable(r.mutations, func(i, j int) bool {
+		return r.mutations[i].Time.Before(r.mutations[j].Time)
+	})
+	return &Script{
+		Schema: schema,
+		Comments: []string{
+			strings.ReplaceAll(r.failure.Message, "\n", " "),
+			fmt.Sprintf("%s at %s on partition tokens %s",
+				r.failure.StmtType, r.failure.Timestamp.UTC().Format(time.RFC3339Nano), strings.Join(tokens, ", ")),
+		},
+		Mutations:               r.mutations,
+		Query:                   r.failure.Query,
+		UseServerSideTimestamps: useServerSideTimestamps,
+	}
+}
+
+// Script is a CQL script creating a schema, applying mutations to it and
+// running a query.
+type Script struct {
+	Schema *typedef.Schema
+	// Query is the failing query, with its values inlined.
+	Query    string
+	Comments []string
+	// Mutations are written in order, schema changes among them are
+	// written as they were journaled.
+	Mutations               []*journal.Entry
+	UseServerSideTimestamps bool
+}
+
+// WriteFile writes the script to the file at path.
+func (s *Script) WriteFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create reproducer %s", path)
+	}
+	w := bufio.NewWriter(file)
+	s.Render(w)
+	if err = w.Flush(); err != nil {
+		_ = file.Close()
+		return errors.Wrapf(err, "unable to write reproducer %s", path)
+	}
+	return file.Close()
+}
+
+// Render writes the script to w.
+func (s *Script) Render(w io.Writer) {
+	for _, comment := range s.Comments {
+		fmt.Fprintf(w, "-- %s\n", comment)
+	}
+	fmt.Fprintln(w)
+
+	testKeyspace, _ := generators.GetCreateKeyspaces(s.Schema)
+	fmt.Fprintf(w, "%s;\n", testKeyspace)
+	for _, stmt := range generators.GetCreateSchema(s.Schema) {
+		fmt.Fprintf(w, "%s;\n", stmt)
+	}
+	fmt.Fprintln(w)
+
+	if s.UseServerSideTimestamps {
+		fmt.Fprintln(w, "-- The mutations were written with server side timestamps.")
+	}
+	for _, e := range s.Mutations {
+		if e.Test.Outcome == journal.Failed {
+			fmt.Fprintf(w, "-- Failed on the test cluster, it may or may not have been applied: %s\n", e.Test.Error)
+		}
+		if e.Schema {
+			fmt.Fprintf(w, "%s;\n", e.Query)
+			continue
+		}
+		stmt, err := store.FormatMutation(s.Schema, e, !s.UseServerSideTimestamps)
+		if err != nil {
+			fmt.Fprintf(w, "-- Unable to render %s: %s\n", e.Query, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s;\n", stmt)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "%s;\n", s.Query)
+}
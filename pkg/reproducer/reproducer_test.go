@@ -0,0 +1,115 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reproducer_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scylladb/gemini/pkg/joberror"
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/replication"
+	"github.com/scylladb/gemini/pkg/reproducer"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	schema := &typedef.Schema{
+		Keyspace: typedef.Keyspace{
+			Name:              "ks1",
+			Replication:       replication.NewSimpleStrategy(),
+			OracleReplication: replication.NewSimpleStrategy(),
+		},
+		Tables: []*typedef.Table{{
+			Name:           "table1",
+			PartitionKeys:  typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+			ClusteringKeys: typedef.Columns{{Name: "ck0", Type: typedef.TYPE_INT}},
+			Columns:        typedef.Columns{{Name: "col0", Type: typedef.TYPE_TEXT}},
+		}},
+	}
+	insert := "INSERT INTO ks1.table1 (pk0,ck0,col0) VALUES (?,?,?)"
+	ts := time.UnixMicro(1700000000000000)
+	entries := []*journal.Entry{
+		{Time: ts, Query: insert, Values: []interface{}{1, 2, "b"}, Token: 10, HasToken: true},
+		{Time: ts.Add(-time.Second), Query: insert, Values: []interface{}{1, 1, "a"}, Token: 10, HasToken: true},
+		{Time: ts, Query: insert, Values: []interface{}{2, 1, "c"}, Token: 20, HasToken: true},
+		{Time: ts, Query: insert, Values: []interface{}{1, 3, "d"}, Token: 10, HasToken: true, Test: journal.Result{Outcome: journal.Skipped}},
+		{Time: ts.Add(time.Second), Query: insert, Values: []interface{}{1, 4, "e"}, Token: 10, HasToken: true},
+	}
+	path := filepath.Join(dir, "journal")
+	w, err := journal.Create(path, journal.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Test.Outcome == "" {
+			e.Test = journal.NewResult(nil)
+		}
+		if err = w.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := []*joberror.JobError{
+		{Timestamp: time.Now(), Message: "Validation failed", Query: "SELECT * FROM ks1.table1 WHERE pk0=1"},
+		{
+			Timestamp:  ts,
+			Message:    "Validation failed",
+			Query:      "SELECT * FROM ks1.table1 WHERE pk0=1",
+			StmtType:   "SelectStatement",
+			Mismatches: []joberror.Mismatch{{Kind: joberror.MissingRow, Token: 10}},
+		},
+	}
+	n, err := reproducer.Write(dir, schema, path, failures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || failures[0].Reproducer != "" || failures[1].Reproducer == "" {
+		t.Fatalf("expected a reproducer for the failure with mismatches only, got %d", n)
+	}
+	data, err := os.ReadFile(failures[1].Reproducer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := string(data)
+	for _, want := range []string{
+		"CREATE KEYSPACE IF NOT EXISTS ks1",
+		"CREATE TABLE IF NOT EXISTS ks1.table1",
+		"INSERT INTO ks1.table1 (pk0,ck0,col0) VALUES (1,1,'a') USING TIMESTAMP 1699999999000000;\n" +
+			"INSERT INTO ks1.table1 (pk0,ck0,col0) VALUES (1,2,'b') USING TIMESTAMP 1700000000000000;\n",
+		"SELECT * FROM ks1.table1 WHERE pk0=1;\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected the reproducer to contain %q, got\n%s", want, script)
+		}
+	}
+	for _, unwanted := range []string{"'c'", "'d'", "'e'"} {
+		if strings.Contains(script, unwanted) {
+			t.Errorf("the reproducer must not contain the mutation of %s, got\n%s", unwanted, script)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, "reproducer-002.cql")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a single reproducer, got %v", err)
+	}
+}
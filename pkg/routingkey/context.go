@@ -0,0 +1,49 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routingkey
+
+import (
+	"context"
+
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+type partitionKey struct{}
+
+type partition struct {
+	table  *typedef.Table
+	values typedef.Values
+}
+
+// NewContext returns a copy of ctx carrying the partition of the table the
+// statements executed with it write to or read from.
+func NewContext(ctx context.Context, table *typedef.Table, values typedef.Values) context.Context {
+	return context.WithValue(ctx, partitionKey{}, partition{table: table, values: values})
+}
+
+// FromContext returns the routing key of the partition carried by ctx, or
+// nil if there is none.
+func FromContext(ctx context.Context) []byte {
+	p, ok := ctx.Value(partitionKey{}).(partition)
+	if !ok {
+		return nil
+	}
+	// Creators reuse their buffer and are not safe for concurrent use.
+	key, err := (&Creator{}).CreateRoutingKey(p.table, p.values)
+	if err != nil {
+		return nil
+	}
+	return key
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scenario holds the scenarios of a run, the ordered phases gemini
+// runs instead of a warmup followed by a single mode.
+package scenario
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/scylladb/gemini/pkg/jobs"
+	"github.com/scylladb/gemini/pkg/ratelimit"
+	"github.com/scylladb/gemini/pkg/workload"
+)
+
+// SweepMode is the mode of a phase running a token range sweep, the other
+// modes are the ones of the jobs.
+const SweepMode = "sweep"
+
+// Phase is a phase of a scenario. The settings that are left out take the
+// values of the flags.
+type Phase struct {
+	// Workload weights the statements of the phase.
+	Workload       *workload.Profile `yaml:"workload"`
+	MutationRate   *float64          `yaml:"mutation_rate"`
+	ValidationRate *float64          `yaml:"validation_rate"`
+	// TableMutationRates and TableValidationRates are the rates of each
+	// table, keyed by name or by "" for every table.
+	TableMutationRates   map[string]float64 `yaml:"table_mutation_rates"`
+	TableValidationRates map[string]float64 `yaml:"table_validation_rates"`
+	// Shape is the parsed LoadShape.
+	Shape       ratelimit.Shape `yaml:"-"`
+	Name        string          `yaml:"name"`
+	Mode        string          `yaml:"mode"`
+	LoadShape   string          `yaml:"load_shape"`
+	Duration    time.Duration   `yaml:"duration"`
+	Concurrency uint64          `yaml:"concurrency"`
+}
+
+// Scenario is the ordered list of the phases of a run.
+type Scenario struct {
+	Phases []Phase `yaml:"phases"`
+}
+
+// ReadFile reads a YAML or JSON scenario file.
+func ReadFile(name string) (*Scenario, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses a YAML or JSON scenario. Phases are named after their mode
+// unless they are given a name.
+func Parse(data []byte) (*Scenario, error) {
+	var s Scenario
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&s); err != nil {
+		return nil, errors.Wrap(err, "invalid scenario")
+	}
+	if len(s.Phases) == 0 {
+		return nil, errors.New("invalid scenario: no phase")
+	}
+	for i := range s.Phases {
+		if err := s.Phases[i].init(); err != nil {
+			return nil, errors.Wrapf(err, "invalid phase %d of the scenario", i+1)
+		}
+	}
+	return &s, nil
+}
+
+func (p *Phase) init() (err error) {
+	switch p.Mode {
+	case jobs.WarmupMode, jobs.WriteMode, jobs.ReadMode, jobs.MixedMode:
+		if p.Duration <= 0 {
+			return errors.Errorf("no duration of %s phase", p.Mode)
+		}
+	case SweepMode:
+	default:
+		return errors.Errorf("unknown mode %q, expected %s, %s, %s, %s or %s",
+			p.Mode, jobs.WarmupMode, jobs.WriteMode, jobs.ReadMode, jobs.MixedMode, SweepMode)
+	}
+	if p.Name == "" {
+		p.Name = p.Mode
+	}
+	for _, rate := range []*float64{p.MutationRate, p.ValidationRate} {
+		if rate != nil && *rate < 0 {
+			return errors.New("negative rate")
+		}
+	}
+	for _, rates := range []map[string]float64{p.TableMutationRates, p.TableValidationRates} {
+		for table, rate := range rates {
+			if rate < 0 {
+				return errors.Errorf("negative rate of table %q", table)
+			}
+		}
+	}
+	if p.LoadShape != "" {
+		p.Shape, err = ratelimit.ParseShape(p.LoadShape)
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scenario
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/exp/rand"
+
+	"github.com/scylladb/gemini/pkg/workload"
+)
+
+const qualification = `
+phases:
+  - mode: warmup
+    duration: 10m
+  - name: heavy writes
+    mode: write
+    duration: 30m
+    concurrency: 50
+    mutation_rate: 2000
+    load_shape: ramp:duration=5m
+    workload:
+      mutations:
+        insert: 1
+        delete: 1
+  - mode: mixed
+    duration: 1h
+    table_validation_rates:
+      "": 100
+      table1: 10
+  - mode: read
+    duration: 20m
+    validation_rate: 0
+  - mode: sweep
+`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	s, err := Parse([]byte(qualification))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Phases) != 5 {
+		t.Fatalf("expected 5 phases, got %d", len(s.Phases))
+	}
+	var names []string
+	for _, p := range s.Phases {
+		names = append(names, p.Name)
+	}
+	if names[0] != "warmup" || names[1] != "heavy writes" || names[4] != "sweep" {
+		t.Errorf("unexpected phase names %v", names)
+	}
+	writes := s.Phases[1]
+	if writes.Duration != 30*time.Minute || writes.Concurrency != 50 || *writes.MutationRate != 2000 || writes.ValidationRate != nil {
+		t.Errorf("unexpected write phase %+v", writes)
+	}
+	if writes.Shape == nil || writes.Shape.Factor(0) != 0.1 {
+		t.Errorf("expected the ramp of the write phase, got %v", writes.Shape)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		if kind := writes.Workload.Mutation(r, workload.All); kind != workload.Insert && kind != workload.Delete {
+			t.Fatalf("expected only inserts and deletes, got %s", kind)
+		}
+	}
+	if s.Phases[0].Workload != nil || s.Phases[2].TableValidationRates["table1"] != 10 {
+		t.Errorf("unexpected phases %+v", s.Phases)
+	}
+	if rate := s.Phases[3].ValidationRate; rate == nil || *rate != 0 {
+		t.Errorf("expected an explicit unlimited validation rate, got %v", rate)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+	for name, data := range map[string]string{
+		"no phase":         "phases: []\n",
+		"unknown field":    "phases:\n  - mode: write\n    duration: 1m\n    threads: 3\n",
+		"unknown mode":     "phases:\n  - mode: compact\n    duration: 1m\n",
+		"no duration":      "phases:\n  - mode: write\n",
+		"invalid duration": "phases:\n  - mode: write\n    duration: soon\n",
+		"negative rate":    "phases:\n  - mode: write\n    duration: 1m\n    mutation_rate: -1\n",
+		"invalid shape":    "phases:\n  - mode: write\n    duration: 1m\n    load_shape: square\n",
+		"invalid workload": "phases:\n  - mode: write\n    duration: 1m\n    workload:\n      mutations:\n        upsert: 1\n",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
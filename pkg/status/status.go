@@ -18,7 +18,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -34,12 +36,63 @@ func (u *Uint64) MarshalJSON() ([]byte, error) {
 	return json.Marshal(u.Load())
 }
 
+// SweepResult summarizes the token range sweep of a table or a view.
+type SweepResult struct {
+	Table          string `json:"table"`
+	Rows           uint64 `json:"rows_compared"`
+	MismatchedRows uint64 `json:"mismatched_rows"`
+	FailedRanges   uint64 `json:"failed_ranges"`
+}
+
+// TaintedPartition is a partition whose state was left indeterminate by a
+// failed mutation and was not re-synchronized.
+type TaintedPartition struct {
+	Table        string   `json:"table"`
+	PartitionKey []string `json:"partition_key"`
+	Token        uint64   `json:"token"`
+}
+
+// TaintedResult summarizes the partitions tainted by failed mutations.
+type TaintedResult struct {
+	Partitions []TaintedPartition `json:"partitions,omitempty"`
+	Tainted    uint64             `json:"tainted_partitions"`
+	Resynced   uint64             `json:"resynced_partitions"`
+	Skipped    uint64             `json:"skipped_reads"`
+}
+
+// PhaseResult summarizes a phase of a scenario.
+type PhaseResult struct {
+	Name        string `json:"name"`
+	Mode        string `json:"mode"`
+	Elapsed     string `json:"elapsed"`
+	WriteOps    uint64 `json:"write_ops"`
+	WriteErrors uint64 `json:"write_errors"`
+	ReadOps     uint64 `json:"read_ops"`
+	ReadErrors  uint64 `json:"read_errors"`
+}
+
+// SystemStatus counts the errors of a system under test, when there are
+// several of them. GlobalStatus.Systems is keyed by their names.
+type SystemStatus struct {
+	WriteErrors Uint64 `json:"write_errors"`
+	ReadErrors  Uint64 `json:"read_errors"`
+}
+
 type GlobalStatus struct {
-	Errors      *joberror.ErrorList `json:"errors,omitempty"`
-	WriteOps    Uint64              `json:"write_ops"`
-	WriteErrors Uint64              `json:"write_errors"`
-	ReadOps     Uint64              `json:"read_ops"`
-	ReadErrors  Uint64              `json:"read_errors"`
+	Errors      *joberror.ErrorList      `json:"errors,omitempty"`
+	Systems     map[string]*SystemStatus `json:"systems,omitempty"`
+	Tainted     *TaintedResult           `json:"tainted,omitempty"`
+	Sweep       []SweepResult            `json:"sweep,omitempty"`
+	Phases      []PhaseResult            `json:"phases,omitempty"`
+	WriteOps    Uint64                   `json:"write_ops"`
+	WriteErrors Uint64                   `json:"write_errors"`
+	ReadOps     Uint64                   `json:"read_ops"`
+	ReadErrors  Uint64                   `json:"read_errors"`
+	// TaintedPartitions, ResyncedPartitions and SkippedReads are reported
+	// in Tainted at the end of the run.
+	TaintedPartitions  Uint64 `json:"-"`
+	ResyncedPartitions Uint64 `json:"-"`
+	SkippedReads       Uint64 `json:"-"`
 }
 
 func (gs *GlobalStatus) AddWriteError(err *joberror.JobError) {
@@ -47,6 +100,9 @@ func (gs *GlobalStatus) AddWriteError(err *joberror.JobError) {
 	fmt.Printf("Error detected: %#v", err)
 	gs.Errors.AddError(err)
 	gs.WriteErrors.Add(1)
+	if s, ok := gs.Systems[err.System]; ok {
+		s.WriteErrors.Add(1)
+	}
 }
 
 func (gs *GlobalStatus) AddReadError(err *joberror.JobError) {
@@ -54,6 +110,18 @@ func (gs *GlobalStatus) AddReadError(err *joberror.JobError) {
 	fmt.Printf("Error detected: %#v", err)
 	gs.Errors.AddError(err)
 	gs.ReadErrors.Add(1)
+	if s, ok := gs.Systems[err.System]; ok {
+		s.ReadErrors.Add(1)
+	}
+}
+
+// SetSystems sets the names of the systems under test errors are counted
+// for, it must be called before the run starts.
+func (gs *GlobalStatus) SetSystems(names []string) {
+	gs.Systems = make(map[string]*SystemStatus, len(names))
+	for _, name := range names {
+		gs.Systems[name] = &SystemStatus{}
+	}
 }
 
 func (gs *GlobalStatus) PrintResultAsJSON(w io.Writer, schema *typedef.Schema, version string) error {
@@ -76,6 +144,36 @@ func (gs *GlobalStatus) String() string {
 		gs.WriteOps.Load(), gs.ReadOps.Load(), gs.WriteErrors.Load(), gs.ReadErrors.Load())
 }
 
+// Meter measures the rates of the mutations and validations between its
+// updates, such as the updates of the status line.
+type Meter struct {
+	at     time.Time
+	writes uint64
+	reads  uint64
+}
+
+// Update returns the rates of the operations in operations per second since
+// the previous update, 0 on the first one.
+func (m *Meter) Update(gs *GlobalStatus, now time.Time) (writes, reads float64) {
+	w, r := gs.WriteOps.Load(), gs.ReadOps.Load()
+	if !m.at.IsZero() {
+		if elapsed := now.Sub(m.at).Seconds(); elapsed > 0 {
+			writes, reads = float64(w-m.writes)/elapsed, float64(r-m.reads)/elapsed
+		}
+	}
+	m.at, m.writes, m.reads = now, w, r
+	return writes, reads
+}
+
+// FormatRate formats an operation rate for the status line, with its target
+// if it is limited.
+func FormatRate(rate, target float64) string {
+	if target > 0 {
+		return fmt.Sprintf("%.0f/%.0f ops/s", rate, target)
+	}
+	return fmt.Sprintf("%.0f ops/s", rate)
+}
+
 func (gs *GlobalStatus) HasErrors() bool {
 	return gs.WriteErrors.Load() > 0 || gs.ReadErrors.Load() > 0
 }
@@ -90,8 +188,33 @@ func (gs *GlobalStatus) PrintResult(w io.Writer, schema *typedef.Schema, version
 		fmt.Printf("\tread ops:     %v\n", gs.ReadOps.Load())
 		fmt.Printf("\twrite errors: %v\n", gs.WriteErrors.Load())
 		fmt.Printf("\tread errors:  %v\n", gs.ReadErrors.Load())
+		if gs.Tainted != nil {
+			fmt.Printf("\ttainted partitions:  %v\n", gs.Tainted.Tainted)
+			fmt.Printf("\tresynced partitions: %v\n", gs.Tainted.Resynced)
+			fmt.Printf("\tskipped reads:       %v\n", gs.Tainted.Skipped)
+			for _, p := range gs.Tainted.Partitions {
+				fmt.Printf("\ttainted partition of %s: %v (token %v)\n", p.Table, p.PartitionKey, p.Token)
+			}
+		}
+		names := make([]string, 0, len(gs.Systems))
+		for name := range gs.Systems {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s := gs.Systems[name]
+			fmt.Printf("\t%s write errors: %v\n", name, s.WriteErrors.Load())
+			fmt.Printf("\t%s read errors:  %v\n", name, s.ReadErrors.Load())
+		}
+		for _, r := range gs.Phases {
+			fmt.Printf("\tphase %s (%s) in %s: write ops %v, write errors %v, read ops %v, read errors %v\n",
+				r.Name, r.Mode, r.Elapsed, r.WriteOps, r.WriteErrors, r.ReadOps, r.ReadErrors)
+		}
+		for _, r := range gs.Sweep {
+			fmt.Printf("\tsweep of %s: rows compared %v, mismatched rows %v, failed ranges %v\n", r.Table, r.Rows, r.MismatchedRows, r.FailedRanges)
+		}
 		for i, err := range gs.Errors.Errors() {
-			fmt.Printf("Error %d: %s\n", i, err)
+			fmt.Printf("Error %d: %v\n", i, err)
 		}
 		jsonSchema, _ := json.MarshalIndent(schema, "", "    ")
 		fmt.Printf("Schema: %v\n", string(jsonSchema))
@@ -62,3 +62,45 @@ func TestSerialization(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestSystemErrors(t *testing.T) {
+	t.Parallel()
+	st := status.NewGlobalStatus(10)
+	st.SetSystems([]string{"scylla", "cassandra"})
+	st.AddWriteError(&joberror.JobError{System: "scylla"})
+	st.AddReadError(&joberror.JobError{System: "cassandra"})
+	st.AddReadError(&joberror.JobError{System: "cassandra"})
+
+	result, err := json.Marshal(st.Systems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"cassandra":{"write_errors":0,"read_errors":2},"scylla":{"write_errors":1,"read_errors":0}}`
+	if diff := cmp.Diff(expected, string(result)); diff != "" {
+		t.Error(diff)
+	}
+	if st.WriteErrors.Load() != 1 || st.ReadErrors.Load() != 2 {
+		t.Errorf("expected the errors to be counted globally too, got %d and %d", st.WriteErrors.Load(), st.ReadErrors.Load())
+	}
+}
+
+func TestMeter(t *testing.T) {
+	t.Parallel()
+	st := status.NewGlobalStatus(10)
+	var m status.Meter
+	now := time.Unix(0, 0)
+	if w, r := m.Update(st, now); w != 0 || r != 0 {
+		t.Errorf("expected no rate on the first update, got %f and %f", w, r)
+	}
+	st.WriteOps.Store(200)
+	st.ReadOps.Store(50)
+	if w, r := m.Update(st, now.Add(2*time.Second)); w != 100 || r != 25 {
+		t.Errorf("expected rates of 100 and 25 ops/s, got %f and %f", w, r)
+	}
+	if s := status.FormatRate(99.6, 100); s != "100/100 ops/s" {
+		t.Errorf("unexpected rate %q", s)
+	}
+	if s := status.FormatRate(42, 0); s != "42 ops/s" {
+		t.Errorf("unexpected rate %q", s)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/pkg/errors"
+	"gopkg.in/inf.v0"
+)
+
+// ComparatorConfig relaxes the comparison of the values returned by the
+// oracle and the test system, it is usually read from a JSON file.
+type ComparatorConfig struct {
+	// Types maps a CQL type to the rules used to compare its values.
+	Types map[string]TypeComparator `json:"types,omitempty"`
+	// IgnoreTables lists tables and views that are not validated at all.
+	IgnoreTables []string `json:"ignore_tables,omitempty"`
+	// IgnoreColumns lists columns that are not compared, either as
+	// "column" in every table or as "table.column".
+	IgnoreColumns []string `json:"ignore_columns,omitempty"`
+}
+
+// TypeComparator holds the comparison rules of a CQL type, which rules
+// apply depends on the type.
+type TypeComparator struct {
+	// Truncate is a duration such as "1ms" both timestamp or time values
+	// are truncated to before they are compared.
+	Truncate string `json:"truncate,omitempty"`
+	// MaxULP is the number of representable float or double values two
+	// values may be apart and still be equal.
+	MaxULP uint64 `json:"max_ulp,omitempty"`
+	// NaNEqual makes a float or double NaN equal to another NaN.
+	NaNEqual bool `json:"nan_equal,omitempty"`
+}
+
+type comparatorBuilder func(rules TypeComparator) (cmp.Option, error)
+
+// comparatorBuilders maps the CQL types whose comparison can be configured
+// to the function building the comparison from its rules.
+var comparatorBuilders = map[string]comparatorBuilder{
+	"float": func(rules TypeComparator) (cmp.Option, error) {
+		if rules.Truncate != "" {
+			return nil, errors.New("truncate is not supported for float")
+		}
+		return cmp.Comparer(func(x, y float32) bool {
+			return floatsEqual(float64(x), float64(y), rules, func(f float64) uint64 {
+				return uint64(math.Float32bits(float32(f)))
+			})
+		}), nil
+	},
+	"double": func(rules TypeComparator) (cmp.Option, error) {
+		if rules.Truncate != "" {
+			return nil, errors.New("truncate is not supported for double")
+		}
+		return cmp.Comparer(func(x, y float64) bool {
+			return floatsEqual(x, y, rules, math.Float64bits)
+		}), nil
+	},
+	"timestamp": func(rules TypeComparator) (cmp.Option, error) {
+		if rules.MaxULP != 0 || rules.NaNEqual {
+			return nil, errors.New("only truncate is supported for timestamp")
+		}
+		d, err := time.ParseDuration(rules.Truncate)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid truncate duration")
+		}
+		return cmp.Comparer(func(x, y time.Time) bool {
+			return x.Truncate(d).Equal(y.Truncate(d))
+		}), nil
+	},
+	"time": func(rules TypeComparator) (cmp.Option, error) {
+		if rules.MaxULP != 0 || rules.NaNEqual {
+			return nil, errors.New("only truncate is supported for time")
+		}
+		d, err := time.ParseDuration(rules.Truncate)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid truncate duration")
+		}
+		return cmp.Comparer(func(x, y time.Duration) bool {
+			return x.Truncate(d) == y.Truncate(d)
+		}), nil
+	},
+}
+
+// floatsEqual compares two floats by the distance between their ordered
+// bit patterns, bits returns the bit pattern of the value at its precision.
+func floatsEqual(x, y float64, rules TypeComparator, bits func(float64) uint64) bool {
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return rules.NaNEqual && math.IsNaN(x) && math.IsNaN(y)
+	}
+	if x == y {
+		return true
+	}
+	if math.Signbit(x) != math.Signbit(y) {
+		// Values of opposite signs are only close if both are close to zero.
+		return bits(math.Abs(x))+bits(math.Abs(y)) <= rules.MaxULP
+	}
+	bx, by := bits(math.Abs(x)), bits(math.Abs(y))
+	if bx > by {
+		return bx-by <= rules.MaxULP
+	}
+	return by-bx <= rules.MaxULP
+}
+
+// comparer decides whether the values returned by the oracle and the test
+// system are equal.
+type comparer struct {
+	ignoreTables  map[string]struct{}
+	ignoreColumns map[string]struct{}
+	// types holds the comparison of the CQL types relaxed by the rules,
+	// which only applies to the columns of these types.
+	types   map[string]cmp.Option
+	options cmp.Options
+}
+
+var defaultComparer = &comparer{options: cellComparer}
+
+// valueTypes maps the CQL types whose comparison can be configured, and the
+// other CQL types the driver returns as the same Go type, to that Go type.
+var valueTypes = map[string]string{
+	"float":     "float32",
+	"double":    "float64",
+	"timestamp": "time.Time",
+	"date":      "time.Time",
+	"time":      "time.Duration",
+}
+
+var cellComparer = cmp.Options{
+	cmpopts.SortMaps(func(x, y *inf.Dec) bool {
+		return x.Cmp(y) < 0
+	}),
+	cmpopts.SortMaps(func(x, y *big.Int) bool {
+		return x.Cmp(y) < 0
+	}),
+	cmp.Comparer(func(x, y *inf.Dec) bool {
+		return x.Cmp(y) == 0
+	}),
+	cmp.Comparer(func(x, y *big.Int) bool {
+		return x.Cmp(y) == 0
+	}),
+}
+
+func newComparer(cfg *ComparatorConfig) (*comparer, error) {
+	if cfg == nil {
+		return defaultComparer, nil
+	}
+	c := &comparer{
+		ignoreTables:  make(map[string]struct{}, len(cfg.IgnoreTables)),
+		ignoreColumns: make(map[string]struct{}, len(cfg.IgnoreColumns)),
+		types:         make(map[string]cmp.Option, len(cfg.Types)),
+		options:       cellComparer,
+	}
+	for _, name := range cfg.IgnoreTables {
+		c.ignoreTables[name] = struct{}{}
+	}
+	for _, name := range cfg.IgnoreColumns {
+		c.ignoreColumns[name] = struct{}{}
+	}
+	types := make([]string, 0, len(cfg.Types))
+	for typ := range cfg.Types {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	for _, typ := range types {
+		build, ok := comparatorBuilders[typ]
+		if !ok {
+			return nil, errors.Errorf("values of type %s can not be compared differently", typ)
+		}
+		option, err := build(cfg.Types[typ])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid comparison of type %s", typ)
+		}
+		c.types[typ] = option
+	}
+	return c, nil
+}
+
+func (c *comparer) ignoresTable(table string) bool {
+	_, ok := c.ignoreTables[table]
+	return ok
+}
+
+// ignoresColumn reports whether a column of the result is not compared.
+// The elements of a tuple and the WRITETIME and TTL of a column are
+// ignored along with the column.
+func (c *comparer) ignoresColumn(table, column string) bool {
+	if len(c.ignoreColumns) == 0 {
+		return false
+	}
+	if i := strings.IndexByte(column, '('); i >= 0 && strings.HasSuffix(column, ")") {
+		column = column[i+1 : len(column)-1]
+	}
+	if i := strings.IndexByte(column, '['); i >= 0 {
+		column = column[:i]
+	}
+	if _, ok := c.ignoreColumns[column]; ok {
+		return true
+	}
+	_, ok := c.ignoreColumns[table+"."+column]
+	return ok
+}
+
+func (c *comparer) equal(x, y interface{}) bool {
+	return cmp.Equal(x, y, c.options)
+}
+
+// equalValues compares the values of a column of the given CQL type with
+// the rules of the types it holds, such as the elements of a collection. A
+// rule is left out if the column also holds another type returned as the
+// same Go type, which the rule would apply to as well.
+func (c *comparer) equalValues(typ string, x, y interface{}) bool {
+	if len(c.types) == 0 {
+		return c.equal(x, y)
+	}
+	names := strings.FieldsFunc(typ, func(r rune) bool {
+		return r == '<' || r == '>' || r == ',' || r == ' '
+	})
+	options := c.options
+	added := make(map[string]struct{})
+	for _, name := range names {
+		option, ok := c.types[name]
+		if _, dup := added[name]; !ok || dup || sharesValueType(name, names) {
+			continue
+		}
+		added[name] = struct{}{}
+		options = append(options[:len(options):len(options)], option)
+	}
+	return cmp.Equal(x, y, options)
+}
+
+// sharesValueType reports whether another one of the CQL types is returned
+// as the same Go type as typ.
+func sharesValueType(typ string, types []string) bool {
+	for _, other := range types {
+		if other != typ && valueTypes[other] == valueTypes[typ] {
+			return true
+		}
+	}
+	return false
+}
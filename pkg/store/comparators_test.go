@@ -0,0 +1,113 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestComparerValues(t *testing.T) {
+	t.Parallel()
+	c, err := newComparer(&ComparatorConfig{
+		Types: map[string]TypeComparator{
+			"double":    {MaxULP: 2, NaNEqual: true},
+			"float":     {MaxULP: 1},
+			"timestamp": {Truncate: "1ms"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		x, y  interface{}
+		name  string
+		typ   string
+		equal bool
+	}{
+		{name: "double within ulp", typ: "double", x: 1.0, y: math.Nextafter(math.Nextafter(1.0, 2), 2), equal: true},
+		{name: "double beyond ulp", typ: "double", x: 1.0, y: 1.0000001},
+		{name: "double nan", typ: "double", x: math.NaN(), y: math.NaN(), equal: true},
+		{name: "double nan and number", typ: "double", x: math.NaN(), y: 1.0},
+		{name: "double around zero", typ: "double", x: math.Copysign(0, -1), y: 0.0, equal: true},
+		{name: "float within ulp", typ: "float", x: float32(1), y: math.Nextafter32(1, 2), equal: true},
+		{name: "float nan", typ: "float", x: float32(math.NaN()), y: float32(math.NaN())},
+		{name: "floats in a list", typ: "list<float>", x: []float32{1, 2}, y: []float32{math.Nextafter32(1, 2), 2}, equal: true},
+		{name: "timestamp truncated", typ: "timestamp", x: ts.Add(100 * time.Microsecond), y: ts.Add(900 * time.Microsecond), equal: true},
+		{name: "timestamp differs", typ: "timestamp", x: ts, y: ts.Add(time.Millisecond)},
+		{name: "timestamps in a map", typ: "frozen<map<timestamp,timestamp>>", x: map[time.Time]time.Time{ts: ts}, y: map[time.Time]time.Time{ts: ts.Add(time.Microsecond)}, equal: true},
+		{name: "date not truncated", typ: "date", x: ts.Add(100 * time.Microsecond), y: ts.Add(900 * time.Microsecond)},
+		{name: "timestamps with dates", typ: "map<date,timestamp>", x: map[time.Time]time.Time{ts: ts}, y: map[time.Time]time.Time{ts: ts.Add(time.Microsecond)}},
+	}
+	for _, test := range tests {
+		if got := c.equalValues(test.typ, test.x, test.y); got != test.equal {
+			t.Errorf("%s: expected %v, got %v", test.name, test.equal, got)
+		}
+	}
+	if defaultComparer.equal(math.NaN(), math.NaN()) {
+		t.Error("NaN values must differ by default")
+	}
+}
+
+func TestComparerIgnoreRules(t *testing.T) {
+	t.Parallel()
+	c, err := newComparer(&ComparatorConfig{
+		IgnoreTables:  []string{"table2"},
+		IgnoreColumns: []string{"table1.col1", "col9"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.ignoresTable("table2") || c.ignoresTable("table1") {
+		t.Error("unexpected ignored tables")
+	}
+	for column, ignored := range map[string]bool{
+		"col0":            false,
+		"col1[1]":         true,
+		"writetime(col1)": true,
+		"col9":            true,
+	} {
+		if c.ignoresColumn("table1", column) != ignored {
+			t.Errorf("column %s: expected ignored %v", column, ignored)
+		}
+	}
+	if c.ignoresColumn("table3", "col1") {
+		t.Error("col1 is only ignored in table1")
+	}
+
+	table := modelTestSchema().Tables[0]
+	mismatches := c.diffCells(table,
+		map[string]interface{}{"pk0": 1, "ck0": 1, "col0": "a", "col1[0]": 1},
+		map[string]interface{}{"pk0": 1, "ck0": 1, "col0": "a", "col1[0]": 2},
+	)
+	if len(mismatches) != 0 {
+		t.Errorf("expected no mismatches, got %v", mismatches)
+	}
+}
+
+func TestComparerInvalidConfig(t *testing.T) {
+	t.Parallel()
+	for _, cfg := range []*ComparatorConfig{
+		{Types: map[string]TypeComparator{"text": {NaNEqual: true}}},
+		{Types: map[string]TypeComparator{"timestamp": {Truncate: "soon"}}},
+		{Types: map[string]TypeComparator{"double": {Truncate: "1ms"}}},
+	} {
+		if _, err := newComparer(cfg); err == nil {
+			t.Errorf("expected an error for %v", cfg.Types)
+		}
+	}
+}
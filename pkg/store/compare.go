@@ -0,0 +1,299 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/scylladb/gocqlx/v2/qb"
+	"gopkg.in/inf.v0"
+
+	"github.com/scylladb/gemini/pkg/routingkey"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// compareRowKeys orders rows as the cluster returns them for queries on the
+// base table: by partition token, then by partition key and clustering key
+// values. A nil row is an exhausted result and sorts after any other row.
+func compareRowKeys(t *typedef.Table, keyCreator *routingkey.Creator, a, b map[string]interface{}) int {
+	if a == nil || b == nil {
+		return compareBool(a == nil, b == nil)
+	}
+	if c := compareInt64(rowToken(t, keyCreator, a), rowToken(t, keyCreator, b)); c != 0 {
+		return c
+	}
+	return compareKeyValues(t, a, b)
+}
+
+// compareKeyValues orders rows by the values of their partition key and
+// then clustering key columns.
+func compareKeyValues(t *typedef.Table, a, b map[string]interface{}) int {
+	for _, cols := range []typedef.Columns{t.PartitionKeys, t.ClusteringKeys} {
+		for _, col := range cols {
+			if c := compareValues(col.Type, a[col.Name], b[col.Name]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func rowToken(t *typedef.Table, keyCreator *routingkey.Creator, row map[string]interface{}) int64 {
+	values := make([]interface{}, 0, len(t.PartitionKeys))
+	for _, pk := range t.PartitionKeys {
+		values = append(values, row[pk.Name])
+	}
+	token, err := keyCreator.GetHash(t, values)
+	if err != nil {
+		return 0
+	}
+	return int64(token)
+}
+
+// keyOrdered reports whether the rows returned by the query come back in
+// the order of compareRowKeys. This is the case for queries on the base
+// table restricted by its primary key columns only, materialized views and
+// secondary indexes return rows in the order of their own keys.
+func keyOrdered(t *typedef.Table, builder qb.Builder, values []interface{}) bool {
+	query, _ := builder.ToCql()
+	stmt, err := parseModelStmt(query, values)
+	if err != nil || stmt.kind != modelStmtSelect || stmt.table != t.Name {
+		return false
+	}
+	for _, rel := range stmt.where {
+		if rel.tokenOf != nil {
+			continue
+		}
+		if _, kind := findColumn(t, rel.column); kind == columnRegular {
+			return false
+		}
+	}
+	if len(stmt.selectors) == 0 {
+		return true
+	}
+	selected := make(map[string]struct{}, len(stmt.selectors))
+	for _, sel := range stmt.selectors {
+		if sel.function == "" && sel.alias == sel.column {
+			selected[sel.column] = struct{}{}
+		}
+	}
+	for _, cols := range []typedef.Columns{t.PartitionKeys, t.ClusteringKeys} {
+		for _, col := range cols {
+			if _, ok := selected[col.Name]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compareValues orders two values of the given column type, as returned
+// by the driver, the same way the database orders them in a primary key.
+// Null values sort first.
+func compareValues(t typedef.Type, a, b interface{}) int {
+	if an, bn := isNullKey(a), isNullKey(b); an || bn {
+		return compareBool(!an, !bn)
+	}
+	st, ok := t.(typedef.SimpleType)
+	if !ok {
+		return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+	}
+	switch st {
+	case typedef.TYPE_ASCII, typedef.TYPE_TEXT, typedef.TYPE_VARCHAR:
+		return strings.Compare(asString(a), asString(b))
+	case typedef.TYPE_BLOB:
+		return bytes.Compare(asBytes(a), asBytes(b))
+	case typedef.TYPE_BOOLEAN:
+		av, _ := a.(bool)
+		bv, _ := b.(bool)
+		return compareBool(av, bv)
+	case typedef.TYPE_BIGINT, typedef.TYPE_INT, typedef.TYPE_SMALLINT, typedef.TYPE_TINYINT, typedef.TYPE_TIME:
+		return compareInt64(asInt64(a), asInt64(b))
+	case typedef.TYPE_FLOAT, typedef.TYPE_DOUBLE:
+		return compareFloat64(asFloat64(a), asFloat64(b))
+	case typedef.TYPE_DECIMAL:
+		av, _ := a.(*inf.Dec)
+		bv, _ := b.(*inf.Dec)
+		return av.Cmp(bv)
+	case typedef.TYPE_VARINT:
+		av, _ := a.(*big.Int)
+		bv, _ := b.(*big.Int)
+		return av.Cmp(bv)
+	case typedef.TYPE_DATE, typedef.TYPE_TIMESTAMP:
+		av, _ := a.(time.Time)
+		bv, _ := b.(time.Time)
+		return av.Compare(bv)
+	case typedef.TYPE_INET:
+		return bytes.Compare(inetBytes(asString(a)), inetBytes(asString(b)))
+	case typedef.TYPE_TIMEUUID:
+		av, _ := a.(gocql.UUID)
+		bv, _ := b.(gocql.UUID)
+		if c := compareInt64(av.Timestamp(), bv.Timestamp()); c != 0 {
+			return c
+		}
+		return compareSignedBytes(av[8:], bv[8:])
+	case typedef.TYPE_UUID:
+		av, _ := a.(gocql.UUID)
+		bv, _ := b.(gocql.UUID)
+		if c := compareInt64(int64(av.Version()), int64(bv.Version())); c != 0 {
+			return c
+		}
+		if av.Version() == 1 {
+			if c := compareInt64(av.Timestamp(), bv.Timestamp()); c != 0 {
+				return c
+			}
+		}
+		return compareSignedBytes(av[:], bv[:])
+	case typedef.TYPE_DURATION:
+		av, _ := a.(gocql.Duration)
+		bv, _ := b.(gocql.Duration)
+		if c := compareInt64(int64(av.Months), int64(bv.Months)); c != 0 {
+			return c
+		}
+		if c := compareInt64(int64(av.Days), int64(bv.Days)); c != 0 {
+			return c
+		}
+		return compareInt64(av.Nanoseconds, bv.Nanoseconds)
+	default:
+		return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+	}
+}
+
+func isNullKey(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case *inf.Dec:
+		return val == nil
+	case *big.Int:
+		return val == nil
+	default:
+		return false
+	}
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareFloat64 follows the Java Float.compare semantics used by the
+// database: NaN is greater than any other value, including +Inf.
+func compareFloat64(a, b float64) int {
+	an, bn := math.IsNaN(a), math.IsNaN(b)
+	switch {
+	case an || bn:
+		return compareBool(an, bn)
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareSignedBytes(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareInt64(int64(int8(a[i])), int64(int8(b[i]))); c != 0 {
+			return c
+		}
+	}
+	return compareInt64(int64(len(a)), int64(len(b)))
+}
+
+func inetBytes(s string) []byte {
+	ip := net.ParseIP(s)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func asString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func asBytes(v interface{}) []byte {
+	switch val := v.(type) {
+	case []byte:
+		return val
+	case string:
+		return []byte(val)
+	default:
+		return nil
+	}
+}
+
+func asInt64(v interface{}) int64 {
+	switch val := v.(type) {
+	case int:
+		return int64(val)
+	case int8:
+		return int64(val)
+	case int16:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case int64:
+		return val
+	case time.Duration:
+		return int64(val)
+	default:
+		return 0
+	}
+}
+
+func asFloat64(v interface{}) float64 {
+	switch val := v.(type) {
+	case float32:
+		return float64(val)
+	case float64:
+		return val
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/inf.v0"
+
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+func TestSortRows(t *testing.T) {
+	t.Parallel()
+	table := &typedef.Table{
+		Name:          "table1",
+		PartitionKeys: typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+		ClusteringKeys: typedef.Columns{
+			{Name: "ck0", Type: typedef.TYPE_DECIMAL},
+			{Name: "ck1", Type: typedef.TYPE_INET},
+			{Name: "ck2", Type: typedef.TYPE_FLOAT},
+			{Name: "ck3", Type: typedef.TYPE_BLOB},
+		},
+	}
+	row := func(pk int, ck0 int64, ck1 string, ck2 float32, ck3 string) map[string]interface{} {
+		return map[string]interface{}{"pk0": pk, "ck0": inf.NewDec(ck0, 1), "ck1": ck1, "ck2": ck2, "ck3": []byte(ck3)}
+	}
+	expected := []map[string]interface{}{
+		row(1, -10, "10.0.0.1", 0, ""),
+		row(1, 2, "9.0.0.1", 0, ""),
+		row(1, 2, "10.0.0.1", -1, "b"),
+		row(1, 2, "10.0.0.1", 1, "a"),
+		row(1, 2, "10.0.0.1", 1, "b"),
+		row(1, 2, "10.0.0.1", float32(math.NaN()), ""),
+		row(1, 11, "10.0.0.1", 0, ""),
+	}
+	rows := []map[string]interface{}{
+		expected[6], expected[4], expected[0], expected[5], expected[2], expected[3], expected[1],
+	}
+	sortRows(table, rows)
+	opts := cmp.Options{cellComparer, cmp.Comparer(func(x, y float32) bool {
+		return x == y || (math.IsNaN(float64(x)) && math.IsNaN(float64(y)))
+	})}
+	if diff := cmp.Diff(expected, rows, opts); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -16,6 +16,7 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"time"
 
@@ -23,20 +24,20 @@ import (
 
 	"github.com/gocql/gocql"
 	"github.com/pkg/errors"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/scylladb/gocqlx/v2/qb"
 	"go.uber.org/zap"
 
+	"github.com/scylladb/gemini/pkg/metrics"
 	"github.com/scylladb/gemini/pkg/typedef"
 )
 
 type cqlStore struct {
 	session                 *gocql.Session
 	schema                  *typedef.Schema
-	ops                     *prometheus.CounterVec
 	logger                  *zap.Logger
 	system                  string
 	maxRetriesMutate        int
+	pageSize                int
 	maxRetriesMutateSleep   time.Duration
 	useServerSideTimestamps bool
 }
@@ -45,16 +46,27 @@ func (cs *cqlStore) name() string {
 	return cs.system
 }
 
-func (cs *cqlStore) mutate(ctx context.Context, builder qb.Builder, values ...interface{}) (err error) {
+func (cs *cqlStore) mutate(ctx context.Context, builder qb.Builder, ts time.Time, values ...interface{}) (err error) {
 	var i int
 	for i = 0; i < cs.maxRetriesMutate; i++ {
-		// retry with new timestamp as list modification with the same ts
-		// will produce duplicated values, see https://github.com/scylladb/scylladb/issues/7937
-		err = cs.doMutate(ctx, builder, time.Now(), values...)
+		if i > 0 {
+			// The retries keep the timestamp shared with the other systems
+			// so that WRITETIME is the same on all of them, except for list
+			// appends which would be duplicated by a retry with the same
+			// timestamp, see https://github.com/scylladb/scylladb/issues/7937
+			if cs.appendsToList(builder, values) {
+				ts = time.Now()
+			}
+			metrics.MutationRetries.WithLabelValues(cs.system).Inc()
+		}
+		err = cs.doMutate(ctx, builder, ts, values...)
 		if err == nil {
-			cs.ops.WithLabelValues(cs.system, opType(builder)).Inc()
+			metrics.CQLRequests.WithLabelValues(cs.system, opType(builder)).Inc()
 			return nil
 		}
+		if errs.Is(err, ErrInvalidRequest) {
+			break
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -67,6 +79,37 @@ func (cs *cqlStore) mutate(ctx context.Context, builder qb.Builder, values ...in
 	return err
 }
 
+// appendsToList reports whether the statement appends or prepends elements
+// to a list. Lists are not compared by WRITETIME, so such a statement can be
+// retried with a new timestamp.
+func (cs *cqlStore) appendsToList(builder qb.Builder, values []interface{}) bool {
+	if cs.schema == nil {
+		return false
+	}
+	query, _ := builder.ToCql()
+	stmt, err := parseModelStmt(query, values)
+	if err != nil {
+		return false
+	}
+	stmts := []*modelStmt{stmt}
+	if stmt.kind == modelStmtBatch {
+		stmts = stmt.stmts
+	}
+	for _, s := range stmts {
+		for _, a := range s.assignments {
+			if a.kind != modelAssignAdd && a.kind != modelAssignPrepend {
+				continue
+			}
+			for _, t := range cs.schema.Tables {
+				if col, _ := findColumn(t, a.column); t.Name == s.table && col != nil && isList(col.Type) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 func (cs *cqlStore) doMutate(ctx context.Context, builder qb.Builder, ts time.Time, values ...interface{}) error {
 	queryBody, _ := builder.ToCql()
 
@@ -77,24 +120,37 @@ func (cs *cqlStore) doMutate(ctx context.Context, builder qb.Builder, ts time.Ti
 		query = query.WithTimestamp(ts.UnixNano() / 1000)
 	}
 
-	if err := query.Exec(); err != nil {
+	start := time.Now()
+	err := query.Exec()
+	metrics.CQLRequestLatency.WithLabelValues(cs.system, opType(builder)).Observe(time.Since(start).Seconds())
+	if err != nil {
 		if errs.Is(err, context.DeadlineExceeded) {
 			if w := cs.logger.Check(zap.DebugLevel, "deadline exceeded for mutation query"); w != nil {
 				w.Write(zap.String("system", cs.system), zap.String("query", queryBody), zap.Error(err))
 			}
 		}
 		if !ignore(err) {
-			return errors.Wrapf(err, "[cluster = %s, query = '%s']", cs.system, queryBody)
+			err = errors.Wrapf(err, "[cluster = %s, query = '%s']", cs.system, queryBody)
+			if invalidRequest(err) {
+				return fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+			}
+			return err
 		}
 	}
 	return nil
 }
 
-func (cs *cqlStore) load(ctx context.Context, builder qb.Builder, values []interface{}) (result []map[string]interface{}, err error) {
+func (cs *cqlStore) load(ctx context.Context, builder qb.Builder, values []interface{}) rowIterator {
 	query, _ := builder.ToCql()
-	iter := cs.session.Query(query, values...).WithContext(ctx).Iter()
-	cs.ops.WithLabelValues(cs.system, opType(builder)).Inc()
-	return loadSet(iter), iter.Close()
+	q := cs.session.Query(query, values...).WithContext(ctx)
+	if cs.pageSize > 0 {
+		q = q.PageSize(cs.pageSize)
+	}
+	metrics.CQLRequests.WithLabelValues(cs.system, opType(builder)).Inc()
+	start := time.Now()
+	iter := q.Iter()
+	metrics.CQLRequestLatency.WithLabelValues(cs.system, opType(builder)).Observe(time.Since(start).Seconds())
+	return cqlIterator{iter: iter}
 }
 
 func (cs cqlStore) close() error {
@@ -126,6 +182,16 @@ func ignore(err error) bool {
 	}
 }
 
+// cqlErrInvalid is the code of the errors of the invalid requests, which gocql
+// does not export.
+const cqlErrInvalid = 0x2200
+
+// invalidRequest reports whether the cluster rejected the statement as invalid.
+func invalidRequest(err error) bool {
+	var reqErr gocql.RequestError
+	return errors.As(err, &reqErr) && reqErr.Code() == cqlErrInvalid
+}
+
 func opType(builder qb.Builder) string {
 	switch builder.(type) {
 	case *qb.InsertBuilder:
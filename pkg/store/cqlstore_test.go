@@ -0,0 +1,111 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/scylladb/gocqlx/v2/qb"
+
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+func TestAppendsToList(t *testing.T) {
+	t.Parallel()
+	schema := &typedef.Schema{
+		Keyspace: typedef.Keyspace{Name: "ks1"},
+		Tables: []*typedef.Table{{
+			Name:          "table1",
+			PartitionKeys: typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+			Columns: typedef.Columns{
+				{Name: "col0", Type: &typedef.BagType{ComplexType: typedef.TYPE_LIST, ValueType: typedef.TYPE_INT}},
+				{Name: "col1", Type: &typedef.BagType{ComplexType: typedef.TYPE_SET, ValueType: typedef.TYPE_INT}},
+			},
+		}},
+	}
+	cs := &cqlStore{schema: schema}
+	tests := map[string]struct {
+		builder qb.Builder
+		values  []interface{}
+		want    bool
+	}{
+		"insert": {
+			builder: qb.Insert("ks1.table1").Columns("pk0", "col0"),
+			values:  []interface{}{1, []int{1}},
+		},
+		"list_append": {
+			builder: qb.Update("ks1.table1").Add("col0").Where(qb.Eq("pk0")),
+			values:  []interface{}{[]int{1}, 1},
+			want:    true,
+		},
+		"list_prepend": {
+			builder: qb.Update("ks1.table1").SetLit("col0", "?+col0").Where(qb.Eq("pk0")),
+			values:  []interface{}{[]int{1}, 1},
+			want:    true,
+		},
+		"set_add": {
+			builder: qb.Update("ks1.table1").Add("col1").Where(qb.Eq("pk0")),
+			values:  []interface{}{[]int{1}, 1},
+		},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := cs.appendsToList(test.builder, test.values); got != test.want {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+type requestError struct {
+	code int
+}
+
+func (e requestError) Code() int {
+	return e.code
+}
+
+func (e requestError) Message() string {
+	return "request error"
+}
+
+func (e requestError) Error() string {
+	return e.Message()
+}
+
+func TestInvalidRequest(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"invalid":     {err: errors.Wrap(requestError{code: cqlErrInvalid}, "[cluster = test]"), want: true},
+		"unavailable": {err: requestError{code: 0x1000}},
+		"timeout":     {err: context.DeadlineExceeded},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := invalidRequest(test.err); got != test.want {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"gopkg.in/inf.v0"
+
+	"github.com/scylladb/gemini/pkg/joberror"
+	"github.com/scylladb/gemini/pkg/routingkey"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// maxMismatchesInMessage limits how many mismatches are spelled out in the
+// error message, all of them are still available in ValidationError.Mismatches.
+const maxMismatchesInMessage = 5
+
+// maxStoredMismatches limits how many mismatches are kept when comparing
+// results that may differ in a large number of rows.
+const maxStoredMismatches = 100
+
+// maxTTLDrift is the number of seconds the TTL left of a cell may differ
+// between the systems, which read it and may have written it at slightly
+// different times.
+const maxTTLDrift = 5
+
+// ValidationError is returned by Check when the oracle and the test cluster
+// returned different results.
+type ValidationError struct {
+	Message    string
+	Mismatches []joberror.Mismatch
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// diffRows matches the rows by primary key and reports every row missing
+// on either side and every cell whose value differs.
+func (c *comparer) diffRows(table *typedef.Table, oracleRows, testRows []map[string]interface{}) []joberror.Mismatch {
+	testByKey := make(map[string][]int, len(testRows))
+	for i, key := range pks(table, testRows) {
+		testByKey[key] = append(testByKey[key], i)
+	}
+	matched := make([]bool, len(testRows))
+	var mismatches []joberror.Mismatch
+	for i, key := range pks(table, oracleRows) {
+		candidates := testByKey[key]
+		if len(candidates) == 0 {
+			mismatches = append(mismatches, joberror.Mismatch{
+				Kind:       joberror.MissingRow,
+				PrimaryKey: primaryKey(table, oracleRows[i]),
+				Token:      partitionToken(table, oracleRows[i]),
+			})
+			continue
+		}
+		testByKey[key] = candidates[1:]
+		matched[candidates[0]] = true
+		mismatches = append(mismatches, c.diffCells(table, oracleRows[i], testRows[candidates[0]])...)
+	}
+	for i, row := range testRows {
+		if !matched[i] {
+			mismatches = append(mismatches, joberror.Mismatch{
+				Kind:       joberror.ExtraRow,
+				PrimaryKey: primaryKey(table, row),
+				Token:      partitionToken(table, row),
+			})
+		}
+	}
+	return mismatches
+}
+
+func (c *comparer) diffCells(table *typedef.Table, oracleRow, testRow map[string]interface{}) []joberror.Mismatch {
+	if c.equal(oracleRow, testRow) {
+		return nil
+	}
+	var mismatches []joberror.Mismatch
+	for _, column := range rowColumns(table, oracleRow, testRow) {
+		if c.ignoresColumn(table.Name, column.name) {
+			continue
+		}
+		oracleValue, testValue := oracleRow[column.name], testRow[column.name]
+		if c.equalValues(column.typ, oracleValue, testValue) || closeTTLs(column.name, oracleValue, testValue) {
+			continue
+		}
+		mismatches = append(mismatches, joberror.Mismatch{
+			Kind:        joberror.DifferingCell,
+			PrimaryKey:  primaryKey(table, oracleRow),
+			Token:       partitionToken(table, oracleRow),
+			Column:      column.name,
+			Type:        column.typ,
+			OracleValue: formatValue(oracleValue),
+			TestValue:   formatValue(testValue),
+			Expiring:    expiringCell(table, column.name, oracleRow, testRow),
+		})
+	}
+	return mismatches
+}
+
+// expiringCell reports whether the cell of a result column, or of the
+// WRITETIME or TTL selected for it, has a TTL on either system. When the
+// TTL of the cell was not selected it may have one unless it is a counter,
+// whether the table may be written with a TTL is up to the caller.
+func expiringCell(table *typedef.Table, column string, oracleRow, testRow map[string]interface{}) bool {
+	if i := strings.IndexByte(column, '('); i >= 0 && strings.HasSuffix(column, ")") {
+		column = column[i+1 : len(column)-1]
+	}
+	if i := strings.IndexByte(column, '['); i >= 0 {
+		column = column[:i]
+	}
+	ttl := "ttl(" + column + ")"
+	x, oracleOK := oracleRow[ttl]
+	y, testOK := testRow[ttl]
+	if !oracleOK && !testOK {
+		return !table.IsCounterTable()
+	}
+	return asInt64(x) != 0 || asInt64(y) != 0
+}
+
+// closeTTLs reports whether the values are the TTLs left of a cell that
+// expires on both systems and differ by maxTTLDrift seconds at most.
+func closeTTLs(column string, x, y interface{}) bool {
+	if !strings.HasPrefix(column, "ttl(") {
+		return false
+	}
+	tx, ty := asInt64(x), asInt64(y)
+	if tx == 0 || ty == 0 {
+		return false
+	}
+	return tx-ty <= maxTTLDrift && ty-tx <= maxTTLDrift
+}
+
+type resultColumn struct {
+	name string
+	typ  string
+}
+
+// rowColumns lists the columns present in either row in schema order.
+// Tuples are returned by the driver as one column per element.
+func rowColumns(table *typedef.Table, rows ...map[string]interface{}) []resultColumn {
+	var out []resultColumn
+	known := make(map[string]struct{})
+	add := func(name, typ string) {
+		if _, ok := known[name]; ok {
+			return
+		}
+		for _, row := range rows {
+			if _, ok := row[name]; ok {
+				known[name] = struct{}{}
+				out = append(out, resultColumn{name: name, typ: typ})
+				return
+			}
+		}
+	}
+	for _, cols := range []typedef.Columns{table.PartitionKeys, table.ClusteringKeys, table.Columns} {
+		for _, col := range cols {
+			if tt, ok := col.Type.(*typedef.TupleType); ok {
+				for i, vt := range tt.ValueTypes {
+					add(gocql.TupleColumnName(col.Name, i), vt.CQLDef())
+				}
+				continue
+			}
+			add(col.Name, col.Type.CQLDef())
+		}
+	}
+	var rest []string
+	for _, row := range rows {
+		for name := range row {
+			if _, ok := known[name]; !ok {
+				rest = append(rest, name)
+			}
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		add(name, selectorType(name))
+	}
+	return out
+}
+
+// selectorType returns the type of the WRITETIME and TTL selectors, which
+// the driver names after the function and the column.
+func selectorType(name string) string {
+	switch {
+	case strings.HasPrefix(name, "writetime("):
+		return "bigint"
+	case strings.HasPrefix(name, "ttl("):
+		return "int"
+	default:
+		return ""
+	}
+}
+
+func primaryKey(table *typedef.Table, row map[string]interface{}) map[string]string {
+	out := make(map[string]string, len(table.PartitionKeys)+len(table.ClusteringKeys))
+	for _, cols := range []typedef.Columns{table.PartitionKeys, table.ClusteringKeys} {
+		for _, col := range cols {
+			if v := formatValue(row[col.Name]); v != nil {
+				out[col.Name] = *v
+			}
+		}
+	}
+	return out
+}
+
+// partitionToken returns the token of the partition of a row, rows of
+// materialized views hold the partition key columns of their base table.
+func partitionToken(table *typedef.Table, row map[string]interface{}) uint64 {
+	return uint64(rowToken(table, &routingkey.Creator{}, row))
+}
+
+// formatValue renders a value returned by the driver as a CQL literal,
+// it returns nil for null values.
+func formatValue(v interface{}) *string {
+	var s string
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		s = "0x" + hex.EncodeToString(val)
+	case string:
+		s = val
+	case *inf.Dec:
+		if val == nil {
+			return nil
+		}
+		s = val.String()
+	case *big.Int:
+		if val == nil {
+			return nil
+		}
+		s = val.String()
+	case time.Time:
+		if val.IsZero() {
+			return nil
+		}
+		s = val.UTC().Format(time.RFC3339Nano)
+	default:
+		s = fmt.Sprintf("%v", val)
+	}
+	return &s
+}
+
+func mismatchesMessage(mismatches []joberror.Mismatch) string {
+	descriptions := make([]string, 0, maxMismatchesInMessage)
+	for i, m := range mismatches {
+		if i == maxMismatchesInMessage {
+			descriptions = append(descriptions, fmt.Sprintf("and %d more", len(mismatches)-i))
+			break
+		}
+		key := make([]string, 0, len(m.PrimaryKey))
+		for name, value := range m.PrimaryKey {
+			key = append(key, name+"="+value)
+		}
+		sort.Strings(key)
+		desc := fmt.Sprintf("%s at (%s)", m.Kind, strings.Join(key, ", "))
+		switch m.Kind {
+		case joberror.DifferingCell:
+			desc += fmt.Sprintf(" in column %s %s: oracle=%s test=%s", m.Column, m.Type, valueOrNull(m.OracleValue), valueOrNull(m.TestValue))
+		case joberror.OutOfOrderRow:
+			desc += " returned by " + m.System
+		}
+		descriptions = append(descriptions, desc)
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+func valueOrNull(v *string) string {
+	if v == nil {
+		return "null"
+	}
+	return *v
+}
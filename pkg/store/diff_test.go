@@ -0,0 +1,477 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/scylladb/gocqlx/v2/qb"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/joberror"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// ignoreHidden leaves out the fields of the mismatches missing from the results.
+var ignoreHidden = cmpopts.IgnoreFields(joberror.Mismatch{}, "Token", "Expiring")
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestCheckMismatches(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	oracle := newModelStore(schema, "oracle")
+	test := newModelStore(schema, "test")
+	ds := delegatingStore{oracleStore: oracle, testStores: []storeLoader{test}, comparer: defaultComparer, validations: true, logger: zap.NewNop()}
+
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").TupleColumn("col1", 2)
+	for _, s := range []*modelStore{oracle, test} {
+		if err := s.mutate(ctx, insert, time.Now(), 1, 1, "a", 1, "b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := oracle.mutate(ctx, insert, time.Now(), 1, 2, "a", 1, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.mutate(ctx, insert, time.Now(), 1, 3, "a", 1, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.mutate(ctx, insert, time.Now(), 1, 1, "a", 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restriction on a regular column does not return rows in primary
+	// key order, so both results are compared as a whole.
+	err := ds.Check(ctx, schema.Tables[0], qb.Select("ks1.table1").Where(qb.Eq("col0")).AllowFiltering(), "a")
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	expected := []joberror.Mismatch{
+		{
+			Kind:        joberror.DifferingCell,
+			PrimaryKey:  map[string]string{"pk0": "1", "ck0": "1"},
+			Column:      "col1[0]",
+			Type:        "int",
+			OracleValue: strPtr("1"),
+			TestValue:   strPtr("2"),
+		},
+		{
+			Kind:        joberror.DifferingCell,
+			PrimaryKey:  map[string]string{"pk0": "1", "ck0": "1"},
+			Column:      "col1[1]",
+			Type:        "text",
+			OracleValue: strPtr("b"),
+			TestValue:   strPtr(""),
+		},
+		{
+			Kind:       joberror.MissingRow,
+			PrimaryKey: map[string]string{"pk0": "1", "ck0": "2"},
+		},
+		{
+			Kind:       joberror.ExtraRow,
+			PrimaryKey: map[string]string{"pk0": "1", "ck0": "3"},
+		},
+	}
+	if diff := cmp.Diff(expected, validationErr.Mismatches, ignoreHidden); diff != "" {
+		t.Error(diff)
+	}
+
+	// Results of a partition query are compared in primary key order,
+	// the comparison stops at the first row that differs.
+	err = ds.Check(ctx, schema.Tables[0], qb.Select("ks1.table1").Where(qb.Eq("pk0")), 1)
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if diff := cmp.Diff(expected[:2], validationErr.Mismatches, ignoreHidden); diff != "" {
+		t.Error(diff)
+	}
+
+	err = ds.Check(ctx, schema.Tables[0], qb.Select("ks1.table1").Where(qb.Eq("pk0"), qb.Gt("ck0")), 1, 1)
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if diff := cmp.Diff(expected[2:3], validationErr.Mismatches, ignoreHidden); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCompareTokenRange(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	oracle := newModelStore(schema, "oracle")
+	test := newModelStore(schema, "test")
+	ds := delegatingStore{oracleStore: oracle, testStores: []storeLoader{test}, comparer: defaultComparer, validations: true, logger: zap.NewNop()}
+
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")
+	for pk := 0; pk < 50; pk++ {
+		for _, s := range []*modelStore{oracle, test} {
+			if err := s.mutate(ctx, insert, time.Now(), pk, 0, "a"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := test.mutate(ctx, insert, time.Now(), 7, 0, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := oracle.mutate(ctx, insert, time.Now(), 9, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	query := qb.Select("ks1.table1").Where(qb.GtLit("token(pk0)", "?"), qb.LtOrEqLit("token(pk0)", "?"))
+	var rows, mismatchedRows int
+	bounds := []int64{math.MinInt64, -1 << 62, 0, 1 << 62, math.MaxInt64}
+	for i := 1; i < len(bounds); i++ {
+		result, err := ds.Compare(ctx, schema.Tables[0], query, bounds[i-1], bounds[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows += result.Rows
+		mismatchedRows += result.MismatchedRows
+	}
+	if rows != 51 {
+		t.Errorf("expected 51 rows compared, got %d", rows)
+	}
+	if mismatchedRows != 2 {
+		t.Errorf("expected 2 mismatched rows, got %d", mismatchedRows)
+	}
+}
+
+func TestCheckWriteTimes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	oracle := newModelStore(schema, "oracle")
+	test := newModelStore(schema, "test")
+	ds := delegatingStore{oracleStore: oracle, testStores: []storeLoader{test}, comparer: defaultComparer, validations: true, logger: zap.NewNop()}
+
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")
+	if err := oracle.mutate(ctx, insert, ts, 1, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.mutate(ctx, insert, ts.Add(time.Millisecond), 1, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	query := qb.Select("ks1.table1").Columns("pk0", "ck0", "col0", "WRITETIME(col0)", "TTL(col0)").Where(qb.Eq("pk0"))
+	rows, err := loadSet(oracle.load(ctx, query, []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["writetime(col0)"] != ts.UnixNano()/1000 || rows[0]["ttl(col0)"] != 0 {
+		t.Fatalf("unexpected result %v", rows)
+	}
+
+	err = ds.Check(ctx, schema.Tables[0], query, 1)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	expected := []joberror.Mismatch{{
+		Kind:        joberror.DifferingCell,
+		PrimaryKey:  map[string]string{"pk0": "1", "ck0": "1"},
+		Column:      "writetime(col0)",
+		Type:        "bigint",
+		OracleValue: strPtr("1672531200000000"),
+		TestValue:   strPtr("1672531200001000"),
+	}}
+	if diff := cmp.Diff(expected, validationErr.Mismatches, ignoreHidden); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCheckExpiringData(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	oracle := newModelStore(schema, "oracle")
+	test := newModelStore(schema, "test")
+	ds := delegatingStore{oracleStore: oracle, testStores: []storeLoader{test}, comparer: defaultComparer, validations: true, logger: zap.NewNop()}
+
+	// The TTLs left differ by the time between the writes.
+	now := time.Now()
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").TTL(time.Hour)
+	if err := oracle.mutate(ctx, insert, now, 1, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.mutate(ctx, insert, now.Add(-2*time.Second), 1, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	query := qb.Select("ks1.table1").Columns("pk0", "ck0", "col0", "TTL(col0)").Where(qb.Eq("pk0"))
+	if err := ds.Check(ctx, schema.Tables[0], query, 1); err != nil {
+		t.Fatalf("expected TTLs to match, got %v", err)
+	}
+
+	// The row expired on the test system only when it is read first.
+	expiring := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").TTL(time.Second)
+	if err := oracle.mutate(ctx, expiring, now, 2, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.mutate(ctx, expiring, now.Add(-time.Second), 2, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	var validationErr *ValidationError
+	if err := ds.check(ctx, schema.Tables[0], query, 2); !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	ds.expiringWrites = true
+	if err := ds.Check(ctx, schema.Tables[0], query, 2); err != nil {
+		t.Fatalf("expected the check to be repeated once the row expired, got %v", err)
+	}
+}
+
+func TestMayHaveExpired(t *testing.T) {
+	t.Parallel()
+	schema := modelTestSchema()
+	table, counters := schema.Tables[0], schema.Tables[1]
+	ds := delegatingStore{comparer: defaultComparer, expiringWrites: true}
+	cell := func(oracleTTL, testTTL interface{}) []joberror.Mismatch {
+		return defaultComparer.diffCells(table,
+			map[string]interface{}{"pk0": 1, "ck0": 1, "col0": "a", "ttl(col0)": oracleTTL},
+			map[string]interface{}{"pk0": 1, "ck0": 1, "col0": "b", "ttl(col0)": testTTL},
+		)
+	}
+	tests := []struct {
+		name       string
+		table      *typedef.Table
+		mismatches []joberror.Mismatch
+		expired    bool
+	}{
+		{name: "cell without ttl", table: table, mismatches: cell(0, 0)},
+		{name: "cell with ttl", table: table, mismatches: cell(100, 0), expired: true},
+		{name: "cell without selected ttl", table: table, mismatches: defaultComparer.diffCells(table,
+			map[string]interface{}{"pk0": 1, "ck0": 1, "col0": "a"},
+			map[string]interface{}{"pk0": 1, "ck0": 1, "col0": "b"},
+		), expired: true},
+		{name: "missing row", table: table, mismatches: []joberror.Mismatch{{Kind: joberror.MissingRow}}, expired: true},
+		{name: "extra counter row", table: counters, mismatches: []joberror.Mismatch{{Kind: joberror.ExtraRow}}},
+		{name: "out of order row", table: table, mismatches: []joberror.Mismatch{{Kind: joberror.OutOfOrderRow}}},
+	}
+	for _, test := range tests {
+		if got := ds.mayHaveExpired(test.table, test.mismatches); got != test.expired {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expired, got)
+		}
+	}
+	lists := &typedef.Table{
+		Name:          "table3",
+		PartitionKeys: typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+		Columns:       typedef.Columns{{Name: "col0", Type: &typedef.BagType{ComplexType: typedef.TYPE_LIST, ValueType: typedef.TYPE_INT}}},
+	}
+	missing := []joberror.Mismatch{{Kind: joberror.MissingRow}}
+	if ds.mayHaveExpired(lists, missing) {
+		t.Error("tables with collections are not written with TTLs by default")
+	}
+	ds.expiringCollections = true
+	if !ds.mayHaveExpired(lists, missing) {
+		t.Error("expected a row of a table with collections to expire")
+	}
+	ds.expiringWrites = false
+	if ds.mayHaveExpired(table, cell(100, 0)) {
+		t.Error("nothing expires without TTL writes")
+	}
+}
+
+// fixedStore returns the same rows for every query.
+type fixedStore struct {
+	system string
+	rows   []map[string]interface{}
+}
+
+func (s *fixedStore) mutate(context.Context, qb.Builder, time.Time, ...interface{}) error {
+	return nil
+}
+
+func (s *fixedStore) load(context.Context, qb.Builder, []interface{}) rowIterator {
+	return &sliceIterator{rows: append([]map[string]interface{}{}, s.rows...)}
+}
+
+func (s *fixedStore) close() error {
+	return nil
+}
+
+func (s *fixedStore) name() string {
+	return s.system
+}
+
+func TestCheckClusteringOrder(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	table := modelTestSchema().Tables[0]
+	rows := []map[string]interface{}{
+		{"pk0": 1, "ck0": 1, "col0": "a"},
+		{"pk0": 1, "ck0": 3, "col0": "a"},
+		{"pk0": 1, "ck0": 2, "col0": "a"},
+	}
+	query := qb.Select("ks1.table1").Where(qb.Eq("pk0"))
+	ds := delegatingStore{
+		oracleStore: &fixedStore{system: "oracle", rows: rows},
+		testStores:  []storeLoader{&fixedStore{system: "test", rows: rows}},
+		comparer:    defaultComparer,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+	// Both systems return the same rows, the wrong order goes unnoticed.
+	if err := ds.Check(ctx, table, query, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ds.verifyOrder = true
+	err := ds.Check(ctx, table, query, 1)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	expected := []joberror.Mismatch{
+		{Kind: joberror.OutOfOrderRow, PrimaryKey: map[string]string{"pk0": "1", "ck0": "2"}, System: "oracle"},
+		{Kind: joberror.OutOfOrderRow, PrimaryKey: map[string]string{"pk0": "1", "ck0": "2"}, System: "test"},
+	}
+	if diff := cmp.Diff(expected, validationErr.Mismatches, ignoreHidden); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestCheckSystemsUnderTest(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	oracle := newModelStore(schema, "oracle")
+	scylla := newModelStore(schema, "scylla")
+	cassandra := newModelStore(schema, "cassandra")
+	ds := delegatingStore{
+		oracleStore: oracle,
+		testStores:  []storeLoader{scylla, cassandra},
+		comparer:    defaultComparer,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")
+	if err := ds.Mutate(ctx, insert, 1, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	query := qb.Select("ks1.table1").Where(qb.Eq("pk0"))
+	if err := ds.Check(ctx, schema.Tables[0], query, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cassandra.mutate(ctx, insert, time.Now(), 1, 1, "b"); err != nil {
+		t.Fatal(err)
+	}
+	err := ds.Check(ctx, schema.Tables[0], query, 1)
+	var systemErrs SystemErrors
+	if !errors.As(err, &systemErrs) {
+		t.Fatalf("expected errors by system, got %v", err)
+	}
+	if len(systemErrs) != 1 || systemErrs["cassandra"] == nil {
+		t.Fatalf("expected only cassandra to fail, got %v", systemErrs)
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	expected := []joberror.Mismatch{{
+		Kind:        joberror.DifferingCell,
+		PrimaryKey:  map[string]string{"pk0": "1", "ck0": "1"},
+		Column:      "col0",
+		Type:        "text",
+		OracleValue: strPtr("a"),
+		TestValue:   strPtr("b"),
+		System:      "cassandra",
+	}}
+	if diff := cmp.Diff(expected, validationErr.Mismatches, ignoreHidden); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// barrierStore is a store whose reads only return once the reads of all the
+// stores sharing its barrier started.
+type barrierStore struct {
+	fixedStore
+	barrier *sync.WaitGroup
+}
+
+func (s *barrierStore) load(ctx context.Context, builder qb.Builder, values []interface{}) rowIterator {
+	s.barrier.Done()
+	done := make(chan struct{})
+	go func() {
+		s.barrier.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return s.fixedStore.load(ctx, builder, values)
+	case <-ctx.Done():
+		return &sliceIterator{err: ctx.Err()}
+	}
+}
+
+func TestCheckReadsConcurrently(t *testing.T) {
+	t.Parallel()
+	table := modelTestSchema().Tables[0]
+	rows := []map[string]interface{}{{"pk0": 1, "ck0": 1, "col0": "a"}}
+	query := qb.Select("ks1.table1").Where(qb.Eq("pk0"))
+	for name, full := range map[string]bool{"ordered": false, "sets": true} {
+		full := full
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			barrier := &sync.WaitGroup{}
+			barrier.Add(2)
+			ds := delegatingStore{
+				oracleStore: &barrierStore{fixedStore: fixedStore{system: "oracle", rows: rows}, barrier: barrier},
+				testStores:  []storeLoader{&barrierStore{fixedStore: fixedStore{system: "test", rows: rows}, barrier: barrier}},
+				comparer:    defaultComparer,
+				validations: true,
+				logger:      zap.NewNop(),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			testIter, oracleIter, err := ds.loadBoth(ctx, ds.testStores[0], query, []interface{}{1}, full)
+			if err != nil {
+				t.Fatalf("expected both reads to run concurrently, got %v", err)
+			}
+			if err = ds.checkOrdered(table, ds.testStores[0], testIter, oracleIter); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// A read that never returns is abandoned once the context is done.
+	barrier := &sync.WaitGroup{}
+	barrier.Add(3)
+	ds := delegatingStore{
+		oracleStore: &barrierStore{fixedStore: fixedStore{system: "oracle"}, barrier: barrier},
+		testStores:  []storeLoader{&barrierStore{fixedStore: fixedStore{system: "test"}, barrier: barrier}},
+		comparer:    defaultComparer,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := ds.Check(ctx, table, query, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the check to be canceled, got %v", err)
+	}
+}
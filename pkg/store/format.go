@@ -0,0 +1,402 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/inf.v0"
+
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// FormatMutation renders a journaled mutation as a CQL statement with its
+// values inlined as exact literals, so that it can be run with cqlsh. The
+// statement is written with the timestamp it was journaled with when
+// withTimestamp is set.
+func FormatMutation(schema *typedef.Schema, e *journal.Entry, withTimestamp bool) (string, error) {
+	stmt, err := parseModelStmt(e.Query, e.Values)
+	if err != nil {
+		return "", err
+	}
+	if stmt.kind == modelStmtSelect || stmt.kind == modelStmtDDL {
+		return "", errors.Errorf("query '%s' is not a mutation", e.Query)
+	}
+	using := ""
+	if withTimestamp {
+		using = fmt.Sprintf(" USING TIMESTAMP %d", e.Time.UnixNano()/1000)
+	}
+	f := &formatter{schema: schema}
+	s, _ := f.format(stmt, using)
+	return s, nil
+}
+
+// FormatQuery renders a validation query with its values inlined as exact
+// literals.
+func FormatQuery(schema *typedef.Schema, query string, values []interface{}) (string, error) {
+	stmt, err := parseModelStmt(query, values)
+	if err != nil {
+		return "", err
+	}
+	if stmt.kind != modelStmtSelect {
+		return "", errors.Errorf("query '%s' is not a select", query)
+	}
+	f := &formatter{schema: schema}
+	s, _ := f.format(stmt, "")
+	return s, nil
+}
+
+// RewriteMutation renders a journaled mutation against the keyspace of the
+// schema, leaving out the columns in dropped, given as table.column. It
+// returns false if the mutation does not write anything once they are left
+// out.
+func RewriteMutation(schema *typedef.Schema, e *journal.Entry, dropped map[string]struct{}) (string, []interface{}, bool, error) {
+	stmt, err := parseModelStmt(e.Query, e.Values)
+	if err != nil {
+		return "", nil, false, err
+	}
+	if stmt.kind == modelStmtSelect || stmt.kind == modelStmtDDL {
+		return "", nil, false, errors.Errorf("query '%s' is not a mutation", e.Query)
+	}
+	f := &formatter{schema: schema, dropped: dropped, bind: true}
+	query, ok := f.format(stmt, "")
+	return query, f.values, ok, nil
+}
+
+// formatter renders parsed statements, either with literal values or, when
+// bind is set, with placeholders for the values it collects.
+type formatter struct {
+	schema  *typedef.Schema
+	dropped map[string]struct{}
+	values  []interface{}
+	bind    bool
+}
+
+// format renders a statement, it returns false when all the columns it
+// writes are dropped.
+func (f *formatter) format(stmt *modelStmt, using string) (string, bool) {
+	var sb strings.Builder
+	table := f.table(stmt.table)
+	name := f.schema.Keyspace.Name + "." + stmt.table
+	switch stmt.kind {
+	case modelStmtSelect:
+		selectors := make([]string, 0, len(stmt.selectors))
+		for _, sel := range stmt.selectors {
+			s := sel.column
+			if sel.function != "" {
+				s = sel.function + "(" + sel.column + ")"
+			}
+			if sel.alias != s {
+				s += " AS " + sel.alias
+			}
+			selectors = append(selectors, s)
+		}
+		if len(selectors) == 0 {
+			selectors = append(selectors, "*")
+		}
+		fmt.Fprintf(&sb, "SELECT %s FROM %s", strings.Join(selectors, ","), name)
+		if len(stmt.where) > 0 {
+			sb.WriteString(" WHERE " + f.where(table, stmt.where))
+		}
+		if stmt.allowFiltering {
+			sb.WriteString(" ALLOW FILTERING")
+		}
+	case modelStmtInsert:
+		columns := make([]string, 0, len(stmt.columns))
+		literals := make([]string, 0, len(stmt.values))
+		for i, column := range stmt.columns {
+			if f.isDropped(stmt.table, column) {
+				continue
+			}
+			columns = append(columns, column)
+			literals = append(literals, f.value(columnType(table, column), stmt.values[i]))
+		}
+		fmt.Fprintf(&sb, "INSERT INTO %s (%s) VALUES (%s)", name, strings.Join(columns, ","), strings.Join(literals, ","))
+		if stmt.ifNotExists {
+			sb.WriteString(" IF NOT EXISTS")
+		}
+		sb.WriteString(using)
+	case modelStmtInsertJSON:
+		fmt.Fprintf(&sb, "INSERT INTO %s JSON %s%s", name, f.value(typedef.TYPE_TEXT, stmt.value), using)
+	case modelStmtUpdate:
+		assignments := make([]string, 0, len(stmt.assignments))
+		for _, a := range stmt.assignments {
+			if !f.isDropped(stmt.table, a.column) {
+				assignments = append(assignments, f.assignment(table, a))
+			}
+		}
+		if len(assignments) == 0 {
+			return "", false
+		}
+		fmt.Fprintf(&sb, "UPDATE %s%s SET %s WHERE %s", name, using, strings.Join(assignments, ","), f.where(table, stmt.where))
+	case modelStmtDelete:
+		sb.WriteString("DELETE ")
+		if len(stmt.columns) > 0 {
+			columns := make([]string, 0, len(stmt.columns))
+			for _, column := range stmt.columns {
+				if !f.isDropped(stmt.table, column) {
+					columns = append(columns, column)
+				}
+			}
+			if len(columns) == 0 {
+				return "", false
+			}
+			sb.WriteString(strings.Join(columns, ",") + " ")
+		}
+		fmt.Fprintf(&sb, "FROM %s%s WHERE %s", name, using, f.where(table, stmt.where))
+	case modelStmtBatch:
+		sb.WriteString("BEGIN ")
+		if stmt.batchType != "" {
+			sb.WriteString(stmt.batchType + " ")
+		}
+		sb.WriteString("BATCH" + using + "\n")
+		var written bool
+		for _, child := range stmt.stmts {
+			if s, ok := f.format(child, ""); ok {
+				sb.WriteString("  " + s + ";\n")
+				written = true
+			}
+		}
+		if !written {
+			return "", false
+		}
+		sb.WriteString("APPLY BATCH")
+	}
+	return sb.String(), true
+}
+
+func (f *formatter) isDropped(table, column string) bool {
+	_, ok := f.dropped[table+"."+column]
+	return ok
+}
+
+// table returns the table of the given name, or the base table of the
+// materialized view of the given name.
+func (f *formatter) table(name string) *typedef.Table {
+	for _, t := range f.schema.Tables {
+		if t.Name == name {
+			return t
+		}
+		for i := range t.MaterializedViews {
+			if t.MaterializedViews[i].Name == name {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// columnType returns the type of a column, or nil if it is not known
+// anymore, in which case its values are rendered from their Go type.
+func columnType(table *typedef.Table, name string) typedef.Type {
+	if table == nil {
+		return nil
+	}
+	for _, cols := range []typedef.Columns{table.PartitionKeys, table.ClusteringKeys, table.Columns} {
+		for _, col := range cols {
+			if col.Name == name {
+				return col.Type
+			}
+		}
+	}
+	return nil
+}
+
+func (f *formatter) assignment(table *typedef.Table, a modelAssignment) string {
+	typ := columnType(table, a.column)
+	if _, ok := typ.(*typedef.CounterType); ok {
+		typ = typedef.TYPE_BIGINT
+	}
+	if mt, ok := typ.(*typedef.MapType); ok && a.kind == modelAssignRemove {
+		typ = &typedef.BagType{ComplexType: typedef.TYPE_SET, ValueType: mt.KeyType}
+	}
+	value := f.value(typ, a.value)
+	switch a.kind {
+	case modelAssignAdd:
+		return a.column + "=" + a.column + "+" + value
+	case modelAssignRemove:
+		return a.column + "=" + a.column + "-" + value
+	case modelAssignPrepend:
+		return a.column + "=" + value + "+" + a.column
+	default:
+		return a.column + "=" + value
+	}
+}
+
+func (f *formatter) where(table *typedef.Table, where []modelRelation) string {
+	relations := make([]string, 0, len(where))
+	for _, rel := range where {
+		lhs, typ := rel.column, columnType(table, rel.column)
+		if rel.tokenOf != nil {
+			lhs, typ = "token("+strings.Join(rel.tokenOf, ",")+")", typedef.TYPE_BIGINT
+		}
+		literals := make([]string, 0, len(rel.values))
+		for _, v := range rel.values {
+			literals = append(literals, f.value(typ, v))
+		}
+		if rel.op == modelOpIn {
+			relations = append(relations, lhs+" IN ("+strings.Join(literals, ",")+")")
+			continue
+		}
+		relations = append(relations, lhs+string(rel.op)+strings.Join(literals, ","))
+	}
+	return strings.Join(relations, " AND ")
+}
+
+// value renders a bound value, as a literal or as placeholders.
+func (f *formatter) value(typ typedef.Type, v interface{}) string {
+	if !f.bind {
+		return literal(typ, v)
+	}
+	// Tuples are bound element by element.
+	if values, ok := v.([]interface{}); ok {
+		if _, tuple := typ.(*typedef.TupleType); tuple {
+			f.values = append(f.values, values...)
+			return "(" + strings.TrimRight(strings.Repeat("?,", len(values)), ",") + ")"
+		}
+	}
+	f.values = append(f.values, v)
+	return "?"
+}
+
+// literal renders a bound value of the given type as a CQL literal.
+func literal(typ typedef.Type, v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	switch t := typ.(type) {
+	case typedef.SimpleType:
+		return simpleLiteral(t, v)
+	case *typedef.TupleType:
+		if values, ok := v.([]interface{}); ok && len(values) == len(t.ValueTypes) {
+			literals := make([]string, 0, len(values))
+			for i, elem := range values {
+				literals = append(literals, literal(t.ValueTypes[i], elem))
+			}
+			return "(" + strings.Join(literals, ",") + ")"
+		}
+	case *typedef.BagType:
+		if values, ok := v.([]interface{}); ok {
+			literals := make([]string, 0, len(values))
+			for _, elem := range values {
+				literals = append(literals, literal(t.ValueType, elem))
+			}
+			if t.ComplexType == typedef.TYPE_SET {
+				return "{" + strings.Join(literals, ",") + "}"
+			}
+			return "[" + strings.Join(literals, ",") + "]"
+		}
+	case *typedef.MapType:
+		if values, ok := v.(map[interface{}]interface{}); ok {
+			literals := make([]string, 0, len(values))
+			for key, elem := range values {
+				literals = append(literals, literal(t.KeyType, key)+":"+literal(t.ValueType, elem))
+			}
+			sort.Strings(literals)
+			return "{" + strings.Join(literals, ",") + "}"
+		}
+	case *typedef.UDTType:
+		if values, ok := v.(map[string]interface{}); ok {
+			literals := make([]string, 0, len(values))
+			for name, elem := range values {
+				literals = append(literals, name+":"+literal(t.ValueTypes[name], elem))
+			}
+			sort.Strings(literals)
+			return "{" + strings.Join(literals, ",") + "}"
+		}
+	}
+	return goLiteral(v)
+}
+
+func simpleLiteral(typ typedef.SimpleType, v interface{}) string {
+	switch typ {
+	case typedef.TYPE_BLOB:
+		// The generated blobs are strings the driver sends as their bytes.
+		if s, ok := v.(string); ok {
+			return "0x" + hex.EncodeToString([]byte(s))
+		}
+	case typedef.TYPE_ASCII, typedef.TYPE_TEXT, typedef.TYPE_VARCHAR, typedef.TYPE_INET, typedef.TYPE_DATE:
+		if s, ok := v.(string); ok {
+			return quote(s)
+		}
+	case typedef.TYPE_TIMESTAMP:
+		if t, ok := v.(time.Time); ok {
+			return strconv.FormatInt(t.UnixMilli(), 10)
+		}
+	}
+	return goLiteral(v)
+}
+
+// goLiteral renders a value from its Go type.
+func goLiteral(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return val
+	case []byte:
+		return "0x" + hex.EncodeToString(val)
+	case float64:
+		return floatLiteral(val, 64)
+	case float32:
+		return floatLiteral(float64(val), 32)
+	case *inf.Dec:
+		if val == nil {
+			return "null"
+		}
+		return val.String()
+	case *big.Int:
+		if val == nil {
+			return "null"
+		}
+		return val.String()
+	case time.Time:
+		return quote(val.UTC().Format(time.RFC3339Nano))
+	case []interface{}:
+		literals := make([]string, 0, len(val))
+		for _, elem := range val {
+			literals = append(literals, goLiteral(elem))
+		}
+		return "[" + strings.Join(literals, ",") + "]"
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func floatLiteral(v float64, bitSize int) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, bitSize)
+	}
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/scylladb/gocqlx/v2/qb"
+	"gopkg.in/inf.v0"
+
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+func TestFormatMutation(t *testing.T) {
+	t.Parallel()
+	schema := modelTestSchema()
+	schema.Tables[0].Columns = append(schema.Tables[0].Columns,
+		&typedef.ColumnDef{Name: "col2", Type: typedef.TYPE_BLOB},
+		&typedef.ColumnDef{Name: "col3", Type: &typedef.BagType{ComplexType: typedef.TYPE_SET, ValueType: typedef.TYPE_DOUBLE}},
+		&typedef.ColumnDef{Name: "col4", Type: &typedef.MapType{KeyType: typedef.TYPE_INT, ValueType: typedef.TYPE_DECIMAL}},
+		&typedef.ColumnDef{Name: "col5", Type: &typedef.UDTType{ValueTypes: map[string]typedef.SimpleType{"a": typedef.TYPE_TEXT, "b": typedef.TYPE_FLOAT}}},
+	)
+	ts := time.UnixMicro(1700000000123456)
+
+	tests := map[string]struct {
+		builder qb.Builder
+		want    string
+		values  []interface{}
+	}{
+		"insert": {
+			builder: qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").TupleColumn("col1", 2).Columns("col2"),
+			values:  []interface{}{1, 2, "it's", 10, nil, "ab"},
+			want:    "INSERT INTO ks1.table1 (pk0,ck0,col0,col1,col2) VALUES (1,2,'it''s',(10,null),0x6162) USING TIMESTAMP 1700000000123456",
+		},
+		"collections": {
+			builder: qb.Insert("ks1.table1").Columns("pk0", "ck0", "col3", "col4", "col5"),
+			values: []interface{}{
+				1, 2, []interface{}{0.1, math.Inf(1)}, map[interface{}]interface{}{2: inf.NewDec(15, 1), 1: nil},
+				map[string]interface{}{"b": float32(1.5), "a": "x"},
+			},
+			want: "INSERT INTO ks1.table1 (pk0,ck0,col3,col4,col5) VALUES (1,2,{0.1,Infinity},{1:null,2:1.5},{a:'x',b:1.5}) USING TIMESTAMP 1700000000123456",
+		},
+		"insert json": {
+			builder: qb.Insert("ks1.table1").Json(),
+			values:  []interface{}{`{"pk0":1,"ck0":2}`},
+			want:    `INSERT INTO ks1.table1 JSON '{"pk0":1,"ck0":2}' USING TIMESTAMP 1700000000123456`,
+		},
+		"update": {
+			builder: qb.Update("ks1.table1").Set("col0").Add("col3").Where(qb.Eq("pk0"), qb.Eq("ck0")),
+			values:  []interface{}{"a", []interface{}{2.5}, 1, 2},
+			want:    "UPDATE ks1.table1 USING TIMESTAMP 1700000000123456 SET col0='a',col3=col3+{2.5} WHERE pk0=1 AND ck0=2",
+		},
+		"counter": {
+			builder: qb.Update("ks1.table2").Add("col0").Where(qb.Eq("pk0")),
+			values:  []interface{}{int64(3), 1},
+			want:    "UPDATE ks1.table2 USING TIMESTAMP 1700000000123456 SET col0=col0+3 WHERE pk0=1",
+		},
+		"delete": {
+			builder: qb.Delete("ks1.table1").Where(qb.Eq("pk0"), qb.GtOrEqNamed("ck0", "ck0_start"), qb.LtOrEqNamed("ck0", "ck0_end")),
+			values:  []interface{}{1, 2, 5},
+			want:    "DELETE FROM ks1.table1 USING TIMESTAMP 1700000000123456 WHERE pk0=1 AND ck0>=2 AND ck0<=5",
+		},
+		"batch": {
+			builder: qb.Batch().UnLogged().
+				Add(qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")).
+				Add(qb.Delete("ks1.table1").Columns("col0").Where(qb.Eq("pk0"), qb.Eq("ck0"))),
+			values: []interface{}{1, 2, "a", 1, 3},
+			want: "BEGIN UNLOGGED BATCH USING TIMESTAMP 1700000000123456\n" +
+				"  INSERT INTO ks1.table1 (pk0,ck0,col0) VALUES (1,2,'a');\n" +
+				"  DELETE col0 FROM ks1.table1 WHERE pk0=1 AND ck0=3;\n" +
+				"APPLY BATCH",
+		},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			query, _ := test.builder.ToCql()
+			got, err := FormatMutation(schema, &journal.Entry{Time: ts, Query: query, Values: test.values}, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("expected\n%s\ngot\n%s", test.want, got)
+			}
+		})
+	}
+}
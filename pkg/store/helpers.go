@@ -16,12 +16,12 @@ package store
 
 import (
 	"fmt"
-	"math/big"
+	"sort"
 	"strings"
-	"time"
 
 	"github.com/gocql/gocql"
 
+	"github.com/scylladb/gemini/pkg/routingkey"
 	"github.com/scylladb/gemini/pkg/typedef"
 )
 
@@ -43,55 +43,80 @@ func extractRowValues(values []string, columns typedef.Columns, row map[string]i
 	return values
 }
 
-func lt(mi, mj map[string]interface{}) bool {
-	switch mis := mi["pk0"].(type) {
-	case []byte:
-		mjs, _ := mj["pk0"].([]byte)
-		return string(mis) < string(mjs)
-	case string:
-		mjs, _ := mj["pk0"].(string)
-		return mis < mjs
-	case int:
-		mjs, _ := mj["pk0"].(int)
-		return mis < mjs
-	case int8:
-		mjs, _ := mj["pk0"].(int8)
-		return mis < mjs
-	case int16:
-		mjs, _ := mj["pk0"].(int16)
-		return mis < mjs
-	case int32:
-		mjs, _ := mj["pk0"].(int32)
-		return mis < mjs
-	case int64:
-		mjs, _ := mj["pk0"].(int64)
-		return mis < mjs
-	case gocql.UUID:
-		mjs, _ := mj["pk0"].(gocql.UUID)
-		return mis.String() < mjs.String()
-	case time.Time:
-		mjs, _ := mj["pk0"].(time.Time)
-		return mis.UnixNano() < mjs.UnixNano()
-	case *big.Int:
-		mjs, _ := mj["pk0"].(*big.Int)
-		return mis.Cmp(mjs) < 0
-	case nil:
-		return true
-	default:
-		msg := fmt.Sprintf("unhandled type %T\n", mis)
-		time.Sleep(time.Second)
-		panic(msg)
+// sortRows orders rows by their full primary key, the way the cluster
+// orders them, using the CQL ordering of the type of every key column.
+func sortRows(t *typedef.Table, rows []map[string]interface{}) {
+	// Tokens are computed once per row rather than once per comparison.
+	keyCreator := &routingkey.Creator{}
+	keyed := make([]keyedRow, len(rows))
+	for i, row := range rows {
+		keyed[i] = keyedRow{row: row, token: rowToken(t, keyCreator, row)}
 	}
+	sort.SliceStable(keyed, func(i, j int) bool {
+		if keyed[i].token != keyed[j].token {
+			return keyed[i].token < keyed[j].token
+		}
+		return compareKeyValues(t, keyed[i].row, keyed[j].row) < 0
+	})
+	for i := range keyed {
+		rows[i] = keyed[i].row
+	}
+}
+
+type keyedRow struct {
+	row   map[string]interface{}
+	token int64
+}
+
+// rowIterator walks the rows of a query result. The cql store fetches
+// the rows from the cluster page by page as the iteration advances.
+type rowIterator interface {
+	next() (map[string]interface{}, bool)
+	close() error
+}
+
+type cqlIterator struct {
+	iter *gocql.Iter
+}
+
+func (it cqlIterator) next() (map[string]interface{}, bool) {
+	row := make(map[string]interface{})
+	if !it.iter.MapScan(row) {
+		return nil, false
+	}
+	return row, true
+}
+
+func (it cqlIterator) close() error {
+	return it.iter.Close()
+}
+
+type sliceIterator struct {
+	err  error
+	rows []map[string]interface{}
+}
+
+func (it *sliceIterator) next() (map[string]interface{}, bool) {
+	if len(it.rows) == 0 {
+		return nil, false
+	}
+	row := it.rows[0]
+	it.rows = it.rows[1:]
+	return row, true
+}
+
+func (it *sliceIterator) close() error {
+	return it.err
 }
 
-func loadSet(iter *gocql.Iter) []map[string]interface{} {
+func loadSet(iter rowIterator) ([]map[string]interface{}, error) {
 	var rows []map[string]interface{}
 	for {
-		row := make(map[string]interface{})
-		if !iter.MapScan(row) {
+		row, ok := iter.next()
+		if !ok {
 			break
 		}
 		rows = append(rows, row)
 	}
-	return rows
+	return rows, iter.close()
 }
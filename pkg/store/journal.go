@@ -0,0 +1,98 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/journal"
+)
+
+var skipped = journal.Result{Outcome: journal.Skipped}
+
+// Target is the table and the partition a mutation writes to, journaled
+// with the statement so that the statements of a table or a partition can
+// be replayed alone. HasToken is set when the mutation writes to the single
+// partition of the given Token, Schema when it changes the schema.
+type Target struct {
+	Table    string
+	Token    uint64
+	HasToken bool
+	Schema   bool
+}
+
+type targetKey struct{}
+
+// WithTarget returns a context journaling the mutations applied with it
+// with the given target.
+func WithTarget(ctx context.Context, t Target) context.Context {
+	return context.WithValue(ctx, targetKey{}, t)
+}
+
+func targetFrom(ctx context.Context) Target {
+	t, _ := ctx.Value(targetKey{}).(Target)
+	return t
+}
+
+// record appends a statement and its outcome on both systems to the
+// journal, if any.
+func (ds delegatingStore) record(e *journal.Entry, t Target) {
+	if ds.journal == nil {
+		return
+	}
+	e.Table, e.Token, e.HasToken = t.Table, t.Token, t.HasToken
+	e.Schema = e.Schema || t.Schema
+	if err := ds.journal.Record(e); err != nil {
+		ds.logger.Error("unable to journal statement", zap.String("query", e.Query), zap.Error(err))
+	}
+}
+
+// Replay applies a journaled statement again with the timestamp it was
+// written with, on each system it was sent to when it was recorded.
+func (ds delegatingStore) Replay(ctx context.Context, e *journal.Entry) error {
+	oracleQuery := e.OracleQuery
+	if oracleQuery == "" {
+		oracleQuery = e.Query
+	}
+	type target struct {
+		store  storeLoader
+		query  string
+		result journal.Result
+	}
+	targets := []target{{store: ds.oracleStore, query: oracleQuery, result: e.Oracle}}
+	for _, test := range ds.testStores {
+		targets = append(targets, target{store: test, query: e.Query, result: e.TestResult(test.name())})
+	}
+	for _, target := range targets {
+		if target.result.Outcome == journal.Skipped {
+			continue
+		}
+		if err := mutate(ctx, target.store, replayBuilder{query: target.query}, e.Time, e.Values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayBuilder renders a journaled statement.
+type replayBuilder struct {
+	query string
+}
+
+func (b replayBuilder) ToCql() (stmt string, names []string) {
+	return b.query, nil
+}
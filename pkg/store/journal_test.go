@@ -0,0 +1,186 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scylladb/gocqlx/v2/qb"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/routingkey"
+)
+
+func TestJournalReplay(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	table := schema.Tables[0]
+	path := filepath.Join(t.TempDir(), "journal")
+	w, err := journal.Create(path, journal.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oracle := newModelStore(schema, "oracle")
+	ds := delegatingStore{
+		oracleStore: oracle,
+		testStores:  []storeLoader{newModelStore(schema, "test")},
+		comparer:    defaultComparer,
+		schema:      schema,
+		journal:     w,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+	partition := func(pk int) context.Context {
+		token, _ := (&routingkey.Creator{}).GetHash(table, []interface{}{pk})
+		return WithTarget(ctx, Target{Table: table.Name, Token: token, HasToken: true})
+	}
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").TupleColumn("col1", 2)
+	for _, values := range [][]interface{}{{1, 1, "a", 10, "b"}, {1, 2, "c", nil, nil}, {2, 1, "d", 20, "e"}} {
+		if err = ds.Mutate(partition(values[0].(int)), insert, values...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ds.Mutate(partition(1), qb.Update("ks1.table1").Set("col0").Where(qb.Eq("pk0"), qb.Eq("ck0")), "x", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	ds.oracleStore = &failingStore{fixedStore{system: "oracle"}}
+	if err = ds.Mutate(partition(3), insert, 3, 1, "f", nil, nil); !errors.Is(err, ErrOracleMutation) {
+		t.Fatalf("expected an oracle mutation error, got %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	replayed := newModelStore(schema, "replayed")
+	replay := delegatingStore{
+		oracleStore: newModelStore(schema, "oracle"),
+		testStores:  []storeLoader{replayed},
+		comparer:    defaultComparer,
+		schema:      schema,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+	token, _ := (&routingkey.Creator{}).GetHash(table, []interface{}{1})
+	var entries int
+	for {
+		var e *journal.Entry
+		if e, err = r.Next(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries++
+		if e.Table != "table1" || !e.HasToken {
+			t.Errorf("entry %d: expected a single partition of table1, got %+v", entries, e)
+		}
+		if entries == 4 && e.Token != token {
+			t.Errorf("expected the update in partition %d, got %d", token, e.Token)
+		}
+		if entries == 5 && (e.Oracle.Outcome != journal.Failed || e.Test.Outcome != journal.Skipped) {
+			t.Errorf("expected the last mutation to fail on the oracle only, got %+v", e)
+		}
+		if err = replay.Replay(ctx, e); err != nil && entries < 5 {
+			t.Fatal(err)
+		}
+	}
+	if entries != 5 {
+		t.Fatalf("expected 5 entries, got %d", entries)
+	}
+
+	check := delegatingStore{
+		oracleStore: oracle,
+		testStores:  []storeLoader{replayed},
+		comparer:    defaultComparer,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+	query := qb.Select("ks1.table1").Columns("pk0", "ck0", "col0", "col1", "WRITETIME(col0)").Where(qb.Eq("pk0"))
+	for _, pk := range []int{1, 2, 3} {
+		if err = check.Check(ctx, table, query, pk); err != nil {
+			t.Errorf("partition %d: %v", pk, err)
+		}
+	}
+}
+
+func TestJournalFailedCheck(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	path := filepath.Join(t.TempDir(), "journal")
+	w, err := journal.Create(path, journal.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := newModelStore(schema, "test")
+	ds := delegatingStore{
+		oracleStore: newModelStore(schema, "oracle"),
+		testStores:  []storeLoader{test},
+		comparer:    defaultComparer,
+		schema:      schema,
+		journal:     w,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+	if err = ds.Mutate(ctx, qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0"), 1, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	query := qb.Select("ks1.table1").Where(qb.Eq("pk0"))
+	if err = ds.Check(ctx, schema.Tables[0], query, 1); err != nil {
+		t.Fatal(err)
+	}
+	// DROP KEYSPACE empties the model.
+	if err = test.mutate(ctx, replayBuilder{query: "DROP KEYSPACE IF EXISTS ks1"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err = ds.Check(ctx, schema.Tables[0], query, 1); err == nil {
+		t.Fatal("expected a validation error")
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var checks []*journal.Entry
+	for {
+		var e *journal.Entry
+		if e, err = r.Next(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if e.Check {
+			checks = append(checks, e)
+		}
+	}
+	if len(checks) != 1 || checks[0].Table != "table1" || len(checks[0].Values) != 1 {
+		t.Errorf("expected the failed validation to be journaled, got %+v", checks)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// The collections of the model are kept in their normalized representation,
+// slices for lists and sets and maps for maps. Sets are sorted in the order
+// of their elements and without duplicates, as the driver returns them.
+
+// isCollection reports whether the type is a non-frozen list, set or map,
+// whose elements can be updated.
+func isCollection(t typedef.Type) bool {
+	switch typ := t.(type) {
+	case *typedef.BagType:
+		return !typ.Frozen
+	case *typedef.MapType:
+		return !typ.Frozen
+	default:
+		return false
+	}
+}
+
+func isList(t typedef.Type) bool {
+	bt, ok := t.(*typedef.BagType)
+	return ok && bt.ComplexType == typedef.TYPE_LIST
+}
+
+func isSet(t typedef.Type) bool {
+	bt, ok := t.(*typedef.BagType)
+	return ok && bt.ComplexType == typedef.TYPE_SET
+}
+
+// collectionLen returns the number of elements of a collection, 0 if it is
+// null.
+func collectionLen(v interface{}) int {
+	if isNull(v) {
+		return 0
+	}
+	return reflect.ValueOf(v).Len()
+}
+
+// collectionAdd appends the elements of operand to a list, or prepends them
+// if prepend is set, adds them to a set or puts the keys of a map.
+func collectionAdd(t typedef.Type, current, operand interface{}, prepend bool) interface{} {
+	if isNull(current) {
+		return operand
+	}
+	if isNull(operand) {
+		return current
+	}
+	if mt, ok := t.(*typedef.MapType); ok {
+		out := reflect.ValueOf(current)
+		iter := reflect.ValueOf(operand).MapRange()
+		for iter.Next() {
+			out = reflect.ValueOf(mapPut(mt, out.Interface(), iter.Key().Interface(), iter.Value().Interface()))
+		}
+		return out.Interface()
+	}
+	first, second := reflect.ValueOf(current), reflect.ValueOf(operand)
+	if prepend {
+		first, second = second, first
+	}
+	out := reflect.MakeSlice(first.Type(), 0, first.Len()+second.Len())
+	out = reflect.AppendSlice(reflect.AppendSlice(out, first), second)
+	if isSet(t) {
+		return sortSet(t.(*typedef.BagType).ValueType, out.Interface())
+	}
+	return out.Interface()
+}
+
+// collectionRemove removes every occurrence of the elements of operand from
+// a list or a set, or the keys of operand from a map.
+func collectionRemove(t typedef.Type, current, operand interface{}) interface{} {
+	if isNull(current) || isNull(operand) {
+		return current
+	}
+	removed := reflect.ValueOf(operand)
+	var elemType typedef.Type
+	switch typ := t.(type) {
+	case *typedef.MapType:
+		elemType = typ.KeyType
+	case *typedef.BagType:
+		elemType = typ.ValueType
+	}
+	isRemoved := func(v reflect.Value) bool {
+		for i := 0; i < removed.Len(); i++ {
+			if compareValues(elemType, v.Interface(), removed.Index(i).Interface()) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+	cur := reflect.ValueOf(current)
+	if cur.Kind() == reflect.Map {
+		out := reflect.MakeMapWithSize(cur.Type(), cur.Len())
+		iter := cur.MapRange()
+		for iter.Next() {
+			if !isRemoved(iter.Key()) {
+				out.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+		return out.Interface()
+	}
+	out := reflect.MakeSlice(cur.Type(), 0, cur.Len())
+	for i := 0; i < cur.Len(); i++ {
+		if !isRemoved(cur.Index(i)) {
+			out = reflect.Append(out, cur.Index(i))
+		}
+	}
+	return out.Interface()
+}
+
+// listSet sets the element of a list at an index, a null element removes
+// it.
+func listSet(current interface{}, index int, elem interface{}) interface{} {
+	cur := reflect.ValueOf(current)
+	out := reflect.MakeSlice(cur.Type(), 0, cur.Len())
+	for i := 0; i < cur.Len(); i++ {
+		switch {
+		case i != index:
+			out = reflect.Append(out, cur.Index(i))
+		case !isNull(elem):
+			out = reflect.Append(out, reflect.ValueOf(elem))
+		}
+	}
+	return out.Interface()
+}
+
+// mapPut sets the value of a key of a map, a null value removes the key.
+func mapPut(t *typedef.MapType, current, key, value interface{}) interface{} {
+	var out reflect.Value
+	if isNull(current) {
+		out = reflect.MakeMap(reflect.TypeOf(normalizedMap(t)))
+	} else {
+		cur := reflect.ValueOf(current)
+		out = reflect.MakeMapWithSize(cur.Type(), cur.Len()+1)
+		iter := cur.MapRange()
+		for iter.Next() {
+			if compareValues(t.KeyType, iter.Key().Interface(), key) != 0 {
+				out.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+	}
+	if !isNull(value) {
+		out.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(value))
+	}
+	return out.Interface()
+}
+
+// normalizedMap returns an empty map of the normalized representation of
+// the map type.
+func normalizedMap(t *typedef.MapType) interface{} {
+	m, _ := normalize(typeInfo(t), nil)
+	return m
+}
+
+// sortSet sorts the elements of a set and removes the duplicates.
+func sortSet(elemType typedef.Type, set interface{}) interface{} {
+	s := reflect.ValueOf(set)
+	if s.Kind() != reflect.Slice || s.Len() < 2 {
+		return set
+	}
+	elems := make([]reflect.Value, s.Len())
+	for i := range elems {
+		elems[i] = s.Index(i)
+	}
+	sort.SliceStable(elems, func(i, j int) bool {
+		return compareValues(elemType, elems[i].Interface(), elems[j].Interface()) < 0
+	})
+	out := reflect.MakeSlice(s.Type(), 0, len(elems))
+	for i, e := range elems {
+		if i > 0 && compareValues(elemType, elems[i-1].Interface(), e.Interface()) == 0 {
+			continue
+		}
+		out = reflect.Append(out, e)
+	}
+	return out.Interface()
+}
@@ -0,0 +1,721 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// The model store does not have access to the internals of the qb builders,
+// so it interprets the CQL text they render instead. The grammar below only
+// covers the statement shapes gemini itself generates.
+
+type modelStmtKind int
+
+const (
+	modelStmtSelect modelStmtKind = iota
+	modelStmtInsert
+	modelStmtInsertJSON
+	modelStmtUpdate
+	modelStmtDelete
+	modelStmtBatch
+	modelStmtDDL
+)
+
+type modelOp string
+
+const (
+	modelOpEq  modelOp = "="
+	modelOpLt  modelOp = "<"
+	modelOpLte modelOp = "<="
+	modelOpGt  modelOp = ">"
+	modelOpGte modelOp = ">="
+	modelOpIn  modelOp = "IN"
+)
+
+// modelRelation restricts a column, or the token of the listed partition
+// key columns when tokenOf is set.
+type modelRelation struct {
+	column  string
+	op      modelOp
+	tokenOf []string
+	values  []interface{}
+}
+
+type modelAssignKind int
+
+const (
+	modelAssignSet modelAssignKind = iota
+	modelAssignAdd
+	modelAssignPrepend
+	modelAssignRemove
+	// modelAssignElement sets the element of a list at an index, or the
+	// value of a map key.
+	modelAssignElement
+)
+
+type modelAssignment struct {
+	value interface{}
+	// key is the index or the key of the element of modelAssignElement.
+	key    interface{}
+	column string
+	kind   modelAssignKind
+}
+
+type modelSelector struct {
+	function string
+	column   string
+	alias    string
+}
+
+type modelStmt struct {
+	value       interface{}
+	table       string
+	dropColumn  string
+	batchType   string
+	columns     []string
+	values      []interface{}
+	selectors   []modelSelector
+	assignments []modelAssignment
+	// elements are the map keys deleted by a DELETE.
+	elements []modelAssignment
+	where    []modelRelation
+	stmts    []*modelStmt
+	kind     modelStmtKind
+	// ttl is the time to live in seconds of the cells written by an
+	// INSERT or an UPDATE, 0 if they do not expire.
+	ttl         int64
+	ifNotExists bool
+	// dropKeyspace is set for DROP KEYSPACE, which empties the model.
+	dropKeyspace   bool
+	allowFiltering bool
+}
+
+type modelTokenKind int
+
+const (
+	modelTokenIdent modelTokenKind = iota
+	modelTokenPlaceholder
+	modelTokenNumber
+	modelTokenString
+	modelTokenPunct
+)
+
+type modelToken struct {
+	text string
+	kind modelTokenKind
+}
+
+func tokenizeCQL(query string) ([]modelToken, error) {
+	var tokens []modelToken
+	for i := 0; i < len(query); {
+		c := rune(query[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '?':
+			tokens = append(tokens, modelToken{kind: modelTokenPlaceholder, text: "?"})
+			i++
+		case c == '\'':
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(query) {
+				return nil, errors.Errorf("unterminated string literal in %q", query)
+			}
+			tokens = append(tokens, modelToken{kind: modelTokenString, text: strings.ReplaceAll(query[i+1:j], "''", "'")})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(query) && unicode.IsDigit(rune(query[j])) {
+				j++
+			}
+			tokens = append(tokens, modelToken{kind: modelTokenNumber, text: query[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_' || c == '"':
+			j := i
+			for j < len(query) && (unicode.IsLetter(rune(query[j])) || unicode.IsDigit(rune(query[j])) || strings.ContainsRune("_.\"", rune(query[j]))) {
+				j++
+			}
+			tokens = append(tokens, modelToken{kind: modelTokenIdent, text: strings.ReplaceAll(query[i:j], "\"", "")})
+			i = j
+		case c == '<' || c == '>':
+			if i+1 < len(query) && query[i+1] == '=' {
+				tokens = append(tokens, modelToken{kind: modelTokenPunct, text: query[i : i+2]})
+				i += 2
+			} else {
+				tokens = append(tokens, modelToken{kind: modelTokenPunct, text: query[i : i+1]})
+				i++
+			}
+		case strings.ContainsRune("(),=+-[];*{}:.", c):
+			tokens = append(tokens, modelToken{kind: modelTokenPunct, text: query[i : i+1]})
+			i++
+		default:
+			return nil, errors.Errorf("unexpected character %q in %q", c, query)
+		}
+	}
+	return tokens, nil
+}
+
+type modelParser struct {
+	query  string
+	tokens []modelToken
+	values []interface{}
+	pos    int
+	bound  int
+}
+
+// parseModelStmt parses the rendered CQL text of a builder and binds the
+// supplied values to its placeholders in order of appearance.
+func parseModelStmt(query string, values []interface{}) (*modelStmt, error) {
+	if fields := strings.Fields(query); len(fields) > 0 {
+		switch strings.ToUpper(fields[0]) {
+		case "CREATE":
+			return &modelStmt{kind: modelStmtDDL}, nil
+		case "DROP":
+			return &modelStmt{kind: modelStmtDDL, dropKeyspace: len(fields) > 1 && strings.EqualFold(fields[1], "KEYSPACE")}, nil
+		}
+	}
+	tokens, err := tokenizeCQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &modelParser{query: query, tokens: tokens, values: values}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to interpret query '%s'", query)
+	}
+	if p.pos != len(p.tokens) {
+		return nil, errors.Errorf("unable to interpret query '%s': unexpected trailing %q", query, p.peek().text)
+	}
+	if p.bound != len(values) {
+		return nil, errors.Errorf("query '%s' has %d placeholders, %d values supplied", query, p.bound, len(values))
+	}
+	return stmt, nil
+}
+
+func (p *modelParser) peek() modelToken {
+	if p.pos >= len(p.tokens) {
+		return modelToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *modelParser) next() modelToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *modelParser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == modelTokenIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *modelParser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *modelParser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return errors.Errorf("expected %s, got %q", kw, p.peek().text)
+	}
+	return nil
+}
+
+func (p *modelParser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == modelTokenPunct && t.text == s
+}
+
+func (p *modelParser) acceptPunct(s string) bool {
+	if p.isPunct(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *modelParser) expectPunct(s string) error {
+	if !p.acceptPunct(s) {
+		return errors.Errorf("expected %q, got %q", s, p.peek().text)
+	}
+	return nil
+}
+
+func (p *modelParser) expectIdent() (string, error) {
+	t := p.next()
+	if t.kind != modelTokenIdent {
+		return "", errors.Errorf("expected identifier, got %q", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *modelParser) expectTable() (string, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return "", err
+	}
+	if idx := strings.LastIndexByte(name, '.'); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name, nil
+}
+
+func (p *modelParser) bind() (interface{}, error) {
+	if p.bound >= len(p.values) {
+		return nil, errors.Errorf("not enough values supplied for placeholders")
+	}
+	v := p.values[p.bound]
+	p.bound++
+	return v, nil
+}
+
+// parseOperand reads a single placeholder, literal or parenthesized tuple.
+func (p *modelParser) parseOperand() (interface{}, error) {
+	t := p.peek()
+	switch {
+	case t.kind == modelTokenPlaceholder:
+		p.pos++
+		return p.bind()
+	case t.kind == modelTokenNumber:
+		p.pos++
+		return strconv.ParseInt(t.text, 10, 64)
+	case t.kind == modelTokenString:
+		p.pos++
+		return t.text, nil
+	case t.kind == modelTokenPunct && t.text == "(":
+		p.pos++
+		var out []interface{}
+		for {
+			v, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+			if p.acceptPunct(")") {
+				return out, nil
+			}
+			if err = p.expectPunct(","); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errors.Errorf("unexpected operand %q", t.text)
+	}
+}
+
+func (p *modelParser) parseStatement() (*modelStmt, error) {
+	switch {
+	case p.acceptKeyword("SELECT"):
+		return p.parseSelect()
+	case p.acceptKeyword("INSERT"):
+		return p.parseInsert()
+	case p.acceptKeyword("UPDATE"):
+		return p.parseUpdate()
+	case p.acceptKeyword("DELETE"):
+		return p.parseDelete()
+	case p.acceptKeyword("BEGIN"):
+		return p.parseBatch()
+	case p.isKeyword("ALTER"):
+		return p.parseDDL()
+	default:
+		return nil, errors.Errorf("unsupported statement %q", p.peek().text)
+	}
+}
+
+func (p *modelParser) parseSelect() (*modelStmt, error) {
+	stmt := &modelStmt{kind: modelStmtSelect}
+	if !p.acceptPunct("*") {
+		for {
+			sel, err := p.parseSelector()
+			if err != nil {
+				return nil, err
+			}
+			stmt.selectors = append(stmt.selectors, sel)
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table, err := p.expectTable()
+	if err != nil {
+		return nil, err
+	}
+	stmt.table = table
+	if p.acceptKeyword("WHERE") {
+		if stmt.where, err = p.parseWhere(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("ALLOW") {
+		if err = p.expectKeyword("FILTERING"); err != nil {
+			return nil, err
+		}
+		stmt.allowFiltering = true
+	}
+	return stmt, nil
+}
+
+func (p *modelParser) parseSelector() (modelSelector, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return modelSelector{}, err
+	}
+	sel := modelSelector{column: name, alias: name}
+	if p.acceptPunct("(") {
+		var column string
+		if column, err = p.expectIdent(); err != nil {
+			return modelSelector{}, err
+		}
+		if err = p.expectPunct(")"); err != nil {
+			return modelSelector{}, err
+		}
+		sel = modelSelector{function: strings.ToLower(name), column: column, alias: strings.ToLower(name) + "(" + column + ")"}
+	}
+	if p.acceptKeyword("AS") {
+		if sel.alias, err = p.expectIdent(); err != nil {
+			return modelSelector{}, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *modelParser) parseInsert() (*modelStmt, error) {
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	table, err := p.expectTable()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("JSON") {
+		var v interface{}
+		if v, err = p.parseOperand(); err != nil {
+			return nil, err
+		}
+		stmt := &modelStmt{kind: modelStmtInsertJSON, table: table, value: v}
+		if err = p.parseUsing(stmt); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	stmt := &modelStmt{kind: modelStmtInsert, table: table}
+	if err = p.expectPunct("("); err != nil {
+		return nil, err
+	}
+	for {
+		var column string
+		if column, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+		stmt.columns = append(stmt.columns, column)
+		if p.acceptPunct(")") {
+			break
+		}
+		if err = p.expectPunct(","); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	values, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	list, ok := values.([]interface{})
+	if !ok || len(list) != len(stmt.columns) {
+		return nil, errors.Errorf("insert has %d columns and %d values", len(stmt.columns), len(list))
+	}
+	stmt.values = list
+	if p.acceptKeyword("IF") {
+		if err = p.expectKeyword("NOT"); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.ifNotExists = true
+	}
+	if err = p.parseUsing(stmt); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *modelParser) parseUpdate() (*modelStmt, error) {
+	table, err := p.expectTable()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &modelStmt{kind: modelStmtUpdate, table: table}
+	if err = p.parseUsing(stmt); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		var a modelAssignment
+		if a, err = p.parseAssignment(); err != nil {
+			return nil, err
+		}
+		stmt.assignments = append(stmt.assignments, a)
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	if err = p.expectKeyword("WHERE"); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseUsing reads the USING TTL clause of an INSERT or an UPDATE, if any.
+func (p *modelParser) parseUsing(stmt *modelStmt) error {
+	if !p.acceptKeyword("USING") {
+		return nil
+	}
+	if err := p.expectKeyword("TTL"); err != nil {
+		return err
+	}
+	v, err := p.parseOperand()
+	if err != nil {
+		return err
+	}
+	if stmt.ttl = asInt64(v); stmt.ttl < 0 {
+		return errors.Errorf("invalid TTL %d", stmt.ttl)
+	}
+	return nil
+}
+
+func (p *modelParser) parseAssignment() (modelAssignment, error) {
+	column, err := p.expectIdent()
+	if err != nil {
+		return modelAssignment{}, err
+	}
+	a := modelAssignment{column: column, kind: modelAssignSet}
+	if p.acceptPunct("[") {
+		a.kind = modelAssignElement
+		if a.key, err = p.parseOperand(); err != nil {
+			return modelAssignment{}, err
+		}
+		if err = p.expectPunct("]"); err != nil {
+			return modelAssignment{}, err
+		}
+	}
+	if err = p.expectPunct("="); err != nil {
+		return modelAssignment{}, err
+	}
+	if a.kind == modelAssignElement {
+		a.value, err = p.parseOperand()
+		return a, err
+	}
+	if t := p.peek(); t.kind == modelTokenIdent && t.text == column {
+		p.pos++
+		switch {
+		case p.acceptPunct("+"):
+			a.kind = modelAssignAdd
+		case p.acceptPunct("-"):
+			a.kind = modelAssignRemove
+		default:
+			return modelAssignment{}, errors.Errorf("unexpected %q in assignment to %s", p.peek().text, column)
+		}
+		a.value, err = p.parseOperand()
+		return a, err
+	}
+	if a.value, err = p.parseOperand(); err != nil {
+		return modelAssignment{}, err
+	}
+	if p.acceptPunct("+") {
+		if _, err = p.expectIdent(); err != nil {
+			return modelAssignment{}, err
+		}
+		a.kind = modelAssignPrepend
+	}
+	return a, nil
+}
+
+func (p *modelParser) parseDelete() (*modelStmt, error) {
+	stmt := &modelStmt{kind: modelStmtDelete}
+	for !p.isKeyword("FROM") {
+		column, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if p.acceptPunct("[") {
+			a := modelAssignment{column: column, kind: modelAssignElement}
+			if a.key, err = p.parseOperand(); err != nil {
+				return nil, err
+			}
+			if err = p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+			stmt.elements = append(stmt.elements, a)
+		} else {
+			stmt.columns = append(stmt.columns, column)
+		}
+		if !p.acceptPunct(",") {
+			break
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table, err := p.expectTable()
+	if err != nil {
+		return nil, err
+	}
+	stmt.table = table
+	if err = p.expectKeyword("WHERE"); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.parseWhere(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *modelParser) parseWhere() ([]modelRelation, error) {
+	var out []modelRelation
+	for {
+		column, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		rel := modelRelation{column: column}
+		if strings.EqualFold(column, "token") && p.acceptPunct("(") {
+			for {
+				var pk string
+				if pk, err = p.expectIdent(); err != nil {
+					return nil, err
+				}
+				rel.tokenOf = append(rel.tokenOf, pk)
+				if p.acceptPunct(")") {
+					break
+				}
+				if err = p.expectPunct(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if p.acceptKeyword("IN") {
+			rel.op = modelOpIn
+			var v interface{}
+			if v, err = p.parseOperand(); err != nil {
+				return nil, err
+			}
+			list, ok := v.([]interface{})
+			if !ok {
+				list = []interface{}{v}
+			}
+			rel.values = list
+		} else {
+			t := p.next()
+			if t.kind != modelTokenPunct {
+				return nil, errors.Errorf("expected operator, got %q", t.text)
+			}
+			switch op := modelOp(t.text); op {
+			case modelOpEq, modelOpLt, modelOpLte, modelOpGt, modelOpGte:
+				rel.op = op
+			default:
+				return nil, errors.Errorf("unsupported operator %q", t.text)
+			}
+			var v interface{}
+			if v, err = p.parseOperand(); err != nil {
+				return nil, err
+			}
+			rel.values = []interface{}{v}
+		}
+		out = append(out, rel)
+		if !p.acceptKeyword("AND") {
+			return out, nil
+		}
+	}
+}
+
+func (p *modelParser) parseBatch() (*modelStmt, error) {
+	stmt := &modelStmt{kind: modelStmtBatch}
+	for _, batchType := range []string{"UNLOGGED", "COUNTER"} {
+		if p.acceptKeyword(batchType) {
+			stmt.batchType = batchType
+			break
+		}
+	}
+	if err := p.expectKeyword("BATCH"); err != nil {
+		return nil, err
+	}
+	for !p.isKeyword("APPLY") {
+		if p.pos >= len(p.tokens) {
+			return nil, errors.New("batch is not terminated with APPLY BATCH")
+		}
+		child, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmt.stmts = append(stmt.stmts, child)
+		p.acceptPunct(";")
+	}
+	p.pos++
+	if err := p.expectKeyword("BATCH"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseDDL only extracts what the model needs to know about a schema change,
+// which is the column being dropped, if any. Everything else is taken from
+// the schema itself.
+func (p *modelParser) parseDDL() (*modelStmt, error) {
+	stmt := &modelStmt{kind: modelStmtDDL}
+	p.pos++
+	if p.acceptKeyword("TABLE") {
+		table, err := p.expectTable()
+		if err != nil {
+			return nil, err
+		}
+		stmt.table = table
+		if p.acceptKeyword("DROP") {
+			if stmt.dropColumn, err = p.expectIdent(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.pos = len(p.tokens)
+	return stmt, nil
+}
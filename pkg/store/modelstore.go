@@ -0,0 +1,1252 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pkg/errors"
+	"github.com/scylladb/gocqlx/v2/qb"
+
+	"github.com/scylladb/gemini/pkg/routingkey"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// modelStore is an in-memory oracle. Instead of forwarding statements to a
+// second cluster it applies them to a simple row model of every table and
+// answers the queries generated by the validation jobs from that model.
+type modelStore struct {
+	schema     *typedef.Schema
+	tables     map[string]*modelTable
+	keyCreator *routingkey.Creator
+	system     string
+	mu         sync.RWMutex
+}
+
+type modelTable struct {
+	partitions map[string]*modelPartition
+}
+
+type modelPartition struct {
+	keys map[string]interface{}
+	rows map[string]*modelRow
+	key  string
+	// tombstones are the partition, row and range deletions of the
+	// partition, which shadow the writes older than them.
+	tombstones []modelTombstone
+	token      int64
+}
+
+// modelTombstone deletes the rows matched by filter written at ts or before.
+type modelTombstone struct {
+	filter *modelFilter
+	ts     int64
+}
+
+type modelRow struct {
+	keys  map[string]interface{}
+	cells map[string]interface{}
+	// writeTimes holds the timestamp in microseconds of the write that
+	// set each cell, counters have none.
+	writeTimes map[string]int64
+	// tombstones holds the timestamp of the last deletion of each cell,
+	// deleted the one of the last deletion of the whole row.
+	tombstones map[string]int64
+	deleted    int64
+	markerTime int64
+	// expiries holds the time in microseconds at which the cells written
+	// with a TTL expire, markerExpiry the one of the row marker, 0 if it
+	// does not expire.
+	expiries     map[string]int64
+	markerExpiry int64
+	marker       bool
+}
+
+func newModelStore(schema *typedef.Schema, system string) *modelStore {
+	return &modelStore{
+		schema:     schema,
+		system:     system,
+		tables:     make(map[string]*modelTable),
+		keyCreator: &routingkey.Creator{},
+	}
+}
+
+func (ms *modelStore) name() string {
+	return ms.system
+}
+
+func (ms *modelStore) close() error {
+	return nil
+}
+
+func (ms *modelStore) mutate(_ context.Context, builder qb.Builder, ts time.Time, values ...interface{}) error {
+	query, _ := builder.ToCql()
+	stmt, err := parseModelStmt(query, values)
+	if err != nil {
+		return err
+	}
+	if stmt.kind == modelStmtDDL {
+		// DDL statements are executed while the table lock is held,
+		// so the schema must not be locked again here.
+		ms.mu.Lock()
+		defer ms.mu.Unlock()
+		ms.applyDDL(stmt)
+		return nil
+	}
+	stmts := []*modelStmt{stmt}
+	if stmt.kind == modelStmtBatch {
+		stmts = stmt.stmts
+	}
+	tables := make([]*typedef.Table, 0, len(stmts))
+	for _, s := range stmts {
+		t, _ := ms.resolve(s.table)
+		if t == nil {
+			return errors.Errorf("[cluster = %s] unknown table %s", ms.system, s.table)
+		}
+		tables = append(tables, t)
+	}
+	unlock := ms.rlockTables(tables)
+	defer unlock()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	// Statements are validated before anything is applied so that
+	// a batch is applied either completely or not at all.
+	ops := make([]func(ts int64), len(stmts))
+	for i, s := range stmts {
+		if ops[i], err = ms.prepare(tables[i], s); err != nil {
+			return errors.Wrapf(err, "[cluster = %s, query = '%s']", ms.system, query)
+		}
+	}
+	for _, op := range ops {
+		op(ts.UnixNano() / 1000)
+	}
+	return nil
+}
+
+func (ms *modelStore) load(_ context.Context, builder qb.Builder, values []interface{}) rowIterator {
+	rows, err := ms.loadRows(builder, values)
+	return &sliceIterator{rows: rows, err: err}
+}
+
+func (ms *modelStore) loadRows(builder qb.Builder, values []interface{}) ([]map[string]interface{}, error) {
+	query, _ := builder.ToCql()
+	stmt, err := parseModelStmt(query, values)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.kind != modelStmtSelect {
+		return nil, errors.Errorf("[cluster = %s] query '%s' is not a select statement", ms.system, query)
+	}
+	t, mv := ms.resolve(stmt.table)
+	if t == nil {
+		return nil, errors.Errorf("[cluster = %s] unknown table %s", ms.system, stmt.table)
+	}
+	t.RLock()
+	defer t.RUnlock()
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	filter, err := newModelFilter(t, stmt.where)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[cluster = %s, query = '%s']", ms.system, query)
+	}
+	// Cells written with a TTL are returned until they expire.
+	now := time.Now().UnixNano() / 1000
+	if mv == nil {
+		var out []map[string]interface{}
+		for _, p := range ms.partitions(t, filter) {
+			if !filter.matchToken(p.token) {
+				continue
+			}
+			for _, r := range sortedRows(t, p) {
+				if r = r.at(now); !r.visible() || !filter.matchRow(p, r) {
+					continue
+				}
+				var row map[string]interface{}
+				if row, err = ms.output(t, stmt.selectors, p, r, now); err != nil {
+					return nil, errors.Wrapf(err, "[cluster = %s, query = '%s']", ms.system, query)
+				}
+				out = append(out, row)
+			}
+		}
+		return out, nil
+	}
+
+	// Rows of a view are selected from the base table and returned
+	// in the order of the primary key of the view.
+	view := mv.AsTable(t)
+	for _, c := range append(append(typedef.Columns{}, mv.PartitionKeys...), mv.ClusteringKeys...) {
+		filter.notNull = append(filter.notNull, c.Name)
+	}
+	type viewRow struct {
+		p    *modelPartition
+		r    *modelRow
+		keys map[string]interface{}
+	}
+	keyCreator := &routingkey.Creator{}
+	var rows []viewRow
+	for _, p := range ms.partitions(t, filter) {
+		for _, r := range p.rows {
+			if r = r.at(now); !r.visible() || !filter.matchRow(p, r) {
+				continue
+			}
+			keys := make(map[string]interface{}, len(view.PartitionKeys)+len(view.ClusteringKeys))
+			for _, cols := range []typedef.Columns{view.PartitionKeys, view.ClusteringKeys} {
+				for _, c := range cols {
+					keys[c.Name] = r.value(p, c.Name)
+				}
+			}
+			if filter.matchToken(rowToken(view, keyCreator, keys)) {
+				rows = append(rows, viewRow{p: p, r: r, keys: keys})
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return compareRowKeys(view, keyCreator, rows[i].keys, rows[j].keys) < 0
+	})
+	out := make([]map[string]interface{}, 0, len(rows))
+	for _, vr := range rows {
+		var row map[string]interface{}
+		if row, err = ms.output(t, stmt.selectors, vr.p, vr.r, now); err != nil {
+			return nil, errors.Wrapf(err, "[cluster = %s, query = '%s']", ms.system, query)
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+// resolve finds the table by name. Materialized views are answered from
+// the rows of their base table.
+func (ms *modelStore) resolve(name string) (*typedef.Table, *typedef.MaterializedView) {
+	for _, t := range ms.schema.Tables {
+		if t.Name == name {
+			return t, nil
+		}
+		for i := range t.MaterializedViews {
+			if t.MaterializedViews[i].Name == name {
+				return t, &t.MaterializedViews[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (ms *modelStore) rlockTables(tables []*typedef.Table) func() {
+	var locked []*typedef.Table
+	for _, t := range ms.schema.Tables {
+		for _, tt := range tables {
+			if tt == t {
+				t.RLock()
+				locked = append(locked, t)
+				break
+			}
+		}
+	}
+	return func() {
+		for _, t := range locked {
+			t.RUnlock()
+		}
+	}
+}
+
+func (ms *modelStore) table(name string) *modelTable {
+	mt, ok := ms.tables[name]
+	if !ok {
+		mt = &modelTable{partitions: make(map[string]*modelPartition)}
+		ms.tables[name] = mt
+	}
+	return mt
+}
+
+func (ms *modelStore) applyDDL(stmt *modelStmt) {
+	if stmt.dropKeyspace {
+		ms.tables = make(map[string]*modelTable)
+		return
+	}
+	if stmt.dropColumn == "" {
+		return
+	}
+	mt, ok := ms.tables[stmt.table]
+	if !ok {
+		return
+	}
+	for _, p := range mt.partitions {
+		for key, r := range p.rows {
+			r.unset(stmt.dropColumn)
+			if r.empty() {
+				delete(p.rows, key)
+			}
+		}
+	}
+}
+
+// prepare validates the statement against the table and returns
+// a function applying it to the model.
+func (ms *modelStore) prepare(t *typedef.Table, stmt *modelStmt) (func(ts int64), error) {
+	switch stmt.kind {
+	case modelStmtInsert:
+		return ms.prepareInsert(t, stmt.columns, stmt.values, stmt.ifNotExists, stmt.ttl)
+	case modelStmtInsertJSON:
+		return ms.prepareInsertJSON(t, stmt)
+	case modelStmtUpdate:
+		return ms.prepareUpdate(t, stmt)
+	case modelStmtDelete:
+		return ms.prepareDelete(t, stmt)
+	default:
+		return nil, errors.Errorf("statement is not a mutation")
+	}
+}
+
+func (ms *modelStore) prepareInsert(t *typedef.Table, columns []string, values []interface{}, ifNotExists bool, ttl int64) (func(ts int64), error) {
+	pk := make(map[string]interface{}, len(t.PartitionKeys))
+	ck := make(map[string]interface{}, len(t.ClusteringKeys))
+	cells := make(map[string]interface{}, len(columns))
+	for i, name := range columns {
+		col, kind := findColumn(t, name)
+		if col == nil {
+			return nil, errors.Errorf("unknown column %s", name)
+		}
+		v, err := normalizeCell(col.Type, values[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for column %s", name)
+		}
+		switch kind {
+		case columnPartitionKey:
+			pk[name] = v
+		case columnClusteringKey:
+			ck[name] = v
+		default:
+			cells[name] = v
+		}
+	}
+	pKey, err := encodeKey(t.PartitionKeys, pk)
+	if err != nil {
+		return nil, err
+	}
+	cKey, err := encodeKey(t.ClusteringKeys, ck)
+	if err != nil {
+		return nil, err
+	}
+	return func(ts int64) {
+		r := ms.partition(t, pKey, pk).row(cKey, ck)
+		r.expire(ts)
+		if ifNotExists && r.visible() {
+			return
+		}
+		if ts > r.deleted && ts >= r.markerTime {
+			r.marker = true
+			r.markerTime = ts
+			r.markerExpiry = expiry(ts, ttl)
+		}
+		r.set(cells, ts)
+		r.setExpiry(cells, ts, expiry(ts, ttl))
+	}, nil
+}
+
+func (ms *modelStore) prepareInsertJSON(t *typedef.Table, stmt *modelStmt) (func(ts int64), error) {
+	doc, ok := stmt.value.(string)
+	if !ok {
+		return nil, errors.Errorf("expected JSON document, got %T", stmt.value)
+	}
+	decoder := json.NewDecoder(strings.NewReader(doc))
+	decoder.UseNumber()
+	var obj map[string]interface{}
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON document")
+	}
+	var (
+		columns []string
+		values  []interface{}
+	)
+	for _, cols := range []typedef.Columns{t.PartitionKeys, t.ClusteringKeys, t.Columns} {
+		for _, col := range cols {
+			v, err := fromJSON(col.Type, obj[col.Name])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid JSON value for column %s", col.Name)
+			}
+			columns = append(columns, col.Name)
+			values = append(values, v)
+		}
+	}
+	return ms.prepareInsert(t, columns, values, false, stmt.ttl)
+}
+
+func (ms *modelStore) prepareUpdate(t *typedef.Table, stmt *modelStmt) (func(ts int64), error) {
+	pk, ck, err := exactKeys(t, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	pKey, err := encodeKey(t.PartitionKeys, pk)
+	if err != nil {
+		return nil, err
+	}
+	cKey, err := encodeKey(t.ClusteringKeys, ck)
+	if err != nil {
+		return nil, err
+	}
+	// Setting a list element reads the row as it was before the statement.
+	var current *modelRow
+	if p, ok := ms.table(t.Name).partitions[pKey]; ok {
+		current = p.rows[cKey]
+	}
+	updates := make([]func(r *modelRow, ts int64), len(stmt.assignments))
+	for i, a := range stmt.assignments {
+		col, kind := findColumn(t, a.column)
+		if col == nil || kind != columnRegular {
+			return nil, errors.Errorf("column %s can not be updated", a.column)
+		}
+		if updates[i], err = prepareAssignment(col, a, current); err != nil {
+			return nil, err
+		}
+	}
+	return func(ts int64) {
+		p := ms.partition(t, pKey, pk)
+		r := p.row(cKey, ck)
+		r.expire(ts)
+		cells := make(map[string]interface{}, len(stmt.assignments))
+		for i, update := range updates {
+			update(r, ts)
+			cells[stmt.assignments[i].column] = nil
+		}
+		r.setExpiry(cells, ts, expiry(ts, stmt.ttl))
+		if r.empty() {
+			delete(p.rows, cKey)
+		}
+	}, nil
+}
+
+func prepareAssignment(col *typedef.ColumnDef, a modelAssignment, current *modelRow) (func(r *modelRow, ts int64), error) {
+	name := col.Name
+	if isCollection(col.Type) {
+		return prepareCollectionAssignment(col, a, current)
+	}
+	switch a.kind {
+	case modelAssignSet:
+		v, err := normalizeCell(col.Type, a.value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for column %s", name)
+		}
+		return func(r *modelRow, ts int64) {
+			r.set(map[string]interface{}{name: v}, ts)
+		}, nil
+	case modelAssignAdd:
+		if _, ok := col.Type.(*typedef.CounterType); ok {
+			delta, err := normalize(typeInfo(col.Type), a.value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid value for column %s", name)
+			}
+			return func(r *modelRow, _ int64) {
+				current, _ := r.cells[name].(int64)
+				r.cells[name] = current + delta.(int64)
+			}, nil
+		}
+	}
+	return nil, errors.Errorf("unsupported assignment to column %s", name)
+}
+
+// prepareCollectionAssignment prepares the update of a non-frozen list, set
+// or map column.
+func prepareCollectionAssignment(col *typedef.ColumnDef, a modelAssignment, current *modelRow) (func(r *modelRow, ts int64), error) {
+	name := col.Name
+	operandType := col.Type
+	if mt, ok := col.Type.(*typedef.MapType); ok && a.kind == modelAssignRemove {
+		operandType = &typedef.BagType{ComplexType: typedef.TYPE_SET, ValueType: mt.KeyType}
+	}
+	var update func(v interface{}) interface{}
+	switch a.kind {
+	case modelAssignSet:
+		v, err := normalizeCell(col.Type, a.value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for column %s", name)
+		}
+		update = func(interface{}) interface{} {
+			return v
+		}
+	case modelAssignAdd, modelAssignPrepend, modelAssignRemove:
+		operand, err := normalizeCell(operandType, a.value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for column %s", name)
+		}
+		switch {
+		case a.kind == modelAssignRemove:
+			update = func(v interface{}) interface{} {
+				return collectionRemove(col.Type, v, operand)
+			}
+		case a.kind == modelAssignPrepend && !isList(col.Type):
+			return nil, errors.Errorf("column %s is not a list", name)
+		default:
+			update = func(v interface{}) interface{} {
+				return collectionAdd(col.Type, v, operand, a.kind == modelAssignPrepend)
+			}
+		}
+	case modelAssignElement:
+		var err error
+		if update, err = prepareElementAssignment(col, a, current); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("unsupported assignment to column %s", name)
+	}
+	return func(r *modelRow, ts int64) {
+		r.set(map[string]interface{}{name: update(r.cells[name])}, ts)
+	}, nil
+}
+
+// prepareElementAssignment prepares setting the element of a list at an
+// index, which must exist in the current row, or the value of a map key.
+func prepareElementAssignment(col *typedef.ColumnDef, a modelAssignment, current *modelRow) (func(v interface{}) interface{}, error) {
+	name := col.Name
+	switch typ := col.Type.(type) {
+	case *typedef.BagType:
+		if typ.ComplexType != typedef.TYPE_LIST {
+			return nil, errors.Errorf("column %s is not a list or a map", name)
+		}
+		index := asInt64(a.key)
+		size := 0
+		if current != nil {
+			size = collectionLen(current.cells[name])
+		}
+		if index < 0 || index >= int64(size) {
+			return nil, errors.Wrapf(ErrInvalidRequest, "list index %d out of bound, list has size %d", index, size)
+		}
+		elem, err := normalize(typ.ValueType.CQLType(), a.value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for column %s", name)
+		}
+		return func(v interface{}) interface{} {
+			return listSet(v, int(index), elem)
+		}, nil
+	case *typedef.MapType:
+		key, err := normalize(typ.KeyType.CQLType(), a.key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key for column %s", name)
+		}
+		elem, err := normalize(typ.ValueType.CQLType(), a.value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for column %s", name)
+		}
+		return func(v interface{}) interface{} {
+			return mapPut(typ, v, key, elem)
+		}, nil
+	default:
+		return nil, errors.Errorf("column %s is not a list or a map", name)
+	}
+}
+
+func (ms *modelStore) prepareDelete(t *typedef.Table, stmt *modelStmt) (func(ts int64), error) {
+	filter, err := newModelFilter(t, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	// The tombstone of a partition the model does not hold yet is kept
+	// to shadow the older writes applied after it.
+	pk, err := eqPartitionKeys(t, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	var pKey string
+	if pk != nil {
+		if pKey, err = encodeKey(t.PartitionKeys, pk); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range stmt.columns {
+		if col, kind := findColumn(t, name); col == nil || kind != columnRegular {
+			return nil, errors.Errorf("column %s can not be deleted", name)
+		}
+	}
+	deleteKeys := make([]func(r *modelRow, ts int64), len(stmt.elements))
+	for i, e := range stmt.elements {
+		col, _ := findColumn(t, e.column)
+		var mt *typedef.MapType
+		if col != nil {
+			mt, _ = col.Type.(*typedef.MapType)
+		}
+		if mt == nil || mt.Frozen {
+			return nil, errors.Errorf("keys of column %s can not be deleted", e.column)
+		}
+		key, err := normalize(mt.KeyType.CQLType(), e.key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key for column %s", e.column)
+		}
+		name := col.Name
+		deleteKeys[i] = func(r *modelRow, ts int64) {
+			if v, ok := r.cells[name]; ok && r.writeTimes[name] <= ts {
+				r.set(map[string]interface{}{name: mapPut(mt, v, key, nil)}, r.writeTimes[name])
+			}
+		}
+	}
+	columns := len(stmt.columns) + len(stmt.elements)
+	return func(ts int64) {
+		mt := ms.table(t.Name)
+		if pk != nil && columns == 0 {
+			ms.partition(t, pKey, pk)
+		}
+		for _, p := range ms.partitions(t, filter) {
+			if columns == 0 {
+				p.tombstones = append(p.tombstones, modelTombstone{filter: filter, ts: ts})
+			}
+			for key, r := range p.rows {
+				if !filter.matchRow(p, r) {
+					continue
+				}
+				if columns == 0 {
+					r.delete(ts)
+				}
+				for _, name := range stmt.columns {
+					r.deleteCell(name, ts)
+				}
+				for _, deleteKey := range deleteKeys {
+					deleteKey(r, ts)
+				}
+				if r.empty() {
+					delete(p.rows, key)
+				}
+			}
+		}
+		for key, p := range mt.partitions {
+			if len(p.rows) == 0 && len(p.tombstones) == 0 {
+				delete(mt.partitions, key)
+			}
+		}
+	}, nil
+}
+
+// eqPartitionKeys returns the values of the partition key columns if all of
+// them are restricted by equality, nil otherwise.
+func eqPartitionKeys(t *typedef.Table, where []modelRelation) (map[string]interface{}, error) {
+	pk := make(map[string]interface{}, len(t.PartitionKeys))
+	for _, rel := range where {
+		col, kind := findColumn(t, rel.column)
+		if col == nil || kind != columnPartitionKey || rel.op != modelOpEq || rel.tokenOf != nil {
+			continue
+		}
+		v, err := normalize(typeInfo(col.Type), rel.values[0])
+		if err != nil {
+			return nil, err
+		}
+		pk[rel.column] = v
+	}
+	if len(pk) != len(t.PartitionKeys) {
+		return nil, nil
+	}
+	return pk, nil
+}
+
+// partitions returns the partitions the filter may match in token order,
+// the order in which the cluster returns them. When the filter restricts
+// every partition key column to a set of values the partitions are looked
+// up directly, otherwise the whole table is scanned.
+func (ms *modelStore) partitions(t *typedef.Table, filter *modelFilter) []*modelPartition {
+	mt, ok := ms.tables[t.Name]
+	if !ok {
+		return nil
+	}
+	var out []*modelPartition
+	if keys, ok := filter.partitionKeys(t); ok {
+		seen := make(map[string]struct{}, len(keys))
+		for _, key := range keys {
+			if _, dup := seen[key]; dup {
+				continue
+			}
+			seen[key] = struct{}{}
+			if p, ok := mt.partitions[key]; ok && filter.matchPartition(p) {
+				out = append(out, p)
+			}
+		}
+	} else {
+		for _, p := range mt.partitions {
+			if filter.matchPartition(p) {
+				out = append(out, p)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].token != out[j].token {
+			return out[i].token < out[j].token
+		}
+		return out[i].key < out[j].key
+	})
+	return out
+}
+
+func (ms *modelStore) output(t *typedef.Table, selectors []modelSelector, p *modelPartition, r *modelRow, now int64) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	emit := func(col *typedef.ColumnDef, alias string) error {
+		v := r.value(p, col.Name)
+		if tt, ok := col.Type.(*typedef.TupleType); ok {
+			elems, _ := v.([]interface{})
+			for i, vt := range tt.ValueTypes {
+				var ev interface{}
+				if i < len(elems) {
+					ev = elems[i]
+				}
+				if ev == nil {
+					var err error
+					if ev, err = normalize(vt.CQLType(), nil); err != nil {
+						return err
+					}
+				}
+				out[gocql.TupleColumnName(alias, i)] = ev
+			}
+			return nil
+		}
+		if v == nil {
+			var err error
+			if v, err = normalize(typeInfo(col.Type), nil); err != nil {
+				return err
+			}
+		}
+		out[alias] = v
+		return nil
+	}
+	if len(selectors) == 0 {
+		for _, cols := range []typedef.Columns{t.PartitionKeys, t.ClusteringKeys, t.Columns} {
+			for _, col := range cols {
+				if err := emit(col, col.Name); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return out, nil
+	}
+	for _, sel := range selectors {
+		col, kind := findColumn(t, sel.column)
+		if col == nil {
+			return nil, errors.Errorf("unknown column %s", sel.column)
+		}
+		if sel.function != "" {
+			if kind != columnRegular {
+				return nil, errors.Errorf("selector %s is not allowed on a primary key column", sel.alias)
+			}
+			v, err := selectorValue(sel, col, r, now)
+			if err != nil {
+				return nil, err
+			}
+			out[sel.alias] = v
+			continue
+		}
+		if err := emit(col, sel.alias); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// selectorValue answers the WRITETIME and TTL selectors of a regular column,
+// the TTL being the number of seconds left before the cell expires at now.
+// Null results are returned as zero values, like the driver does.
+func selectorValue(sel modelSelector, col *typedef.ColumnDef, r *modelRow, now int64) (interface{}, error) {
+	switch sel.function {
+	case "writetime":
+		return r.writeTimes[col.Name], nil
+	case "ttl":
+		e, ok := r.expiries[col.Name]
+		if !ok {
+			return 0, nil
+		}
+		return int((e - now + microsPerSecond - 1) / microsPerSecond), nil
+	default:
+		return nil, errors.Errorf("unsupported selector %s", sel.alias)
+	}
+}
+
+func (ms *modelStore) partition(t *typedef.Table, key string, keys map[string]interface{}) *modelPartition {
+	mt := ms.table(t.Name)
+	p, ok := mt.partitions[key]
+	if !ok {
+		values := make([]interface{}, 0, len(t.PartitionKeys))
+		for _, pk := range t.PartitionKeys {
+			values = append(values, keys[pk.Name])
+		}
+		// The key values were already marshaled when the key was encoded.
+		token, _ := ms.keyCreator.GetHash(t, values)
+		p = &modelPartition{keys: keys, rows: make(map[string]*modelRow), key: key, token: int64(token)}
+		mt.partitions[key] = p
+	}
+	return p
+}
+
+// row returns the row of the partition to write to, which is created if
+// needed and shadows the writes older than the tombstones matching it.
+func (p *modelPartition) row(key string, keys map[string]interface{}) *modelRow {
+	r, ok := p.rows[key]
+	if !ok {
+		r = &modelRow{
+			keys:       keys,
+			cells:      make(map[string]interface{}),
+			writeTimes: make(map[string]int64),
+			expiries:   make(map[string]int64),
+			tombstones: make(map[string]int64),
+		}
+		p.rows[key] = r
+	}
+	for _, ts := range p.tombstones {
+		if ts.ts > r.deleted && ts.filter.matchRow(p, r) {
+			r.deleted = ts.ts
+		}
+	}
+	return r
+}
+
+// set writes the cells at ts, last write wins: the writes older than the
+// cells or than their deletion are ignored, a deletion winning a tie.
+func (r *modelRow) set(cells map[string]interface{}, ts int64) {
+	for name, v := range cells {
+		if ts <= r.deleted || ts <= r.tombstones[name] {
+			continue
+		}
+		if wt, ok := r.writeTimes[name]; ok && ts < wt {
+			continue
+		}
+		if isNullCell(v) {
+			r.deleteCell(name, ts)
+		} else {
+			r.cells[name] = v
+			r.writeTimes[name] = ts
+			delete(r.expiries, name)
+		}
+	}
+}
+
+// setExpiry makes the cells among the given ones written at ts expire at
+// the time in microseconds, 0 keeps them from expiring.
+func (r *modelRow) setExpiry(cells map[string]interface{}, ts, at int64) {
+	if at == 0 {
+		return
+	}
+	for name := range cells {
+		if _, ok := r.cells[name]; ok && r.writeTimes[name] == ts {
+			r.expiries[name] = at
+		}
+	}
+}
+
+// deleteCell deletes the cell if it was written at ts or before.
+func (r *modelRow) deleteCell(name string, ts int64) {
+	if ts > r.tombstones[name] {
+		r.tombstones[name] = ts
+	}
+	if r.writeTimes[name] <= ts {
+		r.unset(name)
+	}
+}
+
+// delete deletes the cells and the row marker written at ts or before.
+func (r *modelRow) delete(ts int64) {
+	if ts > r.deleted {
+		r.deleted = ts
+	}
+	if r.markerTime <= ts {
+		r.marker = false
+		r.markerExpiry = 0
+	}
+	for name := range r.cells {
+		if r.writeTimes[name] <= ts {
+			r.unset(name)
+		}
+	}
+}
+
+// empty reports whether the row holds neither data nor cell tombstones,
+// the tombstones of whole rows being kept by the partition.
+func (r *modelRow) empty() bool {
+	return !r.visible() && len(r.tombstones) == 0
+}
+
+func (r *modelRow) unset(name string) {
+	delete(r.cells, name)
+	delete(r.writeTimes, name)
+	delete(r.expiries, name)
+}
+
+// expire removes the cells and the row marker that expired at now.
+func (r *modelRow) expire(now int64) {
+	if r.markerExpiry != 0 && r.markerExpiry <= now {
+		r.marker = false
+		r.markerExpiry = 0
+	}
+	for name, at := range r.expiries {
+		if at <= now {
+			r.unset(name)
+		}
+	}
+}
+
+// at returns the row as it is at now, a copy of it without the cells and
+// the row marker that expired if any did.
+func (r *modelRow) at(now int64) *modelRow {
+	expired := r.markerExpiry != 0 && r.markerExpiry <= now
+	for _, at := range r.expiries {
+		expired = expired || at <= now
+	}
+	if !expired {
+		return r
+	}
+	out := &modelRow{
+		keys:         r.keys,
+		cells:        make(map[string]interface{}, len(r.cells)),
+		writeTimes:   make(map[string]int64, len(r.writeTimes)),
+		expiries:     make(map[string]int64, len(r.expiries)),
+		markerExpiry: r.markerExpiry,
+		marker:       r.marker,
+	}
+	for name, v := range r.cells {
+		out.cells[name] = v
+	}
+	for name, ts := range r.writeTimes {
+		out.writeTimes[name] = ts
+	}
+	for name, at := range r.expiries {
+		out.expiries[name] = at
+	}
+	out.expire(now)
+	return out
+}
+
+const microsPerSecond = int64(time.Second / time.Microsecond)
+
+// expiry returns the time in microseconds at which a write at ts with a
+// TTL in seconds expires, 0 if it has no TTL.
+func expiry(ts, ttl int64) int64 {
+	if ttl == 0 {
+		return 0
+	}
+	return ts + ttl*microsPerSecond
+}
+
+// value returns the value of a key column or cell of the row.
+func (r *modelRow) value(p *modelPartition, name string) interface{} {
+	if v, ok := p.keys[name]; ok {
+		return v
+	}
+	if v, ok := r.keys[name]; ok {
+		return v
+	}
+	return r.cells[name]
+}
+
+// visible reports whether a select would return the row, that is whether
+// it was inserted or still has at least one live cell.
+func (r *modelRow) visible() bool {
+	return r.marker || len(r.cells) > 0
+}
+
+func sortedRows(t *typedef.Table, p *modelPartition) []*modelRow {
+	rows := make([]*modelRow, 0, len(p.rows))
+	for _, r := range p.rows {
+		rows = append(rows, r)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		for _, ck := range t.ClusteringKeys {
+			if c := compareValues(ck.Type, rows[i].keys[ck.Name], rows[j].keys[ck.Name]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return rows
+}
+
+type columnKind int
+
+const (
+	columnPartitionKey columnKind = iota
+	columnClusteringKey
+	columnRegular
+)
+
+func findColumn(t *typedef.Table, name string) (*typedef.ColumnDef, columnKind) {
+	for _, c := range t.PartitionKeys {
+		if c.Name == name {
+			return c, columnPartitionKey
+		}
+	}
+	for _, c := range t.ClusteringKeys {
+		if c.Name == name {
+			return c, columnClusteringKey
+		}
+	}
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c, columnRegular
+		}
+	}
+	return nil, columnRegular
+}
+
+// normalizeCell converts a bound value into its read representation.
+// Tuples are kept as a list of their normalized elements since the
+// driver returns them as separate columns.
+func normalizeCell(t typedef.Type, value interface{}) (interface{}, error) {
+	if isSet(t) {
+		v, err := normalize(typeInfo(t), value)
+		if err != nil {
+			return nil, err
+		}
+		return sortSet(t.(*typedef.BagType).ValueType, v), nil
+	}
+	tt, ok := t.(*typedef.TupleType)
+	if !ok {
+		return normalize(typeInfo(t), value)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	elems, ok := value.([]interface{})
+	if !ok || len(elems) != len(tt.ValueTypes) {
+		return nil, errors.Errorf("expected %d tuple elements, got %v", len(tt.ValueTypes), value)
+	}
+	out := make([]interface{}, len(elems))
+	for i, vt := range tt.ValueTypes {
+		v, err := normalize(vt.CQLType(), elems[i])
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func isNullCell(v interface{}) bool {
+	if elems, ok := v.([]interface{}); ok {
+		for _, e := range elems {
+			if !isNull(e) {
+				return false
+			}
+		}
+		return true
+	}
+	return isNull(v)
+}
+
+// encodeKey serializes the key column values into a comparable map key.
+func encodeKey(columns typedef.Columns, values map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	for _, c := range columns {
+		v, ok := values[c.Name]
+		if !ok || isNullKey(v) {
+			return "", errors.Errorf("missing value for key column %s", c.Name)
+		}
+		data, err := gocql.Marshal(typeInfo(c.Type), v)
+		if err != nil {
+			return "", err
+		}
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(data)))
+		buf.Write(l[:])
+		buf.Write(data)
+	}
+	return buf.String(), nil
+}
+
+// exactKeys extracts the primary key from restrictions that must select
+// exactly one row, as required by UPDATE statements.
+func exactKeys(t *typedef.Table, where []modelRelation) (pk, ck map[string]interface{}, err error) {
+	pk = make(map[string]interface{}, len(t.PartitionKeys))
+	ck = make(map[string]interface{}, len(t.ClusteringKeys))
+	for _, rel := range where {
+		col, kind := findColumn(t, rel.column)
+		if col == nil || kind == columnRegular || rel.op != modelOpEq {
+			return nil, nil, errors.Errorf("unsupported restriction on %s", rel.column)
+		}
+		var v interface{}
+		if v, err = normalize(typeInfo(col.Type), rel.values[0]); err != nil {
+			return nil, nil, err
+		}
+		if kind == columnPartitionKey {
+			pk[rel.column] = v
+		} else {
+			ck[rel.column] = v
+		}
+	}
+	return pk, ck, nil
+}
+
+type modelCondition struct {
+	col    *typedef.ColumnDef
+	op     modelOp
+	values []interface{}
+	kind   columnKind
+}
+
+type modelTokenCondition struct {
+	op    modelOp
+	value int64
+}
+
+type modelFilter struct {
+	conditions []modelCondition
+	tokens     []modelTokenCondition
+	notNull    []string
+}
+
+func newModelFilter(t *typedef.Table, where []modelRelation) (*modelFilter, error) {
+	f := &modelFilter{}
+	for _, rel := range where {
+		if rel.tokenOf != nil {
+			v, err := normalize(typedef.TYPE_BIGINT.CQLType(), rel.values[0])
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid token value")
+			}
+			f.tokens = append(f.tokens, modelTokenCondition{op: rel.op, value: v.(int64)})
+			continue
+		}
+		col, kind := findColumn(t, rel.column)
+		if col == nil {
+			return nil, errors.Errorf("unknown column %s", rel.column)
+		}
+		info := typeInfo(col.Type)
+		values := make([]interface{}, 0, len(rel.values))
+		for _, v := range rel.values {
+			nv, err := normalize(info, v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid value for column %s", rel.column)
+			}
+			values = append(values, nv)
+		}
+		f.conditions = append(f.conditions, modelCondition{col: col, kind: kind, op: rel.op, values: values})
+	}
+	return f, nil
+}
+
+// partitionKeys returns the encoded keys of all partitions the filter
+// can match, if every partition key column is restricted by = or IN.
+func (f *modelFilter) partitionKeys(t *typedef.Table) ([]string, bool) {
+	candidates := make([]map[string]interface{}, 1, 16)
+	candidates[0] = map[string]interface{}{}
+	for _, pk := range t.PartitionKeys {
+		var values []interface{}
+		for _, c := range f.conditions {
+			if c.col.Name == pk.Name && (c.op == modelOpEq || c.op == modelOpIn) {
+				values = c.values
+				break
+			}
+		}
+		if values == nil {
+			return nil, false
+		}
+		next := make([]map[string]interface{}, 0, len(candidates)*len(values))
+		for _, cand := range candidates {
+			for _, v := range values {
+				m := make(map[string]interface{}, len(cand)+1)
+				for k, cv := range cand {
+					m[k] = cv
+				}
+				m[pk.Name] = v
+				next = append(next, m)
+			}
+		}
+		candidates = next
+	}
+	keys := make([]string, 0, len(candidates))
+	for _, cand := range candidates {
+		key, err := encodeKey(t.PartitionKeys, cand)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+func (f *modelFilter) matchToken(token int64) bool {
+	for _, c := range f.tokens {
+		var ok bool
+		switch c.op {
+		case modelOpEq:
+			ok = token == c.value
+		case modelOpLt:
+			ok = token < c.value
+		case modelOpLte:
+			ok = token <= c.value
+		case modelOpGt:
+			ok = token > c.value
+		case modelOpGte:
+			ok = token >= c.value
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *modelFilter) matchPartition(p *modelPartition) bool {
+	for _, c := range f.conditions {
+		if c.kind == columnPartitionKey && !c.match(p.keys[c.col.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *modelFilter) matchRow(p *modelPartition, r *modelRow) bool {
+	if !f.matchPartition(p) {
+		return false
+	}
+	for _, c := range f.conditions {
+		switch c.kind {
+		case columnClusteringKey:
+			if !c.match(r.keys[c.col.Name]) {
+				return false
+			}
+		case columnRegular:
+			if !c.match(r.cells[c.col.Name]) {
+				return false
+			}
+		}
+	}
+	for _, name := range f.notNull {
+		if p.keys[name] == nil && r.keys[name] == nil && isNullCell(r.cells[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c modelCondition) match(v interface{}) bool {
+	if isNullCell(v) {
+		return false
+	}
+	switch c.op {
+	case modelOpEq, modelOpIn:
+		for _, cv := range c.values {
+			if compareValues(c.col.Type, v, cv) == 0 {
+				return true
+			}
+		}
+		return false
+	case modelOpLt:
+		return compareValues(c.col.Type, v, c.values[0]) < 0
+	case modelOpLte:
+		return compareValues(c.col.Type, v, c.values[0]) <= 0
+	case modelOpGt:
+		return compareValues(c.col.Type, v, c.values[0]) > 0
+	case modelOpGte:
+		return compareValues(c.col.Type, v, c.values[0]) >= 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,518 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/scylladb/gocqlx/v2/qb"
+
+	"github.com/scylladb/gemini/pkg/routingkey"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+func modelTestSchema() *typedef.Schema {
+	return &typedef.Schema{
+		Keyspace: typedef.Keyspace{Name: "ks1"},
+		Tables: []*typedef.Table{
+			{
+				Name:           "table1",
+				PartitionKeys:  typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+				ClusteringKeys: typedef.Columns{{Name: "ck0", Type: typedef.TYPE_INT}},
+				Columns: typedef.Columns{
+					{Name: "col0", Type: typedef.TYPE_TEXT},
+					{Name: "col1", Type: &typedef.TupleType{ValueTypes: []typedef.SimpleType{typedef.TYPE_INT, typedef.TYPE_TEXT}}},
+				},
+			},
+			{
+				Name:          "table2",
+				PartitionKeys: typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+				Columns:       typedef.Columns{{Name: "col0", Type: &typedef.CounterType{}}},
+			},
+		},
+	}
+}
+
+func TestModelStoreInsertAndSelect(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ms := newModelStore(modelTestSchema(), "model")
+
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").TupleColumn("col1", 2)
+	for _, ck := range []int{3, 1, 2} {
+		if err := ms.mutate(ctx, insert, time.Now(), 1, ck, "a", 10, "b"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	for i, row := range rows {
+		if row["ck0"] != i+1 {
+			t.Errorf("row %d: expected ck0 %d, got %v", i, i+1, row["ck0"])
+		}
+		if row["col0"] != "a" || row["col1[0]"] != 10 || row["col1[1]"] != "b" {
+			t.Errorf("row %d: unexpected values %v", i, row)
+		}
+	}
+
+	rows, err = loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0"), qb.Gt("ck0"), qb.LtOrEq("ck0")), []interface{}{1, 1, 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["ck0"] != 2 || rows[1]["ck0"] != 3 {
+		t.Errorf("unexpected range result %v", rows)
+	}
+}
+
+func TestModelStoreInsertJSON(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ms := newModelStore(modelTestSchema(), "model")
+
+	doc := `{"pk0": 5, "ck0": 7, "col0": "x", "col1": [1, "y"]}`
+	if err := ms.mutate(ctx, qb.Insert("ks1.table1").Json(), time.Now(), doc); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.In("pk0")), []interface{}{[]interface{}{5, 6}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["col0"] != "x" || rows[0]["col1[0]"] != 1 || rows[0]["col1[1]"] != "y" {
+		t.Errorf("unexpected result %v", rows)
+	}
+}
+
+func TestModelStoreDelete(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ms := newModelStore(modelTestSchema(), "model")
+
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")
+	for ck := 0; ck < 5; ck++ {
+		if err := ms.mutate(ctx, insert, time.Now(), 1, ck, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	del := qb.Delete("ks1.table1").Where(qb.Eq("pk0"), qb.GtOrEq("ck0"), qb.LtOrEq("ck0"))
+	if err := ms.mutate(ctx, del, time.Now(), 1, 1, 3); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["ck0"] != 0 || rows[1]["ck0"] != 4 {
+		t.Errorf("unexpected result after range delete %v", rows)
+	}
+
+	if err = ms.mutate(ctx, qb.Delete("ks1.table1").Where(qb.Eq("pk0")), time.Now(), 1); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("expected partition to be deleted, got %v", rows)
+	}
+}
+
+func TestModelStoreDeleteShapes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := &typedef.Schema{
+		Keyspace: typedef.Keyspace{Name: "ks1"},
+		Tables: []*typedef.Table{{
+			Name:           "table1",
+			PartitionKeys:  typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+			ClusteringKeys: typedef.Columns{{Name: "ck0", Type: typedef.TYPE_INT}, {Name: "ck1", Type: typedef.TYPE_INT}},
+			Columns: typedef.Columns{
+				{Name: "col0", Type: typedef.TYPE_TEXT},
+				{Name: "m", Type: &typedef.MapType{ComplexType: typedef.TYPE_MAP, KeyType: typedef.TYPE_INT, ValueType: typedef.TYPE_TEXT}},
+			},
+		}},
+	}
+	ms := newModelStore(schema, "model")
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "ck1", "col0", "m")
+	for ck0 := 0; ck0 < 2; ck0++ {
+		for ck1 := 0; ck1 < 4; ck1++ {
+			if err := ms.mutate(ctx, insert, time.Now(), 1, ck0, ck1, "a", map[int]string{1: "x", 2: "y"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, step := range []struct {
+		builder qb.Builder
+		values  []interface{}
+	}{
+		// Deletes (0, 2) and (0, 3).
+		{qb.Delete("ks1.table1").Where(qb.Eq("pk0"), qb.Eq("ck0"), qb.Gt("ck1")), []interface{}{1, 0, 1}},
+		// Deletes (1, 0).
+		{qb.Delete("ks1.table1").Where(qb.Eq("pk0"), qb.Eq("ck0"), qb.Eq("ck1")), []interface{}{1, 1, 0}},
+		// Leaves (1, 1) with its row marker only.
+		{qb.Delete("ks1.table1").Columns("col0", "m").Where(qb.Eq("pk0"), qb.Eq("ck0"), qb.Eq("ck1")), []interface{}{1, 1, 1}},
+		// Leaves (1, 2) without the key 1 of its map.
+		{qb.Delete("ks1.table1").Columns("m[?]").Where(qb.Eq("pk0"), qb.Eq("ck0"), qb.Eq("ck1")), []interface{}{1, 1, 1, 2}},
+	} {
+		if err := ms.mutate(ctx, step.builder, time.Now(), step.values...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type row struct {
+		ck0, ck1 int
+		col0     interface{}
+		keys     int
+	}
+	expected := []row{{0, 0, "a", 2}, {0, 1, "a", 2}, {1, 1, "", 0}, {1, 2, "a", 1}, {1, 3, "a", 2}}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows, got %v", len(expected), rows)
+	}
+	for i, e := range expected {
+		m, _ := rows[i]["m"].(map[int]string)
+		if rows[i]["ck0"] != e.ck0 || rows[i]["ck1"] != e.ck1 || rows[i]["col0"] != e.col0 || len(m) != e.keys {
+			t.Errorf("row %d: expected %v, got %v", i, e, rows[i])
+		}
+	}
+	if m, _ := rows[3]["m"].(map[int]string); m[2] != "y" {
+		t.Errorf("expected the key 1 to be deleted, got %v", m)
+	}
+
+	if err = ms.mutate(ctx, qb.Delete("ks1.table1").Where(qb.Eq("pk0")), time.Now(), 1); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("expected the partition to be deleted, got %v", rows)
+	}
+}
+
+func TestModelStoreCounterUpdate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ms := newModelStore(modelTestSchema(), "model")
+
+	update := qb.Update("ks1.table2").Add("col0").Where(qb.Eq("pk0"))
+	for i := 0; i < 3; i++ {
+		if err := ms.mutate(ctx, update, time.Now(), int64(2), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table2").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["col0"] != int64(6) {
+		t.Errorf("unexpected counter value %v", rows)
+	}
+}
+
+func TestModelStoreBatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ms := newModelStore(modelTestSchema(), "model")
+
+	//nolint:staticcheck // batches are rendered to CQL by the generators
+	batch := qb.Batch().UnLogged().
+		Add(qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")).
+		Add(qb.Update("ks1.table1").Set("col0").Where(qb.Eq("pk0"), qb.Eq("ck0"))).
+		Add(qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")).
+		Add(qb.Delete("ks1.table1").Where(qb.Eq("pk0"), qb.GtOrEq("ck0"), qb.LtOrEq("ck0")))
+	if err := ms.mutate(ctx, batch, time.Now(), 1, 1, "a", "b", 1, 2, 1, 3, "c", 1, 3, 3); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["ck0"] != 1 || rows[0]["col0"] != "a" || rows[1]["ck0"] != 2 || rows[1]["col0"] != "b" {
+		t.Errorf("unexpected result after batch %v", rows)
+	}
+
+	//nolint:staticcheck // batches are rendered to CQL by the generators
+	counters := qb.Batch().Counter().
+		Add(qb.Update("ks1.table2").Add("col0").Where(qb.Eq("pk0"))).
+		Add(qb.Update("ks1.table2").Add("col0").Where(qb.Eq("pk0")))
+	if err = ms.mutate(ctx, counters, time.Now(), int64(2), 1, int64(3), 1); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = loadSet(ms.load(ctx, qb.Select("ks1.table2").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["col0"] != int64(5) {
+		t.Errorf("unexpected counter value after batch %v", rows)
+	}
+}
+
+func TestModelStoreCollectionUpdates(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := &typedef.Schema{
+		Keyspace: typedef.Keyspace{Name: "ks1"},
+		Tables: []*typedef.Table{{
+			Name:          "table1",
+			PartitionKeys: typedef.Columns{{Name: "pk0", Type: typedef.TYPE_INT}},
+			Columns: typedef.Columns{
+				{Name: "l", Type: &typedef.BagType{ComplexType: typedef.TYPE_LIST, ValueType: typedef.TYPE_INT}},
+				{Name: "s", Type: &typedef.BagType{ComplexType: typedef.TYPE_SET, ValueType: typedef.TYPE_TEXT}},
+				{Name: "m", Type: &typedef.MapType{ComplexType: typedef.TYPE_MAP, KeyType: typedef.TYPE_INT, ValueType: typedef.TYPE_TEXT}},
+			},
+		}},
+	}
+	ms := newModelStore(schema, "model")
+
+	for _, step := range []struct {
+		builder qb.Builder
+		values  []interface{}
+	}{
+		{qb.Update("ks1.table1").Set("l", "s", "m").Where(qb.Eq("pk0")), []interface{}{[]int{1, 2}, []string{"b", "a", "b"}, map[int]string{1: "x"}, 1}},
+		{qb.Update("ks1.table1").Add("l").Add("s").Add("m").Where(qb.Eq("pk0")), []interface{}{[]int{3, 1}, []string{"c", "a"}, map[int]string{1: "y", 2: "z"}, 1}},
+		{qb.Update("ks1.table1").SetLit("l", "?+l").Where(qb.Eq("pk0")), []interface{}{[]int{0}, 1}},
+		{qb.Update("ks1.table1").Remove("l").Remove("s").Where(qb.Eq("pk0")), []interface{}{[]int{1}, []string{"b"}, 1}},
+		{qb.Update("ks1.table1").SetLit("l[?]", "?").SetLit("m[?]", "?").Where(qb.Eq("pk0")), []interface{}{int32(0), 5, 3, "w", 1}},
+		{qb.Update("ks1.table1").Remove("m").Where(qb.Eq("pk0")), []interface{}{[]int{2}, 1}},
+	} {
+		if err := ms.mutate(ctx, step.builder, time.Now(), step.values...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected a row, got %v", rows)
+	}
+	if l, ok := rows[0]["l"].([]int); !ok || len(l) != 3 || l[0] != 5 || l[1] != 2 || l[2] != 3 {
+		t.Errorf("unexpected list %v", rows[0]["l"])
+	}
+	if s, ok := rows[0]["s"].([]string); !ok || len(s) != 2 || s[0] != "a" || s[1] != "c" {
+		t.Errorf("unexpected set %v", rows[0]["s"])
+	}
+	if m, ok := rows[0]["m"].(map[int]string); !ok || len(m) != 2 || m[1] != "y" || m[3] != "w" {
+		t.Errorf("unexpected map %v", rows[0]["m"])
+	}
+
+	setElement := qb.Update("ks1.table1").SetLit("l[?]", "?").Where(qb.Eq("pk0"))
+	if err = ms.mutate(ctx, setElement, time.Now(), int32(3), 1, 1); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected an invalid request setting an element out of the list, got %v", err)
+	}
+	if err = ms.mutate(ctx, qb.Update("ks1.table1").Remove("l").Remove("s").Remove("m").Where(qb.Eq("pk0")), time.Now(), []int{5, 2, 3}, []string{"a", "c"}, []int{1, 3}, 1); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("expected the row to be gone with its collections, got %v", rows)
+	}
+}
+
+func TestModelStoreIfNotExists(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ms := newModelStore(modelTestSchema(), "model")
+
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").Unique()
+	if err := ms.mutate(ctx, insert, time.Now(), 1, 1, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.mutate(ctx, insert, time.Now(), 1, 1, "second"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0"), qb.Eq("ck0")), []interface{}{1, 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["col0"] != "first" {
+		t.Errorf("unexpected result %v", rows)
+	}
+}
+
+func TestModelStoreTTL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ms := newModelStore(modelTestSchema(), "model")
+	now := time.Now()
+	past := now.Add(-2 * time.Second)
+
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")
+	if err := ms.mutate(ctx, insert.TTL(time.Hour), now, 1, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.mutate(ctx, qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").TTL(time.Second), past, 1, 2, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.mutate(ctx, qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0"), past, 1, 3, "a"); err != nil {
+		t.Fatal(err)
+	}
+	update := qb.Update("ks1.table1").TTL(time.Second).Set("col0").Where(qb.Eq("pk0"), qb.Eq("ck0"))
+	if err := ms.mutate(ctx, update, past, "b", 1, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	query := qb.Select("ks1.table1").Columns("ck0", "col0", "TTL(col0)").Where(qb.Eq("pk0"))
+	rows, err := loadSet(ms.load(ctx, query, []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The row written with an expired TTL is gone, the one updated with
+	// it is kept by the row marker of its insert.
+	if len(rows) != 2 || rows[0]["ck0"] != 1 || rows[1]["ck0"] != 3 {
+		t.Fatalf("unexpected result %v", rows)
+	}
+	if ttl, ok := rows[0]["ttl(col0)"].(int); !ok || ttl <= 3590 || ttl > 3600 {
+		t.Errorf("unexpected TTL %v", rows[0]["ttl(col0)"])
+	}
+	if rows[1]["col0"] != "" || rows[1]["ttl(col0)"] != 0 {
+		t.Errorf("expected the cell to expire, got %v", rows[1])
+	}
+
+	// A conditional insert applies to an expired row.
+	if err = ms.mutate(ctx, qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").Unique(), now, 1, 2, "c"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = loadSet(ms.load(ctx, query.Where(qb.Eq("ck0")), []interface{}{1, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["col0"] != "c" || rows[0]["ttl(col0)"] != 0 {
+		t.Errorf("unexpected result %v", rows)
+	}
+}
+
+func TestModelStoreLastWriteWins(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ms := newModelStore(modelTestSchema(), "model")
+	base := time.Now()
+	at := func(i int) time.Time {
+		return base.Add(time.Duration(i) * time.Millisecond)
+	}
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")
+	query := qb.Select("ks1.table1").Columns("ck0", "col0").Where(qb.Eq("pk0"))
+	load := func(pk int) []map[string]interface{} {
+		rows, err := loadSet(ms.load(ctx, query, []interface{}{pk}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	mutate := func(builder qb.Builder, ts time.Time, values ...interface{}) {
+		if err := ms.mutate(ctx, builder, ts, values...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An older write applied later does not overwrite a newer one.
+	mutate(insert, at(2), 1, 1, "new")
+	mutate(insert, at(1), 1, 1, "old")
+	if rows := load(1); len(rows) != 1 || rows[0]["col0"] != "new" {
+		t.Errorf("expected the newer write to win, got %v", rows)
+	}
+
+	// A deleted row is not brought back by an older write.
+	mutate(qb.Delete("ks1.table1").Where(qb.Eq("pk0"), qb.Eq("ck0")), at(3), 1, 1)
+	mutate(insert, at(2), 1, 1, "older")
+	if rows := load(1); len(rows) != 0 {
+		t.Errorf("expected the row to stay deleted, got %v", rows)
+	}
+	mutate(insert, at(4), 1, 1, "newer")
+	if rows := load(1); len(rows) != 1 || rows[0]["col0"] != "newer" {
+		t.Errorf("expected the newer write to be applied, got %v", rows)
+	}
+
+	// A range deletion shadows the older writes of the rows in the range,
+	// even in a partition the model did not hold when it was applied.
+	rangeDelete := qb.Delete("ks1.table1").Where(qb.Eq("pk0"), qb.GtOrEq("ck0"), qb.LtOrEq("ck0"))
+	mutate(rangeDelete, at(5), 2, 1, 3)
+	mutate(insert, at(4), 2, 2, "a")
+	mutate(insert, at(4), 2, 5, "a")
+	if rows := load(2); len(rows) != 1 || rows[0]["ck0"] != 5 {
+		t.Errorf("expected the row out of the range only, got %v", rows)
+	}
+
+	// A cell set to null is not brought back by an older update.
+	update := qb.Update("ks1.table1").Set("col0").Where(qb.Eq("pk0"), qb.Eq("ck0"))
+	mutate(update, at(6), nil, 2, 5)
+	mutate(update, at(5), "b", 2, 5)
+	if rows := load(2); len(rows) != 1 || rows[0]["col0"] != "" {
+		t.Errorf("expected the cell to stay deleted, got %v", rows)
+	}
+}
+
+func TestModelStoreInsertJSONTTL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ms := newModelStore(modelTestSchema(), "model")
+
+	doc := `{"pk0": 5, "ck0": 7, "col0": "x", "col1": [1, "y"]}`
+	insert := replayBuilder{query: "INSERT INTO ks1.table1 JSON ? USING TTL 1"}
+	if err := ms.mutate(ctx, insert, time.Now().Add(-2*time.Second), doc); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("expected the row to expire, got %v", rows)
+	}
+}
+
+func TestModelStoreTokenOrder(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	ms := newModelStore(schema, "model")
+
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0")
+	keys := make([]interface{}, 0, 20)
+	for pk := 0; pk < 20; pk++ {
+		keys = append(keys, pk)
+		if err := ms.mutate(ctx, insert, time.Now(), pk, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := loadSet(ms.load(ctx, qb.Select("ks1.table1").Where(qb.In("pk0")), []interface{}{keys}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(keys) {
+		t.Fatalf("expected %d rows, got %d", len(keys), len(rows))
+	}
+	keyCreator := &routingkey.Creator{}
+	for i := 1; i < len(rows); i++ {
+		if compareRowKeys(schema.Tables[0], keyCreator, rows[i-1], rows[i]) >= 0 {
+			t.Errorf("rows %v and %v are not in token order", rows[i-1], rows[i])
+		}
+	}
+}
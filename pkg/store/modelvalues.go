@@ -0,0 +1,269 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pkg/errors"
+	"gopkg.in/inf.v0"
+
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// typeInfo returns a fully described gocql type for the column type.
+// typedef.Type.CQLType only describes the outer type which is not enough
+// to marshal collections, tuples and UDTs.
+func typeInfo(t typedef.Type) gocql.TypeInfo {
+	switch typ := t.(type) {
+	case typedef.SimpleType:
+		return typ.CQLType()
+	case *typedef.BagType:
+		kind := gocql.TypeList
+		if typ.ComplexType == typedef.TYPE_SET {
+			kind = gocql.TypeSet
+		}
+		return gocql.CollectionType{
+			NativeType: gocql.NewNativeType(typedef.GoCQLProtoVersion4, kind, ""),
+			Elem:       typ.ValueType.CQLType(),
+		}
+	case *typedef.MapType:
+		return gocql.CollectionType{
+			NativeType: gocql.NewNativeType(typedef.GoCQLProtoVersion4, gocql.TypeMap, ""),
+			Key:        typ.KeyType.CQLType(),
+			Elem:       typ.ValueType.CQLType(),
+		}
+	case *typedef.TupleType:
+		elems := make([]gocql.TypeInfo, 0, len(typ.ValueTypes))
+		for _, vt := range typ.ValueTypes {
+			elems = append(elems, vt.CQLType())
+		}
+		return gocql.TupleTypeInfo{
+			NativeType: gocql.NewNativeType(typedef.GoCQLProtoVersion4, gocql.TypeTuple, ""),
+			Elems:      elems,
+		}
+	case *typedef.UDTType:
+		names := make([]string, 0, len(typ.ValueTypes))
+		for name := range typ.ValueTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fields := make([]gocql.UDTField, 0, len(names))
+		for _, name := range names {
+			fields = append(fields, gocql.UDTField{Name: name, Type: typ.ValueTypes[name].CQLType()})
+		}
+		return gocql.UDTTypeInfo{
+			NativeType: gocql.NewNativeType(typedef.GoCQLProtoVersion4, gocql.TypeUDT, ""),
+			Name:       typ.TypeName,
+			Elements:   fields,
+		}
+	case *typedef.CounterType:
+		return gocql.NewNativeType(typedef.GoCQLProtoVersion4, gocql.TypeCounter, "")
+	default:
+		panic(errors.Errorf("unsupported column type %T", t))
+	}
+}
+
+// normalize converts a bound value into the representation the driver
+// produces when the same value is read back with MapScan. A nil value
+// yields the representation of null.
+func normalize(info gocql.TypeInfo, value interface{}) (interface{}, error) {
+	var data []byte
+	if value != nil {
+		var err error
+		if data, err = gocql.Marshal(info, value); err != nil {
+			return nil, err
+		}
+	}
+	out := info.New()
+	if err := gocql.Unmarshal(info, data, out); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(out).Elem().Interface(), nil
+}
+
+// isNull reports whether a normalized value represents a null cell.
+// Empty collections are indistinguishable from null in CQL.
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return false
+	}
+}
+
+// fromJSON converts a value decoded from an INSERT JSON document into
+// a value gocql is able to marshal for the given column type.
+func fromJSON(t typedef.Type, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch typ := t.(type) {
+	case typedef.SimpleType:
+		return simpleFromJSON(typ, value)
+	case *typedef.BagType:
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, errors.Errorf("expected JSON list for %s, got %T", typ.CQLDef(), value)
+		}
+		out := make([]interface{}, 0, len(list))
+		for _, v := range list {
+			conv, err := simpleFromJSON(typ.ValueType, v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, conv)
+		}
+		return out, nil
+	case *typedef.MapType:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("expected JSON object for %s, got %T", typ.CQLDef(), value)
+		}
+		out := make(map[interface{}]interface{}, len(obj))
+		for k, v := range obj {
+			key, err := simpleFromJSON(typ.KeyType, json.Number(k))
+			if err != nil {
+				return nil, err
+			}
+			val, err := simpleFromJSON(typ.ValueType, v)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = val
+		}
+		return out, nil
+	case *typedef.TupleType:
+		list, ok := value.([]interface{})
+		if !ok || len(list) != len(typ.ValueTypes) {
+			return nil, errors.Errorf("expected JSON list of %d elements for %s, got %v", len(typ.ValueTypes), typ.CQLDef(), value)
+		}
+		out := make([]interface{}, 0, len(list))
+		for i, v := range list {
+			conv, err := simpleFromJSON(typ.ValueTypes[i], v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, conv)
+		}
+		return out, nil
+	case *typedef.UDTType:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("expected JSON object for %s, got %T", typ.CQLDef(), value)
+		}
+		out := make(map[string]interface{}, len(obj))
+		for name, vt := range typ.ValueTypes {
+			conv, err := simpleFromJSON(vt, obj[name])
+			if err != nil {
+				return nil, err
+			}
+			out[name] = conv
+		}
+		return out, nil
+	case *typedef.CounterType:
+		return simpleFromJSON(typedef.TYPE_BIGINT, value)
+	default:
+		return nil, errors.Errorf("unsupported column type %T", t)
+	}
+}
+
+func simpleFromJSON(t typedef.SimpleType, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	str := jsonString(value)
+	switch t {
+	case typedef.TYPE_ASCII, typedef.TYPE_TEXT, typedef.TYPE_VARCHAR, typedef.TYPE_INET, typedef.TYPE_DATE,
+		typedef.TYPE_UUID, typedef.TYPE_TIMEUUID, typedef.TYPE_DURATION:
+		return str, nil
+	case typedef.TYPE_BLOB:
+		return hex.DecodeString(strings.TrimPrefix(strings.ToLower(str), "0x"))
+	case typedef.TYPE_BOOLEAN:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return strings.EqualFold(str, "true"), nil
+	case typedef.TYPE_BIGINT, typedef.TYPE_INT, typedef.TYPE_SMALLINT, typedef.TYPE_TINYINT:
+		n, ok := new(big.Int).SetString(str, 10)
+		if !ok {
+			return nil, errors.Errorf("invalid %s value %q", t, str)
+		}
+		return n.Int64(), nil
+	case typedef.TYPE_VARINT:
+		n, ok := new(big.Int).SetString(str, 10)
+		if !ok {
+			return nil, errors.Errorf("invalid %s value %q", t, str)
+		}
+		return n, nil
+	case typedef.TYPE_DECIMAL:
+		d, ok := new(inf.Dec).SetString(str)
+		if !ok {
+			return nil, errors.Errorf("invalid %s value %q", t, str)
+		}
+		return d, nil
+	case typedef.TYPE_FLOAT, typedef.TYPE_DOUBLE:
+		f, err := json.Number(str).Float64()
+		if err != nil {
+			return nil, err
+		}
+		if t == typedef.TYPE_FLOAT {
+			return float32(f), nil
+		}
+		return f, nil
+	case typedef.TYPE_TIMESTAMP:
+		if n, err := json.Number(str).Int64(); err == nil {
+			return n, nil
+		}
+		return time.Parse(time.RFC3339Nano, str)
+	case typedef.TYPE_TIME:
+		if n, err := json.Number(str).Int64(); err == nil {
+			return n, nil
+		}
+		tm, err := time.Parse("15:04:05.999999999", str)
+		if err != nil {
+			return nil, err
+		}
+		return tm.Sub(time.Date(tm.Year(), tm.Month(), tm.Day(), 0, 0, 0, 0, time.UTC)).Nanoseconds(), nil
+	default:
+		return nil, errors.Errorf("unsupported JSON conversion for type %s", t)
+	}
+}
+
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pkg/errors"
+	"github.com/scylladb/gocqlx/v2/qb"
+
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/routingkey"
+	"github.com/scylladb/gemini/pkg/typedef"
+)
+
+// Resync makes a partition identical on all systems again after a failed
+// mutation left it in an indeterminate state. The partition is read from
+// the oracle, deleted on all systems and its rows are written back to
+// all systems, so that the write times of the cells match too. The cells
+// are written back with the TTL they have left and the statements are
+// journaled like the mutations.
+func (ds delegatingStore) Resync(ctx context.Context, table *typedef.Table, values ...interface{}) error {
+	if !ds.validations {
+		return nil
+	}
+	if table.IsCounterTable() {
+		return errors.Errorf("partitions of the counter table %s can not be re-synchronized", table.Name)
+	}
+	name := table.Name
+	if ds.schema != nil {
+		name = ds.schema.Keyspace.Name + "." + table.Name
+	}
+	keys := make([]qb.Cmp, 0, len(table.PartitionKeys))
+	for _, pk := range table.PartitionKeys {
+		keys = append(keys, qb.Eq(pk.Name))
+	}
+	selectors := append(append(table.PartitionKeys.Names(), table.ClusteringKeys.Names()...), table.Columns.Names()...)
+	for _, col := range table.Columns {
+		if expiringColumn(col) {
+			selectors = append(selectors, "TTL("+col.Name+")", "WRITETIME("+col.Name+")")
+		}
+	}
+	rows, err := loadSet(ds.oracleStore.load(ctx, qb.Select(name).Columns(selectors...).Where(keys...), values))
+	if err != nil {
+		return errors.Wrapf(err, "unable to read the partition from the %s store", ds.oracleStore.name())
+	}
+
+	target := Target{Table: table.Name}
+	if token, hashErr := (&routingkey.Creator{}).GetHash(table, values); hashErr == nil {
+		target.Token, target.HasToken = token, true
+	}
+	ctx = WithTarget(ctx, target)
+	ts := time.Now()
+	if err = ds.resyncMutate(ctx, qb.Delete(name).Where(keys...), ts, values); err != nil {
+		return err
+	}
+	ts = ts.Add(time.Microsecond)
+	for _, row := range rows {
+		for _, w := range resyncWrites(name, table, row) {
+			if err = ds.resyncMutate(ctx, w.builder, ts, w.values); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resyncMutate applies a statement of a re-synchronization to all systems
+// and journals it.
+func (ds delegatingStore) resyncMutate(ctx context.Context, builder qb.Builder, ts time.Time, values []interface{}) error {
+	query, _ := builder.ToCql()
+	e := &journal.Entry{Time: ts, Query: query, Values: values, Test: skipped}
+	defer ds.record(e, targetFrom(ctx))
+	err := mutate(ctx, ds.oracleStore, builder, ts, values...)
+	e.Oracle = journal.NewResult(err)
+	if err != nil {
+		return err
+	}
+	return ds.mutateTests(e, func(s storeLoader) error {
+		return mutate(ctx, s, builder, ts, values...)
+	})
+}
+
+type resyncWrite struct {
+	builder qb.Builder
+	values  []interface{}
+}
+
+// resyncWrites builds the statements writing back a row read from the
+// oracle. The cells whose TTL and write time can not be selected are taken
+// as live cells that do not expire. The row is inserted with the cells that
+// do not expire or, if all of them do, with the ones expiring last so that
+// the row expires with its last cell, the other expiring cells are updated
+// with their own TTL.
+func resyncWrites(name string, table *typedef.Table, row map[string]interface{}) []resyncWrite {
+	byTTL := make(map[int64]typedef.Columns)
+	var maxTTL int64
+	for _, col := range table.Columns {
+		ttl := asInt64(row["ttl("+col.Name+")"])
+		if ttl == 0 && (!expiringColumn(col) || asInt64(row["writetime("+col.Name+")"]) != 0) {
+			maxTTL = -1
+		}
+		if maxTTL >= 0 && ttl > maxTTL {
+			maxTTL = ttl
+		}
+		byTTL[ttl] = append(byTTL[ttl], col)
+	}
+	if maxTTL < 0 {
+		maxTTL = 0
+	}
+	// The null cells were deleted along with the partition.
+	insertCols := byTTL[0]
+	if maxTTL > 0 {
+		insertCols = append(append(typedef.Columns{}, insertCols...), byTTL[maxTTL]...)
+	}
+	builder := qb.Insert(name)
+	var values []interface{}
+	for _, cols := range []typedef.Columns{table.PartitionKeys, table.ClusteringKeys, insertCols} {
+		for _, col := range cols {
+			builder = builder.Columns(col.Name)
+			values = append(values, columnValue(col, row))
+		}
+	}
+	if maxTTL > 0 {
+		builder = builder.TTL(time.Duration(maxTTL) * time.Second)
+	}
+	writes := []resyncWrite{{builder: builder, values: values}}
+
+	ttls := make([]int64, 0, len(byTTL))
+	for ttl := range byTTL {
+		if ttl != 0 && ttl != maxTTL {
+			ttls = append(ttls, ttl)
+		}
+	}
+	sort.Slice(ttls, func(i, j int) bool { return ttls[i] < ttls[j] })
+	for _, ttl := range ttls {
+		update := qb.Update(name).TTL(time.Duration(ttl) * time.Second)
+		var updateValues []interface{}
+		for _, col := range byTTL[ttl] {
+			update = update.Set(col.Name)
+			updateValues = append(updateValues, columnValue(col, row))
+		}
+		for _, cols := range []typedef.Columns{table.PartitionKeys, table.ClusteringKeys} {
+			for _, col := range cols {
+				update = update.Where(qb.Eq(col.Name))
+				updateValues = append(updateValues, columnValue(col, row))
+			}
+		}
+		writes = append(writes, resyncWrite{builder: update, values: updateValues})
+	}
+	return writes
+}
+
+// expiringColumn reports whether the TTL of a column can be selected, which
+// non-frozen collections and counters do not allow.
+func expiringColumn(col *typedef.ColumnDef) bool {
+	if _, ok := col.Type.(*typedef.CounterType); ok {
+		return false
+	}
+	return !isCollection(col.Type)
+}
+
+// columnValue returns the value of a column as read from a row, tuples
+// are returned by the driver as one column per element.
+func columnValue(col *typedef.ColumnDef, row map[string]interface{}) interface{} {
+	tt, ok := col.Type.(*typedef.TupleType)
+	if !ok {
+		return row[col.Name]
+	}
+	elements := make([]interface{}, len(tt.ValueTypes))
+	for i := range tt.ValueTypes {
+		elements[i] = row[gocql.TupleColumnName(col.Name, i)]
+	}
+	return elements
+}
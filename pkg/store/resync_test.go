@@ -0,0 +1,197 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scylladb/gocqlx/v2/qb"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/routingkey"
+)
+
+// failingStore fails every mutation.
+type failingStore struct {
+	fixedStore
+}
+
+func (s *failingStore) mutate(context.Context, qb.Builder, time.Time, ...interface{}) error {
+	return errors.New("timeout")
+}
+
+func TestMutateOracleFailure(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	test := newModelStore(modelTestSchema(), "test")
+	ds := delegatingStore{
+		oracleStore: &failingStore{fixedStore{system: "oracle"}},
+		testStores:  []storeLoader{test},
+		comparer:    defaultComparer,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+	err := ds.Mutate(ctx, qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0"), 1, 1, "a")
+	if !errors.Is(err, ErrOracleMutation) {
+		t.Fatalf("expected an oracle mutation error, got %v", err)
+	}
+	rows, err := loadSet(test.load(ctx, qb.Select("ks1.table1").Where(qb.Eq("pk0")), []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("the mutation must not be applied to the test store, got %v", rows)
+	}
+}
+
+func TestResync(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	table := schema.Tables[0]
+	oracle := newModelStore(schema, "oracle")
+	test := newModelStore(schema, "test")
+	ds := delegatingStore{
+		oracleStore: oracle,
+		testStores:  []storeLoader{test},
+		comparer:    defaultComparer,
+		schema:      schema,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+
+	ts := time.Now()
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0").TupleColumn("col1", 2)
+	for _, values := range [][]interface{}{{1, 1, "a", 10, "b"}, {1, 2, "c", nil, nil}, {2, 1, "d", 20, "e"}} {
+		if err := oracle.mutate(ctx, insert, ts, values...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, values := range [][]interface{}{{1, 1, "x", 10, "b"}, {1, 3, "y", nil, nil}, {2, 1, "d", 20, "e"}} {
+		if err := test.mutate(ctx, insert, ts, values...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := qb.Select("ks1.table1").Columns("pk0", "ck0", "col0", "col1", "WRITETIME(col0)").Where(qb.Eq("pk0"))
+	err := ds.Check(ctx, table, query, 1)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	token, _ := (&routingkey.Creator{}).GetHash(table, []interface{}{1})
+	for _, m := range validationErr.Mismatches {
+		if m.Token != token {
+			t.Errorf("expected mismatch in partition %d, got %d", token, m.Token)
+		}
+	}
+
+	if err = ds.Resync(ctx, table, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, pk := range []int{1, 2} {
+		if err = ds.Check(ctx, table, query, pk); err != nil {
+			t.Errorf("partition %d: %v", pk, err)
+		}
+	}
+	if err = ds.Resync(ctx, schema.Tables[1], 1); err == nil {
+		t.Error("counter tables can not be re-synchronized")
+	}
+}
+
+func TestResyncKeepsTTLs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	table := schema.Tables[0]
+	path := filepath.Join(t.TempDir(), "journal")
+	w, err := journal.Create(path, journal.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oracle := newModelStore(schema, "oracle")
+	test := newModelStore(schema, "test")
+	ds := delegatingStore{
+		oracleStore: oracle,
+		testStores:  []storeLoader{test},
+		comparer:    defaultComparer,
+		schema:      schema,
+		journal:     w,
+		validations: true,
+		logger:      zap.NewNop(),
+	}
+
+	// The first row expires with its only cell, the second one has a cell
+	// that does not expire and one that does.
+	ts := time.Now()
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")
+	if err = oracle.mutate(ctx, insert.TTL(time.Hour), ts, 1, 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = oracle.mutate(ctx, qb.Insert("ks1.table1").Columns("pk0", "ck0").TupleColumn("col1", 2), ts, 1, 2, 10, "b"); err != nil {
+		t.Fatal(err)
+	}
+	update := qb.Update("ks1.table1").TTL(time.Minute).Set("col0").Where(qb.Eq("pk0"), qb.Eq("ck0"))
+	if err = oracle.mutate(ctx, update, ts, "c", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ds.Resync(ctx, table, 1); err != nil {
+		t.Fatal(err)
+	}
+	query := qb.Select("ks1.table1").Columns("pk0", "ck0", "col0", "col1", "TTL(col0)").Where(qb.Eq("pk0"))
+	if err = ds.Check(ctx, table, query, 1); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := loadSet(test.load(ctx, query, []interface{}{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["ttl(col0)"].(int) <= 3500 || rows[1]["ttl(col0)"].(int) <= 50 {
+		t.Fatalf("expected the TTLs to be kept, got %v", rows)
+	}
+
+	// The deletion and the three writes are journaled.
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var entries int
+	for {
+		var e *journal.Entry
+		if e, err = r.Next(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		entries++
+		if e.Oracle.Outcome != journal.Applied || e.Test.Outcome != journal.Applied {
+			t.Errorf("entry %d: expected the statement to be applied, got %+v", entries, e)
+		}
+	}
+	if entries != 4 {
+		t.Errorf("expected 4 entries, got %d", entries)
+	}
+}
@@ -17,33 +17,41 @@ package store
 import (
 	"context"
 	"fmt"
-	"math/big"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/gocql/gocql"
-	"github.com/google/go-cmp/cmp"
-	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/pkg/errors"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/scylladb/go-set/strset"
 	"github.com/scylladb/gocqlx/v2/qb"
 	"go.uber.org/multierr"
-	"gopkg.in/inf.v0"
 
+	"github.com/scylladb/gemini/pkg/joberror"
+	"github.com/scylladb/gemini/pkg/journal"
+	"github.com/scylladb/gemini/pkg/metrics"
+	"github.com/scylladb/gemini/pkg/routingkey"
 	"github.com/scylladb/gemini/pkg/typedef"
 )
 
+// ErrOracleMutation is returned by Mutate when the oracle failed to apply
+// a mutation, which was then not applied to the test system either.
+var ErrOracleMutation = errors.New("oracle failed mutation")
+
+// ErrInvalidRequest is returned when a system rejected a statement as
+// invalid, such as setting a list element at an index the list does not
+// have, the statement is not retried.
+var ErrInvalidRequest = errors.New("invalid request")
+
 type loader interface {
-	load(context.Context, qb.Builder, []interface{}) ([]map[string]interface{}, error)
+	load(context.Context, qb.Builder, []interface{}) rowIterator
 }
 
 type storer interface {
-	mutate(context.Context, qb.Builder, ...interface{}) error
+	mutate(context.Context, qb.Builder, time.Time, ...interface{}) error
 }
 
 type storeLoader interface {
@@ -57,78 +65,131 @@ type Store interface {
 	Create(context.Context, qb.Builder, qb.Builder) error
 	Mutate(context.Context, qb.Builder, ...interface{}) error
 	Check(context.Context, *typedef.Table, qb.Builder, ...interface{}) error
+	Compare(context.Context, *typedef.Table, qb.Builder, ...interface{}) (CompareResult, error)
+	Resync(context.Context, *typedef.Table, ...interface{}) error
+	Replay(context.Context, *journal.Entry) error
 	Close() error
 }
 
+// CompareResult summarizes the comparison of all rows returned by a query.
+type CompareResult struct {
+	// Mismatches holds the details of the first mismatching rows only.
+	Mismatches     []joberror.Mismatch
+	Rows           int
+	MismatchedRows int
+}
+
 type Config struct {
 	MaxRetriesMutate        int
 	MaxRetriesMutateSleep   time.Duration
 	UseServerSideTimestamps bool
+	UseModelOracle          bool
+	PageSize                int
+	Comparators             *ComparatorConfig
+	// ExpiringWrites is set when mutations may write with a TTL, a
+	// validation that failed on data that may expire is then repeated once
+	// the data that may have expired on one system only between the reads
+	// expired on all of them.
+	ExpiringWrites bool
+	// ExpiringCollections is set when the tables with non-frozen
+	// collections may be written with a TTL too.
+	ExpiringCollections bool
+	// VerifyClusteringOrder makes the validation check that both systems
+	// return the rows of queries on the primary key in primary key order.
+	VerifyClusteringOrder bool
+	// Journal records every statement applied to the systems, if set.
+	Journal *journal.Writer
+	// TraceFailures attaches to the errors of the mutations that failed and
+	// of the validations that found mismatches the traces of the statement
+	// run again with tracing on every system, see TracedError.
+	TraceFailures bool
 }
 
-func New(schema *typedef.Schema, testCluster, oracleCluster *gocql.ClusterConfig, cfg Config, traceOut *os.File, logger *zap.Logger) (Store, error) {
-	ops := promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "gemini_cql_requests",
-		Help: "How many CQL requests processed, partitioned by system and CQL query type aka 'method' (batch, delete, insert, update).",
-	}, []string{"system", "method"},
-	)
+// TestCluster is a system under test.
+type TestCluster struct {
+	Cluster *gocql.ClusterConfig
+	// Name is the name of the system in the results, "test" if there is
+	// a single system under test.
+	Name string
+}
+
+// New returns a store mutating the oracle and every system under test and
+// comparing each system under test to the oracle.
+func New(schema *typedef.Schema, testClusters []TestCluster, oracleCluster *gocql.ClusterConfig, cfg Config, traceOut *os.File, logger *zap.Logger) (Store, error) {
+	comparer, err := newComparer(cfg.Comparators)
+	if err != nil {
+		return nil, err
+	}
 
 	var oracleStore storeLoader
 	var validations bool
 	if oracleCluster != nil {
-		oracleSession, err := newSession(oracleCluster, traceOut)
-		if err != nil {
+		var oracleSession *gocql.Session
+		if oracleSession, err = newSession(oracleCluster, traceOut); err != nil {
 			return nil, errors.Wrapf(err, "failed to connect to oracle cluster")
 		}
 		oracleStore = &cqlStore{
 			session:                 oracleSession,
 			schema:                  schema,
 			system:                  "oracle",
-			ops:                     ops,
 			maxRetriesMutate:        cfg.MaxRetriesMutate + 10,
+			pageSize:                cfg.PageSize,
 			maxRetriesMutateSleep:   cfg.MaxRetriesMutateSleep,
 			useServerSideTimestamps: cfg.UseServerSideTimestamps,
 			logger:                  logger,
 		}
 		validations = true
+	} else if cfg.UseModelOracle {
+		oracleStore = newModelStore(schema, "model")
+		validations = true
 	} else {
 		oracleStore = &noOpStore{
 			system: "oracle",
 		}
 	}
 
-	testSession, err := newSession(testCluster, traceOut)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to connect to oracle cluster")
+	ds := &delegatingStore{
+		oracleStore:         oracleStore,
+		schema:              schema,
+		journal:             cfg.Journal,
+		comparer:            comparer,
+		validations:         validations,
+		verifyOrder:         cfg.VerifyClusteringOrder,
+		expiringWrites:      cfg.ExpiringWrites,
+		expiringCollections: cfg.ExpiringCollections,
+		traceFailures:       cfg.TraceFailures,
+		logger:              logger.Named("delegating_store"),
 	}
-
-	return &delegatingStore{
-		testStore: &cqlStore{
+	for _, test := range testClusters {
+		var testSession *gocql.Session
+		if testSession, err = newSession(test.Cluster, traceOut); err != nil {
+			_ = ds.Close()
+			return nil, errors.Wrapf(err, "failed to connect to %s cluster", test.Name)
+		}
+		ds.testStores = append(ds.testStores, &cqlStore{
 			session:                 testSession,
 			schema:                  schema,
-			system:                  "test",
-			ops:                     ops,
+			system:                  test.Name,
 			maxRetriesMutate:        cfg.MaxRetriesMutate,
+			pageSize:                cfg.PageSize,
 			maxRetriesMutateSleep:   cfg.MaxRetriesMutateSleep,
 			useServerSideTimestamps: cfg.UseServerSideTimestamps,
 			logger:                  logger,
-		},
-		oracleStore: oracleStore,
-		validations: validations,
-		logger:      logger.Named("delegating_store"),
-	}, nil
+		})
+	}
+	return ds, nil
 }
 
 type noOpStore struct {
 	system string
 }
 
-func (n *noOpStore) mutate(context.Context, qb.Builder, ...interface{}) error {
+func (n *noOpStore) mutate(context.Context, qb.Builder, time.Time, ...interface{}) error {
 	return nil
 }
 
-func (n *noOpStore) load(context.Context, qb.Builder, []interface{}) ([]map[string]interface{}, error) {
-	return nil, nil
+func (n *noOpStore) load(context.Context, qb.Builder, []interface{}) rowIterator {
+	return &sliceIterator{}
 }
 
 func (n *noOpStore) Close() error {
@@ -145,87 +206,542 @@ func (n *noOpStore) close() error {
 
 type delegatingStore struct {
 	oracleStore storeLoader
-	testStore   storeLoader
 	logger      *zap.Logger
+	comparer    *comparer
+	schema      *typedef.Schema
+	journal     *journal.Writer
+	testStores  []storeLoader
 	validations bool
+	verifyOrder bool
+	// expiringWrites and expiringCollections repeat the failed validations,
+	// see Config.
+	expiringWrites      bool
+	expiringCollections bool
+	// traceFailures runs the statements that failed again with tracing.
+	traceFailures bool
+}
+
+// validates reports whether the results of queries on the table are
+// compared between the systems.
+func (ds delegatingStore) validates(table *typedef.Table) bool {
+	return ds.validations && !ds.comparer.ignoresTable(table.Name)
 }
 
 func (ds delegatingStore) Create(ctx context.Context, testBuilder, oracleBuilder qb.Builder) error {
-	if err := mutate(ctx, ds.oracleStore, oracleBuilder, []interface{}{}); err != nil {
+	ts := time.Now()
+	testQuery, _ := testBuilder.ToCql()
+	oracleQuery, _ := oracleBuilder.ToCql()
+	e := &journal.Entry{Time: ts, Query: testQuery, OracleQuery: oracleQuery, Test: skipped}
+	defer ds.record(e, Target{Schema: true})
+	if err := mutate(ctx, ds.oracleStore, oracleBuilder, ts, []interface{}{}); err != nil {
+		e.Oracle = journal.NewResult(err)
 		return errors.Wrap(err, "oracle failed store creation")
 	}
-	if err := mutate(ctx, ds.testStore, testBuilder, []interface{}{}); err != nil {
+	e.Oracle = journal.NewResult(nil)
+	if err := ds.mutateTests(e, func(s storeLoader) error {
+		return mutate(ctx, s, testBuilder, ts, []interface{}{})
+	}); err != nil {
 		return errors.Wrap(err, "test failed store creation")
 	}
 	return nil
 }
 
 func (ds delegatingStore) Mutate(ctx context.Context, builder qb.Builder, values ...interface{}) error {
-	if err := mutate(ctx, ds.oracleStore, builder, values...); err != nil {
+	builder, repeatable := idempotent(builder)
+	// Both systems write with the same timestamp so that the write times
+	// of the cells can be compared too.
+	ts := time.Now()
+	query, _ := builder.ToCql()
+	e := &journal.Entry{Time: ts, Query: query, Values: values, Test: skipped}
+	defer ds.record(e, targetFrom(ctx))
+	if err := mutate(ctx, ds.oracleStore, builder, ts, values...); err != nil {
+		e.Oracle = journal.NewResult(err)
+		err = fmt.Errorf("%w: %w", ErrOracleMutation, err)
+		if repeatable && !errors.Is(err, ErrInvalidRequest) {
+			// The traced statement may be applied to the systems under
+			// test, the partition is tainted by the failure anyway. An
+			// invalid statement would only be rejected again.
+			err = ds.withTraces(ctx, err, builder, ts, values, false)
+		}
 		// Oracle failed, transition cannot take place
-		ds.logger.Info("oracle failed mutation, transition to next state impossible so continuing with next mutation", zap.Error(err))
+		ds.logger.Info("oracle failed mutation, transition to next state impossible so continuing with next mutation",
+			zap.Error(err), zap.Any("traces", traces(err)))
+		return err
+	}
+	e.Oracle = journal.NewResult(nil)
+	err := ds.mutateTests(e, func(s storeLoader) error {
+		return mutate(ctx, s, builder, ts, values...)
+	})
+	if !repeatable {
+		return err
+	}
+	return ds.withTraces(ctx, err, builder, ts, values, false)
+}
+
+// mutateTests applies a statement to every system under test and records
+// the result on each of them in the journal entry.
+func (ds delegatingStore) mutateTests(e *journal.Entry, apply func(storeLoader) error) error {
+	errs := make(map[string]error)
+	e.Test = journal.NewResult(nil)
+	if len(ds.testStores) > 1 {
+		e.Tests = make(map[string]journal.Result, len(ds.testStores))
+	}
+	for _, s := range ds.testStores {
+		err := apply(s)
+		if err != nil {
+			errs[s.name()] = err
+			if e.Test.Outcome != journal.Failed {
+				e.Test = journal.NewResult(err)
+			}
+		}
+		if e.Tests != nil {
+			e.Tests[s.name()] = journal.NewResult(err)
+		}
+	}
+	return ds.systemsError(errs)
+}
+
+// systemsError returns the errors of the systems under test, as they are
+// if there is a single system under test.
+func (ds delegatingStore) systemsError(errs map[string]error) error {
+	if len(errs) == 0 {
 		return nil
 	}
-	return mutate(ctx, ds.testStore, builder, values...)
+	if len(ds.testStores) == 1 {
+		for _, err := range errs {
+			return err
+		}
+	}
+	return SystemErrors(errs)
 }
 
-func mutate(ctx context.Context, s storeLoader, builder qb.Builder, values ...interface{}) error {
-	if err := s.mutate(ctx, builder, values...); err != nil {
+// SystemErrors are the errors of the systems under test that failed an
+// operation, by name, when there are several systems under test.
+type SystemErrors map[string]error
+
+func (e SystemErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(e))
+	for _, name := range names {
+		msgs = append(msgs, name+": "+e[name].Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of all the systems under test.
+func (e SystemErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func mutate(ctx context.Context, s storeLoader, builder qb.Builder, ts time.Time, values ...interface{}) error {
+	if err := s.mutate(ctx, builder, ts, values...); err != nil {
 		return errors.Wrapf(err, "unable to apply mutations to the %s store", s.name())
 	}
 	return nil
 }
 
 func (ds delegatingStore) Check(ctx context.Context, table *typedef.Table, builder qb.Builder, values ...interface{}) error {
-	testRows, err := ds.testStore.load(ctx, builder, values)
+	err := ds.check(ctx, table, builder, values...)
+	var validationErr *ValidationError
+	if ds.mayHaveExpired(table, validationMismatches(err)) {
+		if err = ds.waitExpiry(ctx); err != nil {
+			return err
+		}
+		err = ds.check(ctx, table, builder, values...)
+	}
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+	if ds.journal != nil {
+		// Failed validations are journaled for 'gemini minimize'.
+		query, _ := builder.ToCql()
+		ds.record(&journal.Entry{Time: time.Now(), Query: query, Values: values, Check: true}, Target{Table: table.Name})
+	}
+	return ds.withTraces(ctx, err, builder, time.Time{}, values, true)
+}
+
+// check compares the result of the query on each system under test to the
+// one on the oracle, which is read again for each of them.
+func (ds delegatingStore) check(ctx context.Context, table *typedef.Table, builder qb.Builder, values ...interface{}) error {
+	errs := make(map[string]error)
+	sets := !ds.validates(table) || !keyOrdered(table, builder, values)
+	for _, test := range ds.testStores {
+		testIter, oracleIter, err := ds.loadBoth(ctx, test, builder, values, sets)
+		switch {
+		case err != nil:
+		case sets:
+			err = ds.checkSets(table, test, testIter, oracleIter)
+		default:
+			err = ds.checkOrdered(table, test, testIter, oracleIter)
+		}
+		if err != nil {
+			errs[test.name()] = err
+		}
+	}
+	return ds.systemsError(errs)
+}
+
+// loadBoth runs the query on the system under test and on the oracle
+// concurrently, so that a validation waits for the slowest of the two
+// reads instead of both of them. If full is set the results are loaded
+// completely, otherwise the iterators are returned once the first page of
+// each result is. The latency of each read is recorded by system.
+func (ds delegatingStore) loadBoth(
+	ctx context.Context, test storeLoader, builder qb.Builder, values []interface{}, full bool,
+) (testIter, oracleIter rowIterator, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	load := func(s storeLoader, out chan<- rowIterator) {
+		start := time.Now()
+		iter := s.load(ctx, builder, values)
+		if full {
+			rows, loadErr := loadSet(iter)
+			iter = &sliceIterator{rows: rows, err: loadErr}
+		}
+		metrics.CheckReadLatency.WithLabelValues(s.name()).Observe(time.Since(start).Seconds())
+		out <- iter
+	}
+	testCh, oracleCh := make(chan rowIterator, 1), make(chan rowIterator, 1)
+	go load(test, testCh)
+	go load(ds.oracleStore, oracleCh)
+	for testIter == nil || oracleIter == nil {
+		select {
+		case testIter = <-testCh:
+		case oracleIter = <-oracleCh:
+		case <-ctx.Done():
+			// The reads are canceled with the context too, their
+			// iterators are closed once they returned.
+			go func(testIter, oracleIter rowIterator) {
+				if testIter == nil {
+					testIter = <-testCh
+				}
+				if oracleIter == nil {
+					oracleIter = <-oracleCh
+				}
+				_, _ = testIter.close(), oracleIter.close()
+			}(testIter, oracleIter)
+			return nil, nil, ctx.Err()
+		}
+	}
+	return testIter, oracleIter, nil
+}
+
+// checkSets loads both results completely and compares them as sets of rows.
+func (ds delegatingStore) checkSets(table *typedef.Table, test storeLoader, testIter, oracleIter rowIterator) error {
+	testRows, err := loadSet(testIter)
 	if err != nil {
-		return errors.Wrapf(err, "unable to load check data from the test store")
+		_ = oracleIter.close()
+		return errors.Wrapf(err, "unable to load check data from the %s store", test.name())
 	}
-	oracleRows, err := ds.oracleStore.load(ctx, builder, values)
+	oracleRows, err := loadSet(oracleIter)
 	if err != nil {
 		return errors.Wrapf(err, "unable to load check data from the oracle store")
 	}
-	if !ds.validations {
+	if !ds.validates(table) {
 		return nil
 	}
 	if len(testRows) == 0 && len(oracleRows) == 0 {
 		return nil
 	}
+	sortRows(table, testRows)
+	sortRows(table, oracleRows)
+	mismatches := ds.attribute(test, ds.comparer.diffRows(table, oracleRows, testRows))
+	if len(mismatches) == 0 {
+		return nil
+	}
 	if len(testRows) != len(oracleRows) {
 		testSet := strset.New(pks(table, testRows)...)
 		oracleSet := strset.New(pks(table, oracleRows)...)
 		missingInTest := strset.Difference(oracleSet, testSet).List()
 		missingInOracle := strset.Difference(testSet, oracleSet).List()
-		return fmt.Errorf("row count differ (test has %d rows, oracle has %d rows, test is missing rows: %s, oracle is missing rows: %s)",
-			len(testRows), len(oracleRows), missingInTest, missingInOracle)
+		return &ValidationError{
+			Message: fmt.Sprintf("row count differ (test has %d rows, oracle has %d rows, test is missing rows: %s, oracle is missing rows: %s)",
+				len(testRows), len(oracleRows), missingInTest, missingInOracle),
+			Mismatches: mismatches,
+		}
 	}
-	sort.SliceStable(testRows, func(i, j int) bool {
-		return lt(testRows[i], testRows[j])
-	})
-	sort.SliceStable(oracleRows, func(i, j int) bool {
-		return lt(oracleRows[i], oracleRows[j])
-	})
-	for i, oracleRow := range oracleRows {
-		testRow := testRows[i]
-		cmp.AllowUnexported()
-		diff := cmp.Diff(oracleRow, testRow,
-			cmpopts.SortMaps(func(x, y *inf.Dec) bool {
-				return x.Cmp(y) < 0
-			}),
-			cmp.Comparer(func(x, y *inf.Dec) bool {
-				return x.Cmp(y) == 0
-			}), cmp.Comparer(func(x, y *big.Int) bool {
-				return x.Cmp(y) == 0
-			}))
-		if diff != "" {
-			return fmt.Errorf("rows differ (-%v +%v): %v", oracleRow, testRow, diff)
+	return &ValidationError{
+		Message:    fmt.Sprintf("rows differ (%d mismatches): %s", len(mismatches), mismatchesMessage(mismatches)),
+		Mismatches: mismatches,
+	}
+}
+
+// Compare reads the rows selected by a query that returns them in primary
+// key order, such as a token range of a table or view, from both systems
+// and compares all of them.
+// With several systems under test the rows compared are counted once and
+// the mismatched rows of each system are summed.
+func (ds delegatingStore) Compare(ctx context.Context, table *typedef.Table, builder qb.Builder, values ...interface{}) (CompareResult, error) {
+	result, err := ds.compare(ctx, table, builder, values...)
+	if err == nil && ds.mayHaveExpired(table, result.Mismatches) {
+		if err = ds.waitExpiry(ctx); err != nil {
+			return result, err
+		}
+		return ds.compare(ctx, table, builder, values...)
+	}
+	return result, err
+}
+
+func (ds delegatingStore) compare(ctx context.Context, table *typedef.Table, builder qb.Builder, values ...interface{}) (CompareResult, error) {
+	var result CompareResult
+	errs := make(map[string]error)
+	for _, test := range ds.testStores {
+		testIter, oracleIter, err := ds.loadBoth(ctx, test, builder, values, !ds.validates(table))
+		if err != nil {
+			errs[test.name()] = err
+			continue
+		}
+		if !ds.validates(table) {
+			if err = ds.checkSets(table, test, testIter, oracleIter); err != nil {
+				errs[test.name()] = err
+			}
+			continue
+		}
+		r, err := ds.compareOrdered(table, test, testIter, oracleIter, false)
+		if err != nil {
+			errs[test.name()] = err
+			continue
+		}
+		if r.Rows > result.Rows {
+			result.Rows = r.Rows
+		}
+		result.MismatchedRows += r.MismatchedRows
+		if len(result.Mismatches) < maxStoredMismatches {
+			result.Mismatches = append(result.Mismatches, r.Mismatches...)
+		}
+	}
+	return result, ds.systemsError(errs)
+}
+
+// mayHaveExpired reports whether the mismatches may be data that expired on
+// one system only between the reads: cells with a TTL, or rows missing or
+// extra in a table written with TTLs.
+func (ds delegatingStore) mayHaveExpired(table *typedef.Table, mismatches []joberror.Mismatch) bool {
+	if !ds.expiringTable(table) {
+		return false
+	}
+	for _, m := range mismatches {
+		switch m.Kind {
+		case joberror.DifferingCell:
+			if m.Expiring {
+				return true
+			}
+		case joberror.MissingRow, joberror.ExtraRow:
+			return true
+		}
+	}
+	return false
+}
+
+// expiringTable reports whether the rows of a table may be written with a
+// TTL, which gemini does not do for counter tables, nor for tables with
+// non-frozen collections unless expiringCollections is set.
+func (ds delegatingStore) expiringTable(table *typedef.Table) bool {
+	return ds.expiringWrites && !table.IsCounterTable() && (ds.expiringCollections || len(table.Columns.Collections()) == 0)
+}
+
+// validationMismatches returns the mismatches of the validation errors of
+// every system under test.
+func validationMismatches(err error) []joberror.Mismatch {
+	var systemErrs SystemErrors
+	if errors.As(err, &systemErrs) {
+		var mismatches []joberror.Mismatch
+		for _, systemErr := range systemErrs {
+			mismatches = append(mismatches, validationMismatches(systemErr)...)
 		}
+		return mismatches
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Mismatches
 	}
 	return nil
 }
 
+// waitExpiry waits until the cells that expired on a system when it was
+// read expired on every system, given the drift of their TTLs.
+func (ds delegatingStore) waitExpiry(ctx context.Context) error {
+	timer := time.NewTimer(maxTTLDrift * time.Second)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// attribute sets the system under test the mismatches were found on, if
+// there are several of them.
+func (ds delegatingStore) attribute(test storeLoader, mismatches []joberror.Mismatch) []joberror.Mismatch {
+	if len(ds.testStores) > 1 {
+		for i := range mismatches {
+			if mismatches[i].System == "" {
+				mismatches[i].System = test.name()
+			}
+		}
+	}
+	return mismatches
+}
+
+// checkOrdered stops at the first row that differs.
+func (ds delegatingStore) checkOrdered(table *typedef.Table, test storeLoader, testIter, oracleIter rowIterator) error {
+	result, err := ds.compareOrdered(table, test, testIter, oracleIter, true)
+	if err != nil || len(result.Mismatches) == 0 {
+		return err
+	}
+	return &ValidationError{
+		Message:    fmt.Sprintf("rows differ (%d mismatches): %s", len(result.Mismatches), mismatchesMessage(result.Mismatches)),
+		Mismatches: result.Mismatches,
+	}
+}
+
+// compareOrdered walks both results page by page in primary key order,
+// so only a page of each result is held in memory at a time.
+func (ds delegatingStore) compareOrdered(
+	table *typedef.Table, test storeLoader, testIter, oracleIter rowIterator, stopAtFirst bool,
+) (result CompareResult, err error) {
+	keyCreator := &routingkey.Creator{}
+	testRows := &orderedRows{iter: testIter}
+	oracleRows := &orderedRows{iter: oracleIter}
+	if ds.verifyOrder {
+		testRows.order = &orderCheck{table: table, keyCreator: keyCreator, system: test.name()}
+		oracleRows.order = &orderCheck{table: table, keyCreator: keyCreator, system: ds.oracleStore.name()}
+	}
+	defer func() {
+		testErr, oracleErr := testRows.close(), oracleRows.close()
+		switch {
+		case testErr != nil:
+			err = errors.Wrapf(testErr, "unable to load check data from the %s store", test.name())
+		case oracleErr != nil:
+			err = errors.Wrapf(oracleErr, "unable to load check data from the oracle store")
+		}
+	}()
+	testRow, oracleRow := testRows.next(), oracleRows.next()
+	for testRow != nil || oracleRow != nil {
+		var mismatches []joberror.Mismatch
+		switch c := compareRowKeys(table, keyCreator, oracleRow, testRow); {
+		case c == 0:
+			mismatches = ds.comparer.diffCells(table, oracleRow, testRow)
+			testRow, oracleRow = testRows.next(), oracleRows.next()
+		case c < 0:
+			mismatches = []joberror.Mismatch{{
+				Kind:       joberror.MissingRow,
+				PrimaryKey: primaryKey(table, oracleRow),
+				Token:      uint64(rowToken(table, keyCreator, oracleRow)),
+			}}
+			oracleRow = oracleRows.next()
+		default:
+			mismatches = []joberror.Mismatch{{
+				Kind:       joberror.ExtraRow,
+				PrimaryKey: primaryKey(table, testRow),
+				Token:      uint64(rowToken(table, keyCreator, testRow)),
+			}}
+			testRow = testRows.next()
+		}
+		mismatches = append(mismatches, oracleRows.disorder()...)
+		mismatches = append(mismatches, testRows.disorder()...)
+		result.Rows++
+		if len(mismatches) == 0 {
+			continue
+		}
+		if testRows.err() != nil || oracleRows.err() != nil {
+			// A row is missing because the query failed, the deferred
+			// function reports the error instead.
+			return result, nil
+		}
+		result.MismatchedRows++
+		if len(result.Mismatches) < maxStoredMismatches {
+			result.Mismatches = append(result.Mismatches, ds.attribute(test, mismatches)...)
+		}
+		if stopAtFirst {
+			return result, nil
+		}
+	}
+	return result, nil
+}
+
+// orderedRows closes the underlying iterator as soon as it is exhausted,
+// so that a failed query is not mistaken for missing rows.
+type orderedRows struct {
+	iter     rowIterator
+	closeErr error
+	order    *orderCheck
+	closed   bool
+}
+
+// orderCheck records the rows returned out of primary key order, the rows
+// are not re-sorted so that ordering bugs are not masked.
+type orderCheck struct {
+	table      *typedef.Table
+	keyCreator *routingkey.Creator
+	last       map[string]interface{}
+	system     string
+	mismatches []joberror.Mismatch
+}
+
+func (o *orderedRows) next() map[string]interface{} {
+	if o.closed {
+		return nil
+	}
+	row, ok := o.iter.next()
+	if !ok {
+		_ = o.close()
+		return nil
+	}
+	if o.order != nil {
+		o.order.check(row)
+	}
+	return row
+}
+
+// disorder returns the rows found out of order since the previous call.
+func (o *orderedRows) disorder() []joberror.Mismatch {
+	if o.order == nil || len(o.order.mismatches) == 0 {
+		return nil
+	}
+	mismatches := o.order.mismatches
+	o.order.mismatches = nil
+	return mismatches
+}
+
+func (c *orderCheck) check(row map[string]interface{}) {
+	if c.last != nil && compareRowKeys(c.table, c.keyCreator, c.last, row) >= 0 {
+		c.mismatches = append(c.mismatches, joberror.Mismatch{
+			Kind:       joberror.OutOfOrderRow,
+			PrimaryKey: primaryKey(c.table, row),
+			Token:      uint64(rowToken(c.table, c.keyCreator, row)),
+			System:     c.system,
+		})
+	}
+	c.last = row
+}
+
+func (o *orderedRows) err() error {
+	return o.closeErr
+}
+
+func (o *orderedRows) close() error {
+	if !o.closed {
+		o.closed = true
+		o.closeErr = o.iter.close()
+	}
+	return o.closeErr
+}
+
 func (ds delegatingStore) Close() (err error) {
-	err = multierr.Append(err, ds.testStore.close())
+	for _, test := range ds.testStores {
+		err = multierr.Append(err, test.close())
+	}
 	err = multierr.Append(err, ds.oracleStore.close())
 	return
 }
@@ -0,0 +1,184 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/pkg/errors"
+	"github.com/scylladb/gocqlx/v2/qb"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/joberror"
+)
+
+const (
+	// traceWaitAttempts and traceWaitDelay bound the wait for a traced
+	// session to be completely written to system_traces.
+	traceWaitAttempts = 20
+	traceWaitDelay    = 100 * time.Millisecond
+)
+
+// TracedError is the error of a statement that failed, or whose validation
+// found mismatches, with the traces of the statement run again on every
+// system with tracing enabled.
+type TracedError struct {
+	Err    error
+	Traces []joberror.Trace
+}
+
+func (e *TracedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TracedError) Unwrap() error {
+	return e.Err
+}
+
+// tracer is implemented by the stores that can run a statement again with
+// tracing enabled.
+type tracer interface {
+	// trace runs the statement, a mutation with the timestamp ts or a
+	// query whose first page is read, and returns its traces.
+	trace(ctx context.Context, builder qb.Builder, ts time.Time, values []interface{}, query bool) []joberror.Trace
+}
+
+// NotIdempotent marks a mutation that changes the data again when it is
+// applied again with the same timestamp, such as a counter update or a list
+// append, so that it is not run again to be traced.
+func NotIdempotent(builder qb.Builder) qb.Builder {
+	return notIdempotent{Builder: builder}
+}
+
+type notIdempotent struct {
+	qb.Builder
+}
+
+// idempotent returns the builder of a mutation, unwrapped if it was marked
+// with NotIdempotent, and whether it can be applied again.
+func idempotent(builder qb.Builder) (qb.Builder, bool) {
+	if b, ok := builder.(notIdempotent); ok {
+		return b.Builder, false
+	}
+	return builder, true
+}
+
+// withTraces runs the statement that failed with err again on the oracle and
+// on every system under test and returns err with their traces.
+func (ds delegatingStore) withTraces(
+	ctx context.Context, err error, builder qb.Builder, ts time.Time, values []interface{}, query bool,
+) error {
+	if !ds.traceFailures || err == nil || ctx.Err() != nil {
+		return err
+	}
+	var traces []joberror.Trace
+	for _, s := range append([]storeLoader{ds.oracleStore}, ds.testStores...) {
+		if t, ok := s.(tracer); ok {
+			traces = append(traces, t.trace(ctx, builder, ts, values, query)...)
+		}
+	}
+	if len(traces) == 0 {
+		return err
+	}
+	return &TracedError{Err: err, Traces: traces}
+}
+
+// traces returns the traces attached to an error by withTraces, if any.
+func traces(err error) []joberror.Trace {
+	var traced *TracedError
+	if errors.As(err, &traced) {
+		return traced.Traces
+	}
+	return nil
+}
+
+// traceIDs collects the sessions of a traced statement, one per request.
+type traceIDs struct {
+	ids [][]byte
+	mu  sync.Mutex
+}
+
+func (t *traceIDs) Trace(traceID []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ids = append(t.ids, traceID)
+}
+
+func (cs *cqlStore) trace(ctx context.Context, builder qb.Builder, ts time.Time, values []interface{}, query bool) []joberror.Trace {
+	stmt, _ := builder.ToCql()
+	ids := &traceIDs{}
+	q := cs.session.Query(stmt, values...).WithContext(ctx).Trace(ids)
+	var err error
+	if query {
+		// Only the first page is requested.
+		err = q.Iter().Close()
+	} else {
+		if cs.useServerSideTimestamps {
+			q = q.DefaultTimestamp(false)
+		} else {
+			q = q.WithTimestamp(ts.UnixMicro())
+		}
+		err = q.Exec()
+	}
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	traces := make([]joberror.Trace, 0, len(ids.ids))
+	for _, id := range ids.ids {
+		t := cs.readTrace(ctx, id)
+		if err != nil {
+			t.Error = err.Error()
+		}
+		traces = append(traces, t)
+	}
+	return traces
+}
+
+// readTrace reads a traced session once its coordinator wrote its duration,
+// or after traceWaitAttempts.
+func (cs *cqlStore) readTrace(ctx context.Context, id []byte) joberror.Trace {
+	t := joberror.Trace{System: cs.system}
+	if uuid, err := gocql.UUIDFromBytes(id); err == nil {
+		t.SessionID = uuid.String()
+	}
+	for i := 0; i < traceWaitAttempts && t.Duration == 0; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return t
+			case <-time.After(traceWaitDelay):
+			}
+		}
+		iter := cs.session.Query("SELECT coordinator, duration FROM system_traces.sessions WHERE session_id = ?", id).
+			WithContext(ctx).Consistency(gocql.One).Iter()
+		iter.Scan(&t.Coordinator, &t.Duration)
+		if err := iter.Close(); err != nil {
+			cs.logger.Debug("unable to read trace session", zap.String("session", t.SessionID), zap.Error(err))
+			return t
+		}
+	}
+	iter := cs.session.Query("SELECT event_id, activity, source, source_elapsed, thread FROM system_traces.events WHERE session_id = ?", id).
+		WithContext(ctx).Consistency(gocql.One).Iter()
+	var e joberror.TraceEvent
+	for iter.Scan(&e.Time, &e.Activity, &e.Source, &e.Elapsed, &e.Thread) {
+		t.Events = append(t.Events, e)
+	}
+	if err := iter.Close(); err != nil {
+		cs.logger.Debug("unable to read trace events", zap.String("session", t.SessionID), zap.Error(err))
+	}
+	return t
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/scylladb/gocqlx/v2/qb"
+	"go.uber.org/zap"
+
+	"github.com/scylladb/gemini/pkg/joberror"
+)
+
+// tracingStore wraps a store with a tracer recording the statements it
+// traced.
+type tracingStore struct {
+	storeLoader
+	traced []string
+}
+
+func (s *tracingStore) trace(_ context.Context, builder qb.Builder, _ time.Time, _ []interface{}, query bool) []joberror.Trace {
+	stmt, _ := builder.ToCql()
+	s.traced = append(s.traced, stmt)
+	return []joberror.Trace{{System: s.name(), SessionID: stmt, Duration: 1}}
+}
+
+func TestTraceFailures(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	schema := modelTestSchema()
+	oracle := &tracingStore{storeLoader: newModelStore(schema, "oracle")}
+	test := &tracingStore{storeLoader: &failingStore{fixedStore{system: "test"}}}
+	ds := delegatingStore{
+		oracleStore:   oracle,
+		testStores:    []storeLoader{test},
+		comparer:      defaultComparer,
+		validations:   true,
+		traceFailures: true,
+		logger:        zap.NewNop(),
+	}
+
+	insert := qb.Insert("ks1.table1").Columns("pk0", "ck0", "col0")
+	err := ds.Mutate(ctx, insert, 1, 1, "a")
+	var traced *TracedError
+	if !errors.As(err, &traced) {
+		t.Fatalf("expected a traced error, got %v", err)
+	}
+	stmt, _ := insert.ToCql()
+	expected := []joberror.Trace{{System: "oracle", SessionID: stmt, Duration: 1}, {System: "test", SessionID: stmt, Duration: 1}}
+	if diff := cmp.Diff(expected, traced.Traces); diff != "" {
+		t.Error(diff)
+	}
+
+	// Counter updates are not applied twice.
+	err = ds.Mutate(ctx, NotIdempotent(qb.Update("ks1.table2").Add("col0").Where(qb.Eq("pk0"))), int64(1), 1)
+	if err == nil || errors.Is(err, ErrOracleMutation) || errors.As(err, &traced) {
+		t.Fatalf("expected an error without traces, got %v", err)
+	}
+
+	// Validations are only traced if they found mismatches.
+	query := qb.Select("ks1.table1").Where(qb.Eq("pk0"))
+	test.storeLoader = &fixedStore{system: "test"}
+	if err = ds.Check(ctx, schema.Tables[0], query, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err = ds.Check(ctx, schema.Tables[0], query, 1); !errors.As(err, &traced) || len(traced.Traces) != 2 {
+		t.Fatalf("expected a traced validation error, got %v", err)
+	}
+	if len(oracle.traced) != 2 || len(test.traced) != 2 {
+		t.Errorf("expected the insert and the query to be traced, got %v and %v", oracle.traced, test.traced)
+	}
+
+	// Mutations failing on the oracle are traced too.
+	ds.oracleStore = &tracingStore{storeLoader: &failingStore{fixedStore{system: "oracle"}}}
+	err = ds.Mutate(ctx, insert, 1, 1, "a")
+	if !errors.Is(err, ErrOracleMutation) || !errors.As(err, &traced) || len(traced.Traces) != 2 {
+		t.Fatalf("expected a traced oracle error, got %v", err)
+	}
+}
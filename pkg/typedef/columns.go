@@ -146,6 +146,47 @@ func (c Columns) NonCounters() Columns {
 	return out
 }
 
+// Collections returns the non-frozen list, set and map columns, whose
+// elements can be updated.
+func (c Columns) Collections() Columns {
+	out := make(Columns, 0, len(c))
+	for _, col := range c {
+		switch t := col.Type.(type) {
+		case *BagType:
+			if !t.Frozen {
+				out = append(out, col)
+			}
+		case *MapType:
+			if !t.Frozen {
+				out = append(out, col)
+			}
+		}
+	}
+	return out
+}
+
+// Lists returns the non-frozen list columns.
+func (c Columns) Lists() Columns {
+	out := make(Columns, 0, len(c))
+	for _, col := range c.Collections() {
+		if t, ok := col.Type.(*BagType); ok && t.ComplexType == TYPE_LIST {
+			out = append(out, col)
+		}
+	}
+	return out
+}
+
+// Maps returns the non-frozen map columns.
+func (c Columns) Maps() Columns {
+	out := make(Columns, 0, len(c))
+	for _, col := range c.Collections() {
+		if _, ok := col.Type.(*MapType); ok {
+			out = append(out, col)
+		}
+	}
+	return out
+}
+
 func GetMapTypeColumn(data map[string]interface{}) (out *ColumnDef, err error) {
 	st := struct {
 		Type map[string]interface{}
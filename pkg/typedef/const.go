@@ -36,6 +36,11 @@ const (
 	AlterColumnStatementType
 	DropColumnStatementType
 	AddColumnStatementType
+	BatchStatementType
+	DeletePartitionStatementType
+	DeleteRowStatementType
+	DeleteRangeStatementType
+	DeleteColumnsStatementType
 )
 
 //nolint:revive
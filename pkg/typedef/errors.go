@@ -20,4 +20,5 @@ var (
 	ErrSchemaConfigInvalidRangePK   = errors.New("max number of partition keys must be bigger than min number of partition keys")
 	ErrSchemaConfigInvalidRangeCK   = errors.New("max number of clustering keys must be bigger than min number of clustering keys")
 	ErrSchemaConfigInvalidRangeCols = errors.New("max number of columns must be bigger than min number of columns")
+	ErrSchemaConfigInvalidTTL       = errors.New("ttl ratio must be between 0 and 1 and max ttl at least 1s when it is not 0")
 )
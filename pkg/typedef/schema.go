@@ -31,6 +31,23 @@ func (m *MaterializedView) HaveNonPrimaryKey() bool {
 	return m.NonPrimaryKey != nil
 }
 
+// AsTable describes the rows of the view as a table, with the primary key
+// of the view and the remaining columns of the base table.
+func (m *MaterializedView) AsTable(base *Table) *Table {
+	columns := make(Columns, 0, len(base.Columns))
+	for _, c := range base.Columns {
+		if m.NonPrimaryKey == nil || c.Name != m.NonPrimaryKey.Name {
+			columns = append(columns, c)
+		}
+	}
+	return &Table{
+		Name:           m.Name,
+		PartitionKeys:  m.PartitionKeys,
+		ClusteringKeys: m.ClusteringKeys,
+		Columns:        columns,
+	}
+}
+
 func (m *MaterializedView) PartitionKeysLenValues() int {
 	if m.partitionKeysLenValues == 0 && m.PartitionKeys != nil {
 		m.partitionKeysLenValues = m.PartitionKeys.LenValues()
@@ -17,6 +17,7 @@ package typedef
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -84,6 +85,31 @@ func TestSchemaConfigValidate(t *testing.T) {
 			},
 			want: ErrSchemaConfigInvalidRangeCols,
 		},
+		"ttl_ratio_gt_than_1": {
+			config: &SchemaConfig{
+				MaxPartitionKeys:  3,
+				MinPartitionKeys:  2,
+				MaxClusteringKeys: 3,
+				MinClusteringKeys: 2,
+				MaxColumns:        3,
+				MinColumns:        2,
+				TTLRatio:          1.5,
+				MaxTTL:            time.Minute,
+			},
+			want: ErrSchemaConfigInvalidTTL,
+		},
+		"max_ttl_missing": {
+			config: &SchemaConfig{
+				MaxPartitionKeys:  3,
+				MinPartitionKeys:  2,
+				MaxClusteringKeys: 3,
+				MinClusteringKeys: 2,
+				MaxColumns:        3,
+				MinColumns:        2,
+				TTLRatio:          0.1,
+			},
+			want: ErrSchemaConfigInvalidTTL,
+		},
 	}
 	cmp.AllowUnexported()
 	for name, test := range tests {
@@ -19,12 +19,14 @@ import (
 
 	"github.com/scylladb/gemini/pkg/replication"
 	"github.com/scylladb/gemini/pkg/tableopts"
+	"github.com/scylladb/gemini/pkg/workload"
 )
 
 type SchemaConfig struct {
 	ReplicationStrategy              *replication.Replication
 	OracleReplicationStrategy        *replication.Replication
 	TableOptions                     []tableopts.Option
+	Workload                         *workload.Profile
 	MaxTables                        int
 	MaxPartitionKeys                 int
 	MinPartitionKeys                 int
@@ -38,8 +40,13 @@ type SchemaConfig struct {
 	MaxStringLength                  int
 	MinBlobLength                    int
 	MinStringLength                  int
+	TTLRatio                         float64
+	MaxTTL                           time.Duration
+	ExpiringCollections              bool
 	UseCounters                      bool
 	UseLWT                           bool
+	CheckWriteTimes                  bool
+	ResyncTaintedPartitions          bool
 	CQLFeature                       CQLFeature
 	AsyncObjectStabilizationAttempts int
 	AsyncObjectStabilizationDelay    time.Duration
@@ -55,6 +62,9 @@ func (sc *SchemaConfig) Valid() error {
 	if sc.MaxColumns <= sc.MinColumns {
 		return ErrSchemaConfigInvalidRangeCols
 	}
+	if sc.TTLRatio < 0 || sc.TTLRatio > 1 || (sc.TTLRatio > 0 && sc.MaxTTL < time.Second) {
+		return ErrSchemaConfigInvalidTTL
+	}
 	return nil
 }
 
@@ -16,10 +16,12 @@ package typedef
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/scylladb/gocqlx/v2/qb"
 
 	"github.com/scylladb/gemini/pkg/replication"
+	"github.com/scylladb/gemini/pkg/workload"
 )
 
 type (
@@ -40,11 +42,21 @@ type (
 	}
 
 	PartitionRangeConfig struct {
-		MaxBlobLength   int
-		MinBlobLength   int
-		MaxStringLength int
-		MinStringLength int
-		UseLWT          bool
+		// Workload weights the kinds of statements, the default profile
+		// if it is nil.
+		Workload *workload.Profile
+		// TTLRatio is the fraction of the inserts and updates written
+		// with a TTL of up to MaxTTL, of the tables with non-frozen
+		// collections only if ExpiringCollections is set.
+		TTLRatio            float64
+		MaxTTL              time.Duration
+		ExpiringCollections bool
+		MaxBlobLength       int
+		MinBlobLength       int
+		MaxStringLength     int
+		MinStringLength     int
+		UseLWT              bool
+		CheckWriteTimes     bool
 	}
 
 	CQLFeature int
@@ -60,13 +72,40 @@ type StmtCache struct {
 	Query     qb.Builder
 	Types     Types
 	QueryType StatementType
-	LenValue  int
+	// NotIdempotent is set for the mutations that change the data again
+	// when they are applied again with the same timestamp, counter updates
+	// and list appends and prepends.
+	NotIdempotent bool
+	LenValue      int
 }
 
 type Stmt struct {
 	*StmtCache
 	ValuesWithToken *ValueWithToken
-	Values          Values
+	// OtherValuesWithToken are the other partitions of a statement writing
+	// to several partitions, such as a logged batch.
+	OtherValuesWithToken []*ValueWithToken
+	Values               Values
+	// ListRow is the row the statement leaves with elements in all its
+	// non-frozen lists, nil if there is no such row.
+	ListRow *ListRow
+}
+
+// ListRow is a row known to hold elements in all its non-frozen lists, the
+// elements of which can be set by their index.
+type ListRow struct {
+	Partition  *ValueWithToken
+	Clustering Values
+	// Lengths are the numbers of elements of the lists by column name.
+	Lengths map[string]int
+}
+
+// Partitions returns the partitions the statement writes to or reads.
+func (s *Stmt) Partitions() []*ValueWithToken {
+	if s.ValuesWithToken == nil {
+		return nil
+	}
+	return append([]*ValueWithToken{s.ValuesWithToken}, s.OtherValuesWithToken...)
 }
 
 func (s *Stmt) PrettyCQL() string {
@@ -113,6 +152,16 @@ func (st StatementType) ToString() string {
 		return "DropColumnStatement"
 	case AddColumnStatementType:
 		return "AddColumnStatement"
+	case BatchStatementType:
+		return "BatchStatement"
+	case DeletePartitionStatementType:
+		return "DeletePartitionStatement"
+	case DeleteRowStatementType:
+		return "DeleteRowStatement"
+	case DeleteRangeStatementType:
+		return "DeleteRangeStatement"
+	case DeleteColumnsStatementType:
+		return "DeleteColumnsStatement"
 	default:
 		panic(fmt.Sprintf("unknown statement type %d", st))
 	}
@@ -153,6 +202,22 @@ func (t StatementCacheType) ToString() string {
 		return "CacheUpdate"
 	case CacheDelete:
 		return "CacheDelete"
+	case CacheUpdateCollectionAdd:
+		return "CacheUpdateCollectionAdd"
+	case CacheUpdateCollectionRemove:
+		return "CacheUpdateCollectionRemove"
+	case CacheUpdateCollection:
+		return "CacheUpdateCollection"
+	case CacheUpdateListPrepend:
+		return "CacheUpdateListPrepend"
+	case CacheUpdateListElement:
+		return "CacheUpdateListElement"
+	case CacheUpdateMapElement:
+		return "CacheUpdateMapElement"
+	case CacheDeletePartition:
+		return "CacheDeletePartition"
+	case CacheDeleteRow:
+		return "CacheDeleteRow"
 	default:
 		panic(fmt.Sprintf("unknown statement cache type %d", t))
 	}
@@ -163,5 +228,17 @@ const (
 	CacheInsertIfNotExists
 	CacheUpdate
 	CacheDelete
+	// The collection updates set the non-frozen collections of a row: they
+	// append to lists, add to sets and put into maps, remove list values,
+	// set elements and map keys, overwrite the collections, prepend to
+	// lists, set the first element of lists and put a key into maps.
+	CacheUpdateCollectionAdd
+	CacheUpdateCollectionRemove
+	CacheUpdateCollection
+	CacheUpdateListPrepend
+	CacheUpdateListElement
+	CacheUpdateMapElement
+	CacheDeletePartition
+	CacheDeleteRow
 	CacheArrayLen
 )
@@ -0,0 +1,334 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package workload holds the profiles weighting the kinds of statements the
+// jobs generate.
+package workload
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/exp/rand"
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of mutations, DDL is a schema change whose kind is drawn from the
+// DDL weights. UnloggedBatch writes several rows of a partition and
+// LoggedBatch several partitions, both are counter batches on counter
+// tables. UpdateCollection updates the elements of the non-frozen
+// collections of a row. Delete deletes a range of the first clustering key,
+// the other deletes a partition, a row, a range of a clustering key after a
+// prefix of the others, or columns and map keys of a row.
+const (
+	Insert            = "insert"
+	InsertIfNotExists = "insert_if_not_exists"
+	InsertJSON        = "insert_json"
+	Delete            = "delete"
+	DeletePartition   = "delete_partition"
+	DeleteRow         = "delete_row"
+	DeleteRange       = "delete_range"
+	DeleteColumns     = "delete_columns"
+	UnloggedBatch     = "unlogged_batch"
+	LoggedBatch       = "logged_batch"
+	UpdateCollection  = "update_collection"
+	DDL               = "ddl"
+)
+
+// Shapes of validation queries, the view shapes query a materialized view
+// of the table.
+const (
+	SinglePartition                       = "single_partition"
+	MultiplePartitions                    = "multiple_partitions"
+	ClusteringRange                       = "clustering_range"
+	MultiplePartitionsClusteringRange     = "multiple_partitions_clustering_range"
+	SingleIndex                           = "single_index"
+	ViewSinglePartition                   = "view_single_partition"
+	ViewMultiplePartitions                = "view_multiple_partitions"
+	ViewClusteringRange                   = "view_clustering_range"
+	ViewMultiplePartitionsClusteringRange = "view_multiple_partitions_clustering_range"
+)
+
+// Kinds of schema changes.
+const (
+	AddColumn  = "add_column"
+	DropColumn = "drop_column"
+)
+
+var kinds = map[string][]string{
+	"mutations": {Insert, InsertIfNotExists, InsertJSON, Delete, DeletePartition, DeleteRow, DeleteRange, DeleteColumns, UnloggedBatch, LoggedBatch, UpdateCollection, DDL},
+	"checks": {
+		SinglePartition, MultiplePartitions, ClusteringRange, MultiplePartitionsClusteringRange, SingleIndex,
+		ViewSinglePartition, ViewMultiplePartitions, ViewClusteringRange, ViewMultiplePartitionsClusteringRange,
+	},
+	"ddl": {AddColumn, DropColumn},
+}
+
+// All allows every kind of statement to be drawn.
+func All(string) bool {
+	return true
+}
+
+// IsViewCheck reports whether the query shape queries a materialized view.
+func IsViewCheck(kind string) bool {
+	return strings.HasPrefix(kind, "view_")
+}
+
+// Weights are the relative weights of the kinds of statements, the kinds
+// that are left out are never generated.
+type Weights map[string]float64
+
+// Profile weights the mutations, validation queries and schema changes the
+// jobs generate. The sections left out of a profile file are drawn like
+// the ones of the default profile.
+type Profile struct {
+	Mutations Weights `json:"mutations" yaml:"mutations"`
+	Checks    Weights `json:"checks" yaml:"checks"`
+	DDL       Weights `json:"ddl" yaml:"ddl"`
+
+	mutations distribution
+	checks    distribution
+	ddl       distribution
+}
+
+// Default returns the profile of the jobs without a profile file.
+//
+// One mutation out of 100000 is a schema change and 1 out of 500 a delete,
+// half of the others are JSON inserts and a tenth of the remaining ones LWT
+// inserts if they are enabled. The other deletes, the batches and the
+// collection updates are only drawn by the profiles weighting them. The
+// validation queries have no weights, they are drawn by baselineCheck.
+func Default() *Profile {
+	p := &Profile{
+		Mutations: Weights{Insert: 45, InsertIfNotExists: 5, InsertJSON: 50, Delete: 0.2, DDL: 0.001},
+		DDL:       Weights{AddColumn: 3, DropColumn: 1},
+	}
+	if err := p.compile(); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+var defaultProfile = Default()
+
+// ReadFile reads a YAML or JSON profile file.
+func ReadFile(name string) (*Profile, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses a YAML or JSON profile, an empty one is the default profile.
+func Parse(data []byte) (*Profile, error) {
+	p := &Profile{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, errors.Wrap(err, "invalid workload profile")
+	}
+	if p.mutations == nil {
+		return Default(), nil
+	}
+	return p, nil
+}
+
+// UnmarshalYAML reads a profile, of a file or of a section of another file.
+func (p *Profile) UnmarshalYAML(value *yaml.Node) error {
+	var sections map[string]Weights
+	if err := value.Decode(&sections); err != nil {
+		return err
+	}
+	for section, w := range sections {
+		switch section {
+		case "mutations":
+			p.Mutations = w
+		case "checks":
+			p.Checks = w
+		case "ddl":
+			p.DDL = w
+		default:
+			return errors.Errorf("unknown section %q of the workload profile, expected mutations, checks or ddl", section)
+		}
+	}
+	if p.Mutations == nil {
+		p.Mutations = defaultProfile.Mutations
+	}
+	if p.Checks == nil {
+		p.Checks = defaultProfile.Checks
+	}
+	if p.DDL == nil {
+		p.DDL = defaultProfile.DDL
+	}
+	return p.compile()
+}
+
+func (p *Profile) compile() (err error) {
+	if p.mutations, err = newDistribution("mutations", p.Mutations); err != nil {
+		return err
+	}
+	if p.Checks != nil {
+		if p.checks, err = newDistribution("checks", p.Checks); err != nil {
+			return err
+		}
+	}
+	p.ddl, err = newDistribution("ddl", p.DDL)
+	return err
+}
+
+// Mutation draws the kind of a mutation among the allowed ones, it returns
+// Insert if none of them has a weight.
+func (p *Profile) Mutation(r *rand.Rand, allowed func(kind string) bool) string {
+	if p == nil {
+		p = defaultProfile
+	}
+	if kind := p.mutations.pick(r, allowed); kind != "" {
+		return kind
+	}
+	return Insert
+}
+
+// Check draws the shape of a validation query among the allowed ones, it
+// returns an empty string if none of them has a weight. Profiles without
+// check weights draw it with baselineCheck.
+func (p *Profile) Check(r *rand.Rand, allowed func(kind string) bool) string {
+	if p == nil {
+		p = defaultProfile
+	}
+	if p.Checks == nil {
+		return baselineCheck(r, allowed)
+	}
+	return p.checks.pick(r, allowed)
+}
+
+var (
+	tableChecks = []string{SinglePartition, MultiplePartitions, ClusteringRange, MultiplePartitionsClusteringRange}
+	viewChecks  = []string{ViewSinglePartition, ViewMultiplePartitions, ViewClusteringRange, ViewMultiplePartitionsClusteringRange}
+)
+
+// baselineCheck draws the shape of a validation query the way the jobs did
+// before the profiles, which depends on the shapes a table allows and can
+// not be expressed with weights: half of the queries query a view if they
+// are allowed, the shapes of a table or of a view are equally likely and
+// the index queries take a fifth shape on the tables with indexes, which
+// is an index query 1 time out of 5 and a single partition query otherwise
+// since index queries often take a long time to run.
+func baselineCheck(r *rand.Rand, allowed func(kind string) bool) string {
+	views, tables := allowedKinds(viewChecks, allowed), allowedKinds(tableChecks, allowed)
+	if len(views) > 0 && (len(tables) == 0 || r.Int()%2 == 0) {
+		return views[r.Intn(len(views))]
+	}
+	if !allowed(SingleIndex) {
+		if len(tables) == 0 {
+			return ""
+		}
+		return tables[r.Intn(len(tables))]
+	}
+	if n := r.Intn(len(tables) + 1); n < len(tables) {
+		return tables[n]
+	}
+	if r.Intn(5) == 0 || !allowed(SinglePartition) {
+		return SingleIndex
+	}
+	return SinglePartition
+}
+
+func allowedKinds(kinds []string, allowed func(kind string) bool) []string {
+	out := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		if allowed(kind) {
+			out = append(out, kind)
+		}
+	}
+	return out
+}
+
+// SchemaChange draws the kind of a schema change among the allowed ones, it
+// returns AddColumn if none of them has a weight.
+func (p *Profile) SchemaChange(r *rand.Rand, allowed func(kind string) bool) string {
+	if p == nil {
+		p = defaultProfile
+	}
+	if kind := p.ddl.pick(r, allowed); kind != "" {
+		return kind
+	}
+	return AddColumn
+}
+
+type choice struct {
+	kind   string
+	weight float64
+}
+
+// distribution holds the choices of weights sorted by kind, so that draws
+// with the same seed pick the same kinds.
+type distribution []choice
+
+func newDistribution(section string, w Weights) (distribution, error) {
+	d := make(distribution, 0, len(w))
+	for kind, weight := range w {
+		if !known(section, kind) {
+			return nil, errors.Errorf("unknown kind %q of %s, expected one of %s", kind, section, strings.Join(kinds[section], ", "))
+		}
+		if weight < 0 {
+			return nil, errors.Errorf("negative weight of %s %s", section, kind)
+		}
+		if weight > 0 {
+			d = append(d, choice{kind: kind, weight: weight})
+		}
+	}
+	if len(d) == 0 {
+		return nil, errors.Errorf("no weight of %s is positive", section)
+	}
+	sort.Slice(d, func(i, j int) bool {
+		return d[i].kind < d[j].kind
+	})
+	return d, nil
+}
+
+func known(section, kind string) bool {
+	for _, k := range kinds[section] {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (d distribution) pick(r *rand.Rand, allowed func(kind string) bool) string {
+	var total float64
+	for _, c := range d {
+		if allowed(c.kind) {
+			total += c.weight
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	x := r.Float64() * total
+	last := ""
+	for _, c := range d {
+		if !allowed(c.kind) {
+			continue
+		}
+		if x < c.weight {
+			return c.kind
+		}
+		x -= c.weight
+		last = c.kind
+	}
+	// Rounding errors.
+	return last
+}
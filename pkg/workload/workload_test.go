@@ -0,0 +1,173 @@
+// Copyright 2023 ScyllaDB
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package workload
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/exp/rand"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	for name, data := range map[string]string{
+		"yaml": "mutations:\n  insert: 3\n  delete: 1\nddl:\n  drop_column: 1\n",
+		"json": `{"mutations": {"insert": 3, "delete": 1}, "ddl": {"drop_column": 1}}`,
+	} {
+		p, err := Parse([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(p.Mutations) != 2 || p.Mutations[Insert] != 3 || p.Mutations[Delete] != 1 {
+			t.Errorf("%s: unexpected mutation weights %v", name, p.Mutations)
+		}
+		if p.Checks != nil {
+			t.Errorf("%s: expected the default checks, got %v", name, p.Checks)
+		}
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 100; i++ {
+			if kind := p.SchemaChange(r, All); kind != DropColumn {
+				t.Fatalf("%s: expected only %s, got %s", name, DropColumn, kind)
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+	for name, data := range map[string]string{
+		"unknown section": "queries:\n  insert: 1\n",
+		"unknown kind":    "mutations:\n  upsert: 1\n",
+		"check kind":      "mutations:\n  single_partition: 1\n",
+		"negative weight": "checks:\n  single_partition: -1\n",
+		"no weight":       "ddl:\n  add_column: 0\n  drop_column: 0\n",
+		"empty section":   "mutations: {}\n",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	t.Parallel()
+	p, err := Parse([]byte("mutations:\n  insert: 3\n  insert_json: 1\n  delete: 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(1))
+	const draws = 100000
+	counts := map[string]int{}
+	for i := 0; i < draws; i++ {
+		counts[p.Mutation(r, All)]++
+	}
+	if counts[Delete] != 0 || len(counts) != 2 {
+		t.Errorf("expected only inserts and JSON inserts, got %v", counts)
+	}
+	if ratio := float64(counts[Insert]) / draws; math.Abs(ratio-0.75) > 0.01 {
+		t.Errorf("expected 3 inserts out of 4 mutations, got a ratio of %f", ratio)
+	}
+
+	noJSON := func(kind string) bool {
+		return kind != InsertJSON
+	}
+	for i := 0; i < 100; i++ {
+		if kind := p.Mutation(r, noJSON); kind != Insert {
+			t.Fatalf("expected only inserts, got %s", kind)
+		}
+	}
+	none := func(string) bool {
+		return false
+	}
+	if kind := p.Mutation(r, none); kind != Insert {
+		t.Errorf("expected the fallback to an insert, got %s", kind)
+	}
+	if kind := p.Check(r, none); kind != "" {
+		t.Errorf("expected no query, got %s", kind)
+	}
+}
+
+func TestNilProfile(t *testing.T) {
+	t.Parallel()
+	var p *Profile
+	r := rand.New(rand.NewSource(1))
+	views := 0
+	for i := 0; i < 1000; i++ {
+		if IsViewCheck(p.Check(r, All)) {
+			views++
+		}
+	}
+	if views == 0 || views == 1000 {
+		t.Errorf("expected the default profile to query tables and views, got %d view queries out of 1000", views)
+	}
+}
+
+func TestDefaultChecks(t *testing.T) {
+	t.Parallel()
+	noViews := func(kind string) bool {
+		return !IsViewCheck(kind)
+	}
+	noIndexes := func(kind string) bool {
+		return kind != SingleIndex
+	}
+	tablesOnly := func(kind string) bool {
+		return noViews(kind) && noIndexes(kind)
+	}
+	tests := []struct {
+		allowed  func(kind string) bool
+		expected map[string]float64
+		name     string
+	}{
+		{
+			name:    "table",
+			allowed: tablesOnly,
+			expected: map[string]float64{
+				SinglePartition: 0.25, MultiplePartitions: 0.25, ClusteringRange: 0.25, MultiplePartitionsClusteringRange: 0.25,
+			},
+		},
+		{
+			name:    "indexes",
+			allowed: noViews,
+			expected: map[string]float64{
+				SinglePartition: 0.36, MultiplePartitions: 0.2, ClusteringRange: 0.2, MultiplePartitionsClusteringRange: 0.2, SingleIndex: 0.04,
+			},
+		},
+		{
+			name:    "views and indexes",
+			allowed: All,
+			expected: map[string]float64{
+				SinglePartition: 0.18, MultiplePartitions: 0.1, ClusteringRange: 0.1, MultiplePartitionsClusteringRange: 0.1, SingleIndex: 0.02,
+				ViewSinglePartition: 0.125, ViewMultiplePartitions: 0.125, ViewClusteringRange: 0.125, ViewMultiplePartitionsClusteringRange: 0.125,
+			},
+		},
+	}
+	const draws = 200000
+	for _, test := range tests {
+		r := rand.New(rand.NewSource(1))
+		counts := map[string]int{}
+		for i := 0; i < draws; i++ {
+			counts[defaultProfile.Check(r, test.allowed)]++
+		}
+		if len(counts) != len(test.expected) {
+			t.Errorf("%s: expected the shapes %v, got %v", test.name, test.expected, counts)
+		}
+		for kind, ratio := range test.expected {
+			if got := float64(counts[kind]) / draws; math.Abs(got-ratio) > 0.005 {
+				t.Errorf("%s: expected a ratio of %f of %s, got %f", test.name, ratio, kind, got)
+			}
+		}
+	}
+}